@@ -3,37 +3,76 @@ package main
 import (
 	"api/config"
 	"api/internal/handlers"
+	"api/internal/health"
+	"api/internal/lifecycle"
+	"api/internal/middleware"
 	"api/internal/rabbitmq"
 	"api/internal/routes"
 	"api/pkg/logger"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
-	// Load environment variables and configuration
-	config.LoadEnv()
+	// Load the config file, its profile and environment overrides
+	if err := config.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Initialize logger
-	if err := logger.InitLogger(config.AppConfig.Logger.FilePath); err != nil {
+	if err := logger.InitLoggerWithOptions(logger.Options{
+		FilePath: config.AppConfig.Logger.FilePath,
+		MinLevel: config.AppConfig.Logger.MinLevel,
+		Format:   config.AppConfig.Logger.Format,
+		Rotate: logger.RotateOptions{
+			MaxSizeMB:  config.AppConfig.Logger.MaxSizeMB,
+			Daily:      config.AppConfig.Logger.RotateDaily,
+			MaxBackups: config.AppConfig.Logger.MaxBackups,
+			MaxAgeDays: config.AppConfig.Logger.MaxAgeDays,
+			Compress:   config.AppConfig.Logger.Compress,
+		},
+	}); err != nil {
 		panic(fmt.Sprintf("Failed to initialize logger: %v", err))
 	}
+	defer logger.Logger.Close()
 
 	logger.Info("Starting application...")
+	logger.Infow("configuration loaded", "profile", config.AppConfig.Profile, "file", config.AppConfig.File)
+
+	// Shutdown hooks run newest first, so register each one as its resource
+	// is set up
+	lc := lifecycle.New(time.Duration(config.AppConfig.ShutdownTimeout) * time.Second)
+
+	// The log level is the only setting applied live on reload
+	config.OnReload(func(cfg *config.Config) {
+		if err := logger.SetLevel(cfg.Logger.MinLevel); err != nil {
+			logger.Error("Failed to apply log level: %v", err)
+		}
+	})
+	stopWatch := config.Watch(time.Duration(config.AppConfig.WatchInterval) * time.Second)
+	stopSecrets := config.WatchSecrets(time.Duration(config.AppConfig.Secrets.RefreshInterval) * time.Second)
+	lc.OnShutdown("config watchers", func(ctx context.Context) error {
+		stopWatch()
+		stopSecrets()
+		return nil
+	})
 
 	// 4. Connect to RabbitMQ (which uses logger)
 	rmq, err := rabbitmq.ConnectRabbitMQ(config.AppConfig.RabbitMQ.URL)
 	if err != nil {
 		logger.Fatal("Failed to connect to RabbitMQ: %v", err)
 	}
-	defer rmq.Close()
+	lc.OnShutdown("broker connection", func(ctx context.Context) error {
+		rmq.Close()
+		return nil
+	})
 
 	// Get the channel
 	channel := rmq.GetChannel()
@@ -66,25 +105,24 @@ func main() {
 	// Start consuming messages
 	messages, err := consumer.ConsumeMessages()
 	if err != nil {
-		fmt.Printf("Failed to consume messages: %v\n", err)
+		logger.Error("Failed to consume messages: %v", err)
 	}
 
 	select {
 	case msg := <-messages:
-		fmt.Printf("3. Received raw message: %s\n", string(msg.Body))
+		logger.Info("Received raw message: %d bytes", len(msg.Body))
 
 		var rawMsg RawMessage
 		if err := json.Unmarshal(msg.Body, &rawMsg); err != nil {
-			fmt.Printf("Failed to unmarshal JSON: %v\n", err)
+			logger.Error("Failed to unmarshal JSON: %v", err)
 		}
 
 		decodedBody, err := base64.StdEncoding.DecodeString(rawMsg.Body)
 		if err != nil {
-			fmt.Printf("4. Decode error: %v\n", err)
-			fmt.Printf("4. Failed message: %s\n", rawMsg.Body)
+			logger.Error("Failed to decode base64 body of %d bytes: %v", len(rawMsg.Body), err)
 		}
 
-		fmt.Printf("5. Decoded message: %s\n", string(decodedBody))
+		logger.Debug("Decoded message: %d bytes", len(decodedBody))
 
 		decoded := DecodedMessage{
 			Headers:         msg.Headers,
@@ -95,14 +133,23 @@ func main() {
 
 		msg.Ack(false)
 
-		logger.Info("Successfully processed message: %v\n", decoded)
+		logger.Info("Successfully processed message: %v", decoded)
 
 	case <-time.After(10 * time.Second):
-		fmt.Println("No message available")
+		logger.Info("No message available")
 	}
 
 	// Initialize handlers
 	handlers.InitializeHandlers(producer, consumer)
+	handlers.InitializeBrokerWait(time.Duration(config.AppConfig.Deadlines.BrokerWait) * time.Second)
+	lc.OnShutdown("consumer", func(ctx context.Context) error {
+		return consumer.Cancel()
+	})
+
+	// Register dependency checks for /readyz
+	handlers.InitializeHealth(time.Duration(config.AppConfig.Health.CheckTimeout) * time.Second)
+	health.Register(health.Check{Name: "broker", Run: rmq.Check})
+	health.Register(health.Check{Name: "shutdown", Run: lc.Check})
 
 	// Create a new Fiber app with custom config
 	app := fiber.New(fiber.Config{
@@ -116,6 +163,12 @@ func main() {
 		},
 	})
 
+	// Give every request a child logger with its request and correlation IDs
+	app.Use(middleware.RequestLogger())
+	app.Use(middleware.Metrics())
+	// Bound every request and cancel its context when the client disconnects
+	app.Use(middleware.RequestContext(time.Duration(config.AppConfig.Deadlines.Request) * time.Second))
+
 	// Register routes
 	routes.RegisterRoutes(app)
 
@@ -127,11 +180,7 @@ func main() {
 			logger.Fatal("Failed to start server: %v", err)
 		}
 	}()
+	lc.OnShutdown("http server", app.ShutdownWithContext)
 
-	// Graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	logger.Info("Shutting down server...")
+	lc.Wait()
 }
@@ -0,0 +1,343 @@
+package config
+
+import (
+	"api/pkg/logger"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Profiles select an overlay section of the config file
+const (
+	ProfileDev     = "dev"
+	ProfileStaging = "staging"
+	ProfileProd    = "prod"
+)
+
+// defaultFiles are tried in order when CONFIG_FILE is not set
+var defaultFiles = []string{"config.yaml", "config.yml", "config.toml"}
+
+var (
+	reloadMu    sync.Mutex
+	reloadHooks []func(*Config)
+
+	envMu     sync.Mutex
+	envErrors []string
+)
+
+// Load builds AppConfig from defaults, the config file, the file's section
+// for the active profile and environment variables, each overriding the last.
+// It fails with every invalid field listed rather than falling back silently.
+func Load() error {
+	err := godotenv.Load()
+	if err != nil {
+		log.Println("Error loading .env file, using system environment variables")
+	}
+
+	cfg, err := build()
+	if err != nil {
+		return err
+	}
+	AppConfig = *cfg
+	return nil
+}
+
+func build() (*Config, error) {
+	envMu.Lock()
+	envErrors = nil
+	envMu.Unlock()
+
+	cfg := defaults()
+	cfg.Profile = strings.ToLower(GetEnv("APP_PROFILE", ProfileDev))
+	cfg.File = filePath()
+
+	switch cfg.Profile {
+	case ProfileDev, ProfileStaging, ProfileProd:
+	default:
+		return nil, fmt.Errorf("invalid configuration: APP_PROFILE must be one of %s, %s or %s, got %q",
+			ProfileDev, ProfileStaging, ProfileProd, cfg.Profile)
+	}
+
+	if cfg.File != "" {
+		if err := loadFile(&cfg, cfg.File, cfg.Profile); err != nil {
+			return nil, err
+		}
+	}
+
+	applyEnv(&cfg)
+
+	// Secret references in either source are resolved before validation
+	refs, err := resolveSecrets(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	rememberSecrets(&cfg, refs)
+	return &cfg, nil
+}
+
+// filePath returns CONFIG_FILE, or the first default file that exists, or ""
+func filePath() string {
+	if path := GetEnv("CONFIG_FILE", ""); path != "" {
+		return path
+	}
+	for _, path := range defaultFiles {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadFile decodes a YAML or TOML file over cfg. A top-level "profiles" table
+// holds per-profile overrides that are merged over the rest of the file.
+func loadFile(cfg *Config, path, profile string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		_, err = toml.Decode(string(data), &raw)
+	default:
+		return fmt.Errorf("unsupported config file %s: use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	if profiles, ok := raw["profiles"]; ok {
+		delete(raw, "profiles")
+
+		sections, ok := profiles.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: profiles must be a table keyed by profile name", path)
+		}
+		if section, ok := sections[profile]; ok {
+			overrides, ok := section.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: profiles.%s must be a table", path, profile)
+			}
+			mergeMaps(raw, overrides)
+		}
+	}
+
+	// Round-trip through JSON so the struct tags drive decoding and
+	// misspelled keys are reported instead of ignored
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("invalid configuration in %s: %v", path, strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+// mergeMaps deep-merges src into dst, with src winning
+func mergeMaps(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcTable, srcOK := value.(map[string]interface{})
+		dstTable, dstOK := dst[key].(map[string]interface{})
+		if srcOK && dstOK {
+			mergeMaps(dstTable, srcTable)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// OnReload registers a hook that receives every config accepted by a reload.
+// AppConfig keeps its startup values; hooks apply the reloadable fields.
+func OnReload(hook func(*Config)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHooks = append(reloadHooks, hook)
+}
+
+// Watch polls the config file every interval and reloads it when it changes.
+// Only the fields cleared by clearReloadable take effect; other changes are
+// logged as needing a restart. The returned function stops the watcher.
+func Watch(interval time.Duration) func() {
+	if AppConfig.File == "" || interval <= 0 {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last, _ := os.Stat(AppConfig.File)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(AppConfig.File)
+			if err != nil {
+				continue
+			}
+			if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+				continue
+			}
+			last = info
+			reload()
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(stop) }) }
+}
+
+func reload() {
+	cfg, err := build()
+	if err != nil {
+		logger.Error("Config reload rejected, keeping current settings: %v", err)
+		return
+	}
+
+	if fields := restartRequired(AppConfig, *cfg); len(fields) > 0 {
+		logger.Warn("Config changes to %s need a restart and were not applied", strings.Join(fields, ", "))
+	}
+
+	reloadMu.Lock()
+	hooks := append([]func(*Config){}, reloadHooks...)
+	reloadMu.Unlock()
+
+	for _, hook := range hooks {
+		hook(cfg)
+	}
+	logger.Info("Reloaded config from %s", cfg.File)
+}
+
+// restartRequired names the top-level sections that differ outside the reloadable fields
+func restartRequired(current, next Config) []string {
+	clearReloadable(&current)
+	clearReloadable(&next)
+
+	var fields []string
+	a, b := reflect.ValueOf(current), reflect.ValueOf(next)
+	for i := 0; i < a.NumField(); i++ {
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			name := strings.Split(a.Type().Field(i).Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				name = a.Type().Field(i).Name
+			}
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// reportEnv records an environment variable that could not be parsed
+func reportEnv(format string, args ...interface{}) {
+	envMu.Lock()
+	defer envMu.Unlock()
+	envErrors = append(envErrors, fmt.Sprintf(format, args...))
+}
+
+// envProblems returns the environment variables reported since the last build
+func envProblems() []string {
+	envMu.Lock()
+	defer envMu.Unlock()
+	return append([]string{}, envErrors...)
+}
+
+// ValidationError lists every invalid field found while loading
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// validator collects problems so all of them are reported at once. Fields
+// are named by file key and environment variable.
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.addf("%s is required", field)
+	}
+}
+
+func (v *validator) positive(field string, value int) {
+	if value <= 0 {
+		v.addf("%s must be greater than 0, got %d", field, value)
+	}
+}
+
+func (v *validator) nonNegative(field string, value int) {
+	if value < 0 {
+		v.addf("%s must not be negative, got %d", field, value)
+	}
+}
+
+func (v *validator) port(field, value string) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		v.addf("%s must be a port number between 1 and 65535, got %q", field, value)
+	}
+}
+
+func (v *validator) url(field, value string, schemes ...string) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		v.addf("%s must be a URL, got %q", field, value)
+		return
+	}
+	for _, s := range schemes {
+		if u.Scheme == s {
+			return
+		}
+	}
+	v.addf("%s must use one of the schemes %s, got %q", field, strings.Join(schemes, ", "), u.Scheme)
+}
+
+func (v *validator) oneOf(field, value string, options ...string) {
+	for _, o := range options {
+		if strings.EqualFold(value, o) {
+			return
+		}
+	}
+	v.addf("%s must be one of %s, got %q", field, strings.Join(options, ", "), value)
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
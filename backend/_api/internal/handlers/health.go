@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"api/internal/health"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var globalHealthTimeout = 2 * time.Second
+
+// InitializeHealth sets the time each dependency check may take
+func InitializeHealth(timeout time.Duration) {
+	globalHealthTimeout = timeout
+}
+
+// LivezHandler reports whether the process needs a restart
+func LivezHandler(c *fiber.Ctx) error {
+	return probe(c, true)
+}
+
+// ReadyzHandler reports whether the service can take traffic
+func ReadyzHandler(c *fiber.Ctx) error {
+	return probe(c, false)
+}
+
+func probe(c *fiber.Ctx, live bool) error {
+	report := health.Run(c.UserContext(), live, globalHealthTimeout)
+
+	status := fiber.StatusOK
+	if !report.Healthy() {
+		status = fiber.StatusServiceUnavailable
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(status).JSON(report)
+}
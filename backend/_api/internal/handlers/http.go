@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"api/internal/health"
+	"api/internal/middleware"
 	"api/internal/rabbitmq"
+	"api/pkg/logger"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -14,6 +18,8 @@ import (
 var (
 	globalProducer *rabbitmq.Producer
 	globalConsumer *rabbitmq.Consumer
+
+	globalBrokerWait = 10 * time.Second
 )
 
 // HomeHandler responds to the root route
@@ -24,8 +30,15 @@ func HomeHandler(c *fiber.Ctx) error {
 	})
 }
 
-// HealthCheckHandler responds to the health check route
+// HealthCheckHandler responds to the health check route. It reports readiness
+// in the original response shape; /readyz has the per-check detail.
 func HealthCheckHandler(c *fiber.Ctx) error {
+	if report := health.Run(c.UserContext(), false, globalHealthTimeout); !report.Healthy() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Service is not ready",
+		})
+	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status":  "success",
 		"message": "Service is healthy",
@@ -56,6 +69,15 @@ func InitializeHandlers(producer *rabbitmq.Producer, consumer *rabbitmq.Consumer
 	globalConsumer = consumer
 }
 
+// InitializeBrokerWait sets how long a request waits for a message after publishing
+func InitializeBrokerWait(timeout time.Duration) {
+	globalBrokerWait = timeout
+}
+
+// statusClientClosed is logged for requests the client abandoned; nobody
+// reads the response
+const statusClientClosed = 499
+
 type DecodedMessage struct {
 	Headers         map[string]interface{} `json:"headers"`
 	ContentType     string                 `json:"contentType"`
@@ -100,14 +122,18 @@ func PublishMessageThroughBroker(c *fiber.Ctx) error {
 		})
 	}
 
+	// Stop waiting at the deadline, or as soon as the client disconnects
+	ctx, cancel := context.WithTimeout(c.UserContext(), globalBrokerWait)
+	defer cancel()
+
 	select {
 	case msg := <-messages:
-		fmt.Printf("3. Received raw message: %s\n", string(msg.Body))
+		logger.Info("Received raw message: %d bytes", len(msg.Body))
 
 		// First unmarshal the outer JSON
 		var rawMsg RawMessage
 		if err := json.Unmarshal(msg.Body, &rawMsg); err != nil {
-			fmt.Printf("Failed to unmarshal JSON: %v\n", err)
+			logger.Error("Failed to unmarshal JSON: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
 				"message": "Failed to parse message",
@@ -117,15 +143,14 @@ func PublishMessageThroughBroker(c *fiber.Ctx) error {
 		// Now decode the base64 Body
 		decodedBody, err := base64.StdEncoding.DecodeString(rawMsg.Body)
 		if err != nil {
-			fmt.Printf("4. Decode error: %v\n", err)
-			fmt.Printf("4. Failed message: %s\n", rawMsg.Body)
+			logger.Error("Failed to decode base64 body of %d bytes: %v", len(rawMsg.Body), err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
 				"message": fmt.Sprintf("Failed to decode message: %v", err),
 			})
 		}
 
-		fmt.Printf("5. Decoded message: %s\n", string(decodedBody))
+		logger.Debug("Decoded message: %d bytes", len(decodedBody))
 
 		decoded := DecodedMessage{
 			Headers:         msg.Headers,
@@ -141,7 +166,11 @@ func PublishMessageThroughBroker(c *fiber.Ctx) error {
 			"message": decoded,
 		})
 
-	case <-time.After(10 * time.Second):
+	case <-ctx.Done():
+		if middleware.ClientGone(ctx) {
+			middleware.Logger(c).Infow("client disconnected while waiting for a message")
+			return c.SendStatus(statusClientClosed)
+		}
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"status":  "error",
 			"message": "No message available",
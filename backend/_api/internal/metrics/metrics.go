@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "api"
+
+// Outcome label values
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// Settlement label values for consumed messages
+const (
+	SettleAck     = "ack"
+	SettleNack    = "nack"
+	SettleRequeue = "requeue"
+)
+
+var (
+	// HTTPRequests counts finished requests by route pattern, not raw path,
+	// so path parameters do not create new series
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	BrokerPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_published_total",
+		Help:      "Messages published by exchange and outcome.",
+	}, []string{"exchange", "outcome"})
+
+	BrokerConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_consumed_total",
+		Help:      "Messages delivered by queue.",
+	}, []string{"queue"})
+
+	BrokerSettled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_settled_total",
+		Help:      "Consumed messages by queue and settlement: ack, nack or requeue.",
+	}, []string{"queue", "result"})
+
+	BrokerQueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "broker_queue_wait_seconds",
+		Help:      "Time between publish and delivery, for messages carrying a timestamp.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60},
+	}, []string{"queue"})
+)
+
+// Since returns the seconds elapsed since start, for Observe
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// Handler serves the default registry in the Prometheus text format
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
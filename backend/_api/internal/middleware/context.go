@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrClientGone is the cancellation cause once the client has disconnected
+var ErrClientGone = errors.New("client disconnected")
+
+// disconnectPoll is how often the connection is checked while a handler runs
+const disconnectPoll = 250 * time.Millisecond
+
+// RequestContext bounds every request by timeout and cancels its user context
+// as soon as the client disconnects, so handlers that pass c.UserContext() on
+// stop waiting for work nobody will read. fasthttp does neither on its own.
+func RequestContext(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithCancelCause(c.UserContext())
+		defer cancel(nil)
+		ctx, cancelTimeout := context.WithTimeout(ctx, timeout)
+		defer cancelTimeout()
+		c.SetUserContext(ctx)
+
+		// The request context is reused once the handler returns, so the
+		// watcher must be gone by then
+		conn := c.Context().Conn()
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			ticker := time.NewTicker(disconnectPoll)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if connClosed(conn) {
+						cancel(ErrClientGone)
+						return
+					}
+				}
+			}
+		}()
+
+		err := c.Next()
+		close(stop)
+		<-stopped
+		return err
+	}
+}
+
+// ClientGone reports whether ctx was cancelled because the client disconnected
+func ClientGone(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrClientGone)
+}
@@ -0,0 +1,37 @@
+//go:build linux || darwin
+
+package middleware
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// connClosed peeks at the socket without consuming anything: a zero-byte read
+// means the peer closed it, while no data yet means it is still open
+func connClosed(conn net.Conn) bool {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	closed := false
+	buf := make([]byte, 1)
+	raw.Read(func(fd uintptr) bool {
+		n, _, err := syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		switch {
+		case err == nil:
+			closed = n == 0
+		case errors.Is(err, syscall.EAGAIN), errors.Is(err, syscall.EINTR):
+		default:
+			closed = true
+		}
+		return true
+	})
+	return closed
+}
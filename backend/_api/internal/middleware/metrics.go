@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"api/internal/metrics"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Metrics records the count and latency of every request by route pattern
+func Metrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		// Errors returned by handlers are turned into responses after the
+		// middleware chain unwinds, so take the status from the error
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+		}
+
+		route := c.Route().Path
+		if status == fiber.StatusNotFound && route == "/" && c.Path() != "/" {
+			// Unmatched paths report the root route; keep them out of its series
+			route = "unmatched"
+		}
+
+		metrics.HTTPRequests.WithLabelValues(c.Method(), route, strconv.Itoa(status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(c.Method(), route).Observe(metrics.Since(start))
+		return err
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"api/pkg/logger"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Headers used to carry request and correlation IDs across services
+const (
+	HeaderRequestID     = "X-Request-ID"
+	HeaderCorrelationID = "X-Correlation-ID"
+)
+
+const localsLogger = "logger"
+
+type correlationKey struct{}
+
+// RequestLogger attaches a child logger carrying the request and correlation
+// IDs to every request and logs the outcome once the handler returns
+func RequestLogger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestID := c.Get(HeaderRequestID)
+		if requestID == "" {
+			requestID = newID()
+		}
+		correlationID := c.Get(HeaderCorrelationID)
+		if correlationID == "" {
+			correlationID = requestID
+		}
+
+		c.Set(HeaderRequestID, requestID)
+		c.Set(HeaderCorrelationID, correlationID)
+
+		log := logger.With("request_id", requestID, "correlation_id", correlationID)
+		c.Locals(localsLogger, log)
+		c.SetUserContext(context.WithValue(c.UserContext(), correlationKey{}, correlationID))
+
+		start := time.Now()
+		err := c.Next()
+
+		log.Infow("request completed",
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", c.Response().StatusCode(),
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return err
+	}
+}
+
+// Logger returns the request's child logger, or the global logger outside a request
+func Logger(c *fiber.Ctx) *logger.CustomLogger {
+	if log, ok := c.Locals(localsLogger).(*logger.CustomLogger); ok {
+		return log
+	}
+	return logger.Logger
+}
+
+// CorrelationID returns the correlation ID RequestLogger put on ctx, if any
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+func newID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
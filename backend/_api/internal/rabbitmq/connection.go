@@ -3,7 +3,9 @@ package rabbitmq
 import (
 	"api/config"
 	"api/pkg/logger"
+	"context"
 	"fmt"
+	"sync"
 
 	"github.com/streadway/amqp"
 )
@@ -11,6 +13,9 @@ import (
 type RabbitMQ struct {
 	Connection *amqp.Connection
 	Channel    *amqp.Channel
+
+	mu         sync.Mutex
+	channelErr error // set once the channel closes
 }
 
 // ConnectRabbitMQ establishes a connection to RabbitMQ
@@ -32,6 +37,7 @@ func ConnectRabbitMQ(url string) (*RabbitMQ, error) {
 		Connection: conn,
 		Channel:    ch,
 	}
+	rmq.watchChannel()
 
 	// Setup queues and exchanges
 	if err := rmq.SetupQueuesAndExchanges(); err != nil {
@@ -61,6 +67,34 @@ func (r *RabbitMQ) SetupQueuesAndExchanges() error {
 	return nil
 }
 
+// watchChannel records the channel closing, which the library otherwise
+// only reports to later calls on it
+func (r *RabbitMQ) watchChannel() {
+	closed := r.Channel.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		reason := <-closed
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if reason != nil {
+			r.channelErr = fmt.Errorf("channel closed: %v", reason)
+		} else {
+			r.channelErr = fmt.Errorf("channel closed")
+		}
+	}()
+}
+
+// Check reports whether the connection and channel are both still open
+func (r *RabbitMQ) Check(ctx context.Context) error {
+	if r.Connection == nil || r.Connection.IsClosed() {
+		return fmt.Errorf("connection closed")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.channelErr
+}
+
 // GetChannel returns the channel for use by producer/consumer
 func (r *RabbitMQ) GetChannel() *amqp.Channel {
 	return r.Channel
@@ -106,7 +140,7 @@ func (r *RabbitMQ) ConsumeMessages(handler func([]byte) error) error {
 	}
 
 	go func() {
-		for msg := range messages {
+		for msg := range instrument(messages, config.AppConfig.RabbitMQ.QueueName, false) {
 			err := handler(msg.Body)
 			if err != nil {
 				logger.Error("Error processing message: %v", err)
@@ -1,8 +1,14 @@
 package rabbitmq
 
 import (
+	"api/internal/metrics"
+	"api/pkg/logger"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"log"
 	"os"
+	"sync"
 
 	"github.com/streadway/amqp"
 )
@@ -10,6 +16,9 @@ import (
 type Consumer struct {
 	channel   *amqp.Channel
 	queueName string
+
+	mu   sync.Mutex
+	tags []string // consumer tags of active deliveries, for Cancel
 }
 
 func NewConsumer(channel *amqp.Channel, queueName string) (*Consumer, error) {
@@ -34,9 +43,10 @@ func NewConsumer(channel *amqp.Channel, queueName string) (*Consumer, error) {
 
 func (c *Consumer) ConsumeMessages() (<-chan amqp.Delivery, error) {
 	// Use the existing channel instead of creating new one
+	tag := c.newTag()
 	messages, err := c.channel.Consume(
 		c.queueName, // queue name
-		"",          // consumer
+		tag,         // consumer
 		true,        // auto-ack
 		false,       // exclusive
 		false,       // no local
@@ -47,7 +57,87 @@ func (c *Consumer) ConsumeMessages() (<-chan amqp.Delivery, error) {
 		return nil, err
 	}
 
-	return messages, nil
+	return instrument(messages, c.queueName, true), nil
+}
+
+// instrument counts every delivery and its queue wait. With auto-ack the
+// broker settles on delivery; otherwise acks and nacks are counted when the
+// handler makes them.
+func instrument(deliveries <-chan amqp.Delivery, queue string, autoAck bool) <-chan amqp.Delivery {
+	instrumented := make(chan amqp.Delivery)
+	go func() {
+		defer close(instrumented)
+		for msg := range deliveries {
+			metrics.BrokerConsumed.WithLabelValues(queue).Inc()
+			if !msg.Timestamp.IsZero() {
+				metrics.BrokerQueueWait.WithLabelValues(queue).Observe(metrics.Since(msg.Timestamp))
+			}
+			if autoAck {
+				metrics.BrokerSettled.WithLabelValues(queue, metrics.SettleAck).Inc()
+			} else {
+				msg.Acknowledger = countingAcknowledger{Acknowledger: msg.Acknowledger, queue: queue}
+			}
+			instrumented <- msg
+		}
+	}()
+	return instrumented
+}
+
+// countingAcknowledger counts settlements before passing them to the channel
+type countingAcknowledger struct {
+	amqp.Acknowledger
+	queue string
+}
+
+func (a countingAcknowledger) Ack(tag uint64, multiple bool) error {
+	metrics.BrokerSettled.WithLabelValues(a.queue, metrics.SettleAck).Inc()
+	return a.Acknowledger.Ack(tag, multiple)
+}
+
+func (a countingAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	metrics.BrokerSettled.WithLabelValues(a.queue, settlement(requeue)).Inc()
+	return a.Acknowledger.Nack(tag, multiple, requeue)
+}
+
+func (a countingAcknowledger) Reject(tag uint64, requeue bool) error {
+	metrics.BrokerSettled.WithLabelValues(a.queue, settlement(requeue)).Inc()
+	return a.Acknowledger.Reject(tag, requeue)
+}
+
+func settlement(requeue bool) string {
+	if requeue {
+		return metrics.SettleRequeue
+	}
+	return metrics.SettleNack
+}
+
+// newTag returns a unique consumer tag and remembers it for Cancel
+func (c *Consumer) newTag() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	tag := c.queueName + "-" + hex.EncodeToString(buf)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tags = append(c.tags, tag)
+	return tag
+}
+
+// Cancel stops the broker delivering to this consumer. Deliveries already
+// received stay valid and can still be acked; the delivery channels close
+// once they are drained.
+func (c *Consumer) Cancel() error {
+	c.mu.Lock()
+	tags := c.tags
+	c.tags = nil
+	c.mu.Unlock()
+
+	for _, tag := range tags {
+		if err := c.channel.Cancel(tag, false); err != nil {
+			return fmt.Errorf("failed to cancel consumer %s: %v", tag, err)
+		}
+	}
+	return nil
 }
 
 func (c *Consumer) Consume(handler func([]byte) error) error {
@@ -61,9 +151,7 @@ func (c *Consumer) Consume(handler func([]byte) error) error {
 	go func() {
 		for msg := range messages {
 			if err := handler(msg.Body); err != nil {
-				// Handle error (log it, retry, etc.)
-				// For now, just print it
-				println("Error processing message:", err.Error())
+				logger.Error("Error processing message: %v", err)
 			}
 		}
 	}()
@@ -114,7 +202,7 @@ func ConsumeMessages() {
 	go func() {
 		for message := range messages {
 			// For example, show received message in a console.
-			log.Printf(" > Received message: %s\n", message.Body)
+			log.Printf(" > Received message: %d bytes\n", len(message.Body))
 		}
 	}()
 
@@ -1,7 +1,9 @@
 package rabbitmq
 
 import (
+	"api/internal/metrics"
 	"encoding/json"
+	"time"
 
 	"github.com/streadway/amqp"
 )
@@ -38,15 +40,24 @@ func (p *Producer) PublishMessage(message interface{}) error {
 		return err
 	}
 
-	// Publish the message
-	return p.channel.Publish(
+	// Publish the message; the timestamp lets consumers measure queue wait
+	err = p.channel.Publish(
 		"",          // exchange
 		p.queueName, // routing key
 		false,       // mandatory
 		false,       // immediate
 		amqp.Publishing{
 			ContentType: "application/json",
+			Timestamp:   time.Now(),
 			Body:        body,
 		},
 	)
+
+	// Publishes go through the default exchange, named "" by the broker
+	outcome := metrics.OutcomeSuccess
+	if err != nil {
+		outcome = metrics.OutcomeError
+	}
+	metrics.BrokerPublished.WithLabelValues("default", outcome).Inc()
+	return err
 }
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"api/internal/handlers"
+	"api/internal/metrics"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -13,6 +14,9 @@ func RegisterRoutes(app *fiber.App) {
 	// Public routes
 	app.Get("/", handlers.HomeHandler)
 	app.Get("/health", handlers.HealthCheckHandler)
+	app.Get("/livez", handlers.LivezHandler)
+	app.Get("/readyz", handlers.ReadyzHandler)
+	app.Get("/metrics", metrics.Handler())
 
 	// API endpoints
 	api.Post("/publish", handlers.PublishHandler)
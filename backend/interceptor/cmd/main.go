@@ -1,37 +1,83 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
 	"fmt"
 	"interceptor/config"
+	"interceptor/internal/audit"
+	"interceptor/internal/chat"
+	"interceptor/internal/conversations"
+	"interceptor/internal/grants"
 	"interceptor/internal/handlers"
+	"interceptor/internal/health"
+	"interceptor/internal/jobs"
+	"interceptor/internal/keycache"
+	"interceptor/internal/keyring"
+	"interceptor/internal/lifecycle"
+	"interceptor/internal/middleware"
+	"interceptor/internal/policy"
+	"interceptor/internal/providers"
 	"interceptor/internal/rabbitmq"
+	"interceptor/internal/ratelimit"
+	"interceptor/internal/respcache"
 	"interceptor/internal/routes"
+	"interceptor/internal/services"
+	"interceptor/internal/sessions"
+	"interceptor/internal/tokenizer"
+	"interceptor/internal/tools"
+	"interceptor/internal/usage"
+	"interceptor/internal/webhooks"
 	"interceptor/pkg/logger"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
-	// Load environment variables and configuration
-	config.LoadEnv()
+	// Load the config file, its profile and environment overrides
+	if err := config.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Initialize logger
-	if err := logger.InitLogger(config.AppConfig.Logger.FilePath); err != nil {
+	if err := logger.InitLoggerWithOptions(logger.Options{
+		FilePath: config.AppConfig.Logger.FilePath,
+		MinLevel: config.AppConfig.Logger.MinLevel,
+		Format:   config.AppConfig.Logger.Format,
+		Rotate: logger.RotateOptions{
+			MaxSizeMB:  config.AppConfig.Logger.MaxSizeMB,
+			Daily:      config.AppConfig.Logger.RotateDaily,
+			MaxBackups: config.AppConfig.Logger.MaxBackups,
+			MaxAgeDays: config.AppConfig.Logger.MaxAgeDays,
+			Compress:   config.AppConfig.Logger.Compress,
+		},
+	}); err != nil {
 		panic(fmt.Sprintf("Failed to initialize logger: %v", err))
 	}
 
+	// The log is flushed and closed last, after every shutdown step
+	defer logger.Logger.Close()
+
 	logger.Info("Starting application...")
+	logger.Infow("configuration loaded", "profile", config.AppConfig.Profile, "file", config.AppConfig.File)
+
+	// Shutdown steps are registered as each resource is set up and run in
+	// reverse: HTTP first, then consumers, then files, then the broker
+	lc := lifecycle.New(time.Duration(config.AppConfig.ShutdownTimeout) * time.Second)
 
 	// 4. Connect to RabbitMQ (which uses logger)
 	rmq, err := rabbitmq.ConnectRabbitMQ(config.AppConfig.RabbitMQConsumer.URL)
 	if err != nil {
 		logger.Fatal("Failed to connect to RabbitMQ: %v", err)
 	}
-	defer rmq.Close()
+	lc.OnShutdown("broker connection", func(ctx context.Context) error {
+		rmq.Close()
+		return nil
+	})
 
 	// Get the channel
 	channel := rmq.GetChannel()
@@ -77,6 +123,320 @@ func main() {
 	// Initialize handlers
 	handlers.InitializeHandlers(producer, consumer)
 
+	// Open the grant store and usage log
+	grantStore, err := grants.NewFileStore(config.AppConfig.Grants.FilePath)
+	if err != nil {
+		logger.Fatal("Failed to open grant store: %v", err)
+	}
+
+	usageRecorder, err := usage.NewRecorder(config.AppConfig.Usage.FilePath)
+	if err != nil {
+		logger.Fatal("Failed to open usage log: %v", err)
+	}
+	lc.OnShutdown("usage log", func(ctx context.Context) error {
+		usageRecorder.Close()
+		return nil
+	})
+
+	handlers.InitializeGrantHandlers(grantStore, usageRecorder)
+
+	// Open the hash-chained audit log of key use and LLM calls
+	var auditSigner ed25519.PrivateKey
+	if config.AppConfig.Audit.SigningKey != "" {
+		auditSigner, err = audit.ParseSigningKey(config.AppConfig.Audit.SigningKey)
+		if err != nil {
+			logger.Fatal("Failed to load audit signing key: %v", err)
+		}
+	} else {
+		logger.Warn("No audit signing key configured; checkpoints will not be signed")
+	}
+
+	auditLog, err := audit.NewLog(
+		config.AppConfig.Audit.FilePath,
+		config.AppConfig.Audit.CheckpointsPath,
+		config.AppConfig.Audit.CheckpointInterval,
+		auditSigner,
+	)
+	if err != nil {
+		logger.Fatal("Failed to open audit log: %v", err)
+	}
+	lc.OnShutdown("audit log", func(ctx context.Context) error {
+		auditLog.Close()
+		return nil
+	})
+
+	handlers.InitializeAudit(auditLog)
+
+	// Open the conversation database
+	conversationStore, err := conversations.NewBoltStore(config.AppConfig.Conversations.DBPath)
+	if err != nil {
+		logger.Fatal("Failed to open conversation store: %v", err)
+	}
+	lc.OnShutdown("conversation store", func(ctx context.Context) error {
+		return conversationStore.Close()
+	})
+	handlers.InitializeConversations(
+		conversationStore,
+		config.AppConfig.Conversations.Strategy,
+		config.AppConfig.Conversations.SummaryMaxTokens,
+	)
+
+	// Price table, context windows and per-address rate limit, all reloadable
+	usage.SetPrices(modelPrices(config.AppConfig.Models))
+	tokenizer.SetModels(modelWindows(config.AppConfig.Models))
+	handlers.InitializeContextWindow(config.AppConfig.Context.Overflow, config.AppConfig.Context.ReserveTokens)
+
+	rateLimiter := ratelimit.New(config.AppConfig.RateLimit.RequestsPerMinute, config.AppConfig.RateLimit.Burst)
+	handlers.InitializeRateLimiter(rateLimiter)
+
+	// Policy rules from the config file are reloadable; admin edits persist
+	policyStore, err := policy.NewFileStore(config.AppConfig.Policies.FilePath)
+	if err != nil {
+		logger.Fatal("Failed to open policy store: %v", err)
+	}
+	policyEngine, err := policy.NewEngine(policyStore, policyRules(config.AppConfig.Policies.Rules))
+	if err != nil {
+		logger.Fatal("Failed to load policies: %v", err)
+	}
+	handlers.InitializePolicies(policyEngine)
+
+	// Apply the reloadable subset whenever the config file changes
+	config.OnReload(func(cfg *config.Config) {
+		if err := logger.SetLevel(cfg.Logger.MinLevel); err != nil {
+			logger.Error("Failed to apply log level: %v", err)
+		}
+		rateLimiter.SetLimit(cfg.RateLimit.RequestsPerMinute, cfg.RateLimit.Burst)
+		usage.SetPrices(modelPrices(cfg.Models))
+		tokenizer.SetModels(modelWindows(cfg.Models))
+		if err := policyEngine.SetConfigRules(policyRules(cfg.Policies.Rules)); err != nil {
+			logger.Error("Failed to apply policies: %v", err)
+		}
+	})
+	stopWatch := config.Watch(time.Duration(config.AppConfig.WatchInterval) * time.Second)
+	stopSecrets := config.WatchSecrets(time.Duration(config.AppConfig.Secrets.RefreshInterval) * time.Second)
+	lc.OnShutdown("config watchers", func(ctx context.Context) error {
+		stopWatch()
+		stopSecrets()
+		return nil
+	})
+
+	// Start the keyring client, which owns the consumer for key replies
+	keyringClient, err := keyring.NewClient(
+		producer,
+		consumer,
+		time.Duration(config.AppConfig.Keyring.Timeout)*time.Second,
+		time.Duration(config.AppConfig.Keyring.RetiredTTL)*time.Second,
+	)
+	if err != nil {
+		logger.Fatal("Failed to start keyring client: %v", err)
+	}
+
+	// Listen for rotations and revocations so retired keys are never served
+	keyEvents, err := rabbitmq.NewBroadcastConsumer(channel, config.AppConfig.Keyring.EventsExchangeName)
+	if err != nil {
+		logger.Fatal("Failed to create key events consumer: %v", err)
+	}
+
+	if err := keyringClient.WatchEvents(keyEvents); err != nil {
+		logger.Fatal("Failed to watch key events: %v", err)
+	}
+
+	// Stop both consumers and let them settle what they already received
+	lc.OnShutdown("keyring consumers", func(ctx context.Context) error {
+		if err := consumer.Cancel(); err != nil {
+			return err
+		}
+		if err := keyEvents.Cancel(); err != nil {
+			return err
+		}
+		return keyringClient.Wait(ctx)
+	})
+
+	// Cache resolved keys and drop an owner's entries as soon as a key changes
+	keyCache := keycache.New(
+		time.Duration(config.AppConfig.KeyCache.TTL)*time.Second,
+		config.AppConfig.KeyCache.MaxEntries,
+	)
+	lc.OnShutdown("key cache", func(ctx context.Context) error {
+		keyCache.Close()
+		return nil
+	})
+
+	keyringClient.OnEvent(func(event keyring.Event) {
+		keyCache.InvalidateAddress(event.Address)
+	})
+
+	handlers.InitializeKeyringHandlers(keyringClient, keyCache)
+
+	// Completions retry and fail over along the configured chains
+	routing := config.AppConfig.Routing
+	completionProviders := []providers.Provider{
+		providers.NewOpenAI(routing.OpenAIBaseURL),
+		providers.NewAnthropic(routing.AnthropicBaseURL, routing.AnthropicMaxTokens),
+	}
+	if routing.LocalBaseURL != "" {
+		completionProviders = append(completionProviders, providers.NewLocal(routing.LocalBaseURL))
+	}
+	handlers.InitializeRouter(providers.NewRouter(providers.RetryPolicy{
+		MaxAttempts:    routing.MaxAttempts,
+		BaseDelay:      time.Duration(routing.BaseDelayMs) * time.Millisecond,
+		MaxDelay:       time.Duration(routing.MaxDelayMs) * time.Millisecond,
+		MaxRetryAfter:  time.Duration(routing.MaxRetryAfter) * time.Second,
+		AttemptTimeout: time.Duration(config.AppConfig.Deadlines.Provider) * time.Second,
+	}, routeChains(routing.Chains), completionProviders...))
+
+	// Cache deterministic completions when a backend is configured
+	if cacheConfig := config.AppConfig.ResponseCache; cacheConfig.Backend != "" {
+		ttl := time.Duration(cacheConfig.TTL) * time.Second
+		var responseCache respcache.Cache
+		switch strings.ToLower(cacheConfig.Backend) {
+		case "disk":
+			disk, err := respcache.NewDisk(cacheConfig.Dir, ttl)
+			if err != nil {
+				logger.Fatal("Failed to open response cache: %v", err)
+			}
+			responseCache = disk
+		default:
+			responseCache = respcache.NewMemory(ttl, cacheConfig.MaxEntries)
+		}
+		handlers.InitializeResponseCache(responseCache)
+		lc.OnShutdown("response cache", func(ctx context.Context) error {
+			return responseCache.Close()
+		})
+	}
+
+	// Webhook deliveries outlive requests; those still pending at shutdown
+	// are picked up again on the next start. Registered before the job
+	// workers, so the workers drain before deliveries stop and the store
+	// closes.
+	webhookStore, err := webhooks.NewBoltStore(config.AppConfig.Webhooks.DBPath, config.AppConfig.Webhooks.LogSize)
+	if err != nil {
+		logger.Fatal("Failed to open webhook store: %v", err)
+	}
+	lc.OnShutdown("webhook store", func(ctx context.Context) error {
+		return webhookStore.Close()
+	})
+
+	dispatcher := webhooks.NewDispatcher(webhookStore, webhooks.Options{
+		Timeout:      time.Duration(config.AppConfig.Webhooks.Timeout) * time.Second,
+		MaxAttempts:  config.AppConfig.Webhooks.MaxAttempts,
+		BaseDelay:    time.Duration(config.AppConfig.Webhooks.BaseDelay) * time.Second,
+		MaxDelay:     time.Duration(config.AppConfig.Webhooks.MaxDelay) * time.Second,
+		Concurrency:  config.AppConfig.Webhooks.Concurrency,
+		AllowPrivate: config.AppConfig.Webhooks.AllowPrivate,
+	})
+	if err := dispatcher.Start(); err != nil {
+		logger.Fatal("Failed to start webhook deliveries: %v", err)
+	}
+	lc.OnShutdown("webhook deliveries", func(ctx context.Context) error {
+		dispatcher.Stop()
+		return dispatcher.Wait(ctx)
+	})
+
+	// Batch jobs run on their own channel, which bounds how many items this
+	// instance holds at once. Registered after the keyring consumers, so the
+	// workers stop before the key lookups they depend on.
+	jobStore, err := jobs.NewBoltStore(config.AppConfig.Jobs.DBPath)
+	if err != nil {
+		logger.Fatal("Failed to open job store: %v", err)
+	}
+	lc.OnShutdown("job store", func(ctx context.Context) error {
+		return jobStore.Close()
+	})
+
+	jobChannel, err := rmq.OpenChannel(config.AppConfig.Jobs.Concurrency)
+	if err != nil {
+		logger.Fatal("Failed to open job channel: %v", err)
+	}
+	jobProducer, err := rabbitmq.NewProducer(
+		jobChannel,
+		config.AppConfig.Jobs.QueueName,
+		config.AppConfig.Jobs.ExchangeName,
+		config.AppConfig.Jobs.RoutingKey,
+	)
+	if err != nil {
+		logger.Fatal("Failed to create job producer: %v", err)
+	}
+	jobConsumer, err := rabbitmq.NewConsumer(
+		jobChannel,
+		config.AppConfig.Jobs.QueueName,
+		config.AppConfig.Jobs.ExchangeName,
+		config.AppConfig.Jobs.RoutingKey,
+	)
+	if err != nil {
+		logger.Fatal("Failed to create job consumer: %v", err)
+	}
+
+	jobWorker, err := jobs.NewWorker(
+		jobStore,
+		jobProducer,
+		jobConsumer,
+		handlers.ProcessJobItem,
+		config.AppConfig.Jobs.Concurrency,
+		config.AppConfig.Jobs.MaxAttempts,
+		time.Duration(config.AppConfig.Jobs.RetryDelay)*time.Second,
+	)
+	if err != nil {
+		logger.Fatal("Failed to start job workers: %v", err)
+	}
+	lc.OnShutdown("job workers", func(ctx context.Context) error {
+		if err := jobWorker.Stop(); err != nil {
+			return err
+		}
+		return jobWorker.Wait(ctx)
+	})
+
+	handlers.InitializeJobs(
+		jobStore,
+		jobWorker,
+		config.AppConfig.Jobs.MaxItems,
+		time.Duration(config.AppConfig.Deadlines.Request)*time.Second,
+	)
+
+	handlers.InitializeWebhooks(
+		webhookStore,
+		dispatcher,
+		services.NewMessageProcessor(dispatcher),
+		config.AppConfig.Webhooks.AllowHTTP,
+		config.AppConfig.Webhooks.BudgetThresholds,
+	)
+
+	// Session tokens let the chat socket authenticate once instead of having
+	// every turn signed
+	if config.AppConfig.Sessions.Secret == "" {
+		logger.Warn("sessions.secret is not set; session tokens will not survive a restart or work across instances")
+	}
+	sessionIssuer := sessions.NewIssuer(config.AppConfig.Sessions.Secret, time.Duration(config.AppConfig.Sessions.TTL)*time.Second)
+	handlers.InitializeSessions(sessionIssuer)
+
+	chatHub := chat.NewHub(sessionIssuer, handlers.ServeChatTurn, chat.Options{
+		AuthTimeout:  time.Duration(config.AppConfig.Chat.AuthTimeout) * time.Second,
+		PingInterval: time.Duration(config.AppConfig.Chat.PingInterval) * time.Second,
+		MaxTurns:     config.AppConfig.Chat.MaxTurns,
+		TurnTimeout:  time.Duration(config.AppConfig.Deadlines.Request) * time.Second,
+		MaxFrameSize: int64(config.AppConfig.Chat.MaxFrameSize),
+	})
+	handlers.InitializeChat(chatHub)
+
+	// Server-side tools run inside the completion loop for requests that ask
+	// for them by name
+	if config.AppConfig.Tools.Enabled {
+		toolRegistry := tools.NewRegistry(time.Duration(config.AppConfig.Tools.Timeout) * time.Second)
+		toolRegistry.Register(tools.KeyStatus(keyringClient))
+		handlers.InitializeTools(toolRegistry, config.AppConfig.Tools.MaxIterations)
+	}
+
+	// Register dependency checks for /livez and /readyz. A stopped consumer
+	// never restarts, so only a restart of the process recovers it.
+	handlers.InitializeHealth(time.Duration(config.AppConfig.Health.CheckTimeout) * time.Second)
+	health.Register(health.Check{Name: "shutdown", Run: lc.Check})
+	health.Register(health.Check{Name: "broker", Run: rmq.Check})
+	health.Register(health.Check{Name: "keyring_consumers", Live: true, Run: keyringClient.Check})
+	health.Register(health.Check{Name: "job_consumer", Live: true, Run: jobWorker.Check})
+	if config.AppConfig.Health.ProbeProviders {
+		health.Register(health.Check{Name: "provider_openai", Optional: true, Run: handlers.CheckProvider})
+	}
+
 	// Create a new Fiber app with custom config
 	app := fiber.New(fiber.Config{
 		ReadTimeout:  time.Duration(config.AppConfig.Server.ReadTimeout) * time.Second,
@@ -89,6 +449,12 @@ func main() {
 		},
 	})
 
+	// Give every request a child logger with its request and correlation IDs
+	app.Use(middleware.RequestLogger())
+	app.Use(middleware.Metrics())
+	// Bound every request and cancel its context when the client disconnects
+	app.Use(middleware.RequestContext(time.Duration(config.AppConfig.Deadlines.Request) * time.Second))
+
 	// Register routes
 	routes.RegisterRoutes(app)
 
@@ -101,10 +467,82 @@ func main() {
 		}
 	}()
 
-	// Graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// Stop taking requests and wait for in-flight ones, such as LLM calls,
+	// before the consumers their key lookups depend on
+	lc.OnShutdown("http server", func(ctx context.Context) error {
+		return app.ShutdownWithContext(ctx)
+	})
+
+	// Chat connections are long-lived, so they are closed, canceling their
+	// turns, rather than waited for; registered last, this runs first
+	lc.OnShutdown("chat connections", func(ctx context.Context) error {
+		return chatHub.Close(ctx)
+	})
+
+	// Block until SIGINT or SIGTERM, then run the steps above in reverse
+	lc.Wait()
+}
+
+// routeChains converts the configured failover chains into routes, filling in
+// each route's default provider
+func routeChains(chains map[string][]config.RouteConfig) map[string][]providers.Route {
+	routes := make(map[string][]providers.Route, len(chains))
+	for model, chain := range chains {
+		for _, step := range chain {
+			provider := strings.ToLower(step.Provider)
+			if provider == "" {
+				provider = providers.ForModel(step.Model)
+			}
+			routes[model] = append(routes[model], providers.Route{Provider: provider, Model: step.Model, Key: step.Key})
+		}
+	}
+	return routes
+}
+
+// policyRules converts the configured policy rules for the policy engine
+func policyRules(rules []config.PolicyRuleConfig) []policy.Rule {
+	result := make([]policy.Rule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, policy.Rule{
+			ID:             rule.ID,
+			Address:        rule.Address,
+			GrantID:        rule.GrantID,
+			Models:         append([]string(nil), rule.Models...),
+			MaxTokens:      rule.MaxTokens,
+			MinTemperature: rule.MinTemperature,
+			MaxTemperature: rule.MaxTemperature,
+			BannedTools:    append([]string(nil), rule.BannedTools...),
+			SystemPrefixes: rule.SystemPrefixes,
+			Overflow:       rule.Overflow,
+		})
+	}
+	return result
+}
 
-	logger.Info("Shutting down server...")
+// modelPrices converts the configured model table into usage prices
+func modelPrices(models map[string]config.ModelConfig) map[string]usage.Price {
+	prices := make(map[string]usage.Price, len(models))
+	for name, model := range models {
+		if model.PromptPrice == nil && model.CompletionPrice == nil {
+			continue
+		}
+		var price usage.Price
+		if model.PromptPrice != nil {
+			price.Prompt = *model.PromptPrice
+		}
+		if model.CompletionPrice != nil {
+			price.Completion = *model.CompletionPrice
+		}
+		prices[name] = price
+	}
+	return prices
+}
+
+// modelWindows converts the configured model table into tokenizer entries
+func modelWindows(models map[string]config.ModelConfig) map[string]tokenizer.Model {
+	windows := make(map[string]tokenizer.Model, len(models))
+	for name, model := range models {
+		windows[name] = tokenizer.Model{Encoding: strings.ToLower(model.Encoding), ContextWindow: model.ContextWindow}
+	}
+	return windows
 }
@@ -0,0 +1,232 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionCompletion = "completion"
+	ActionSummary    = "summary"
+	ActionJobItem    = "job_item"
+	ActionChatTurn   = "chat_turn"
+	ActionRotateKey  = "rotate_key"
+	ActionRevokeKey  = "revoke_key"
+	ActionDeleteKey  = "delete_key"
+)
+
+// Outcomes recorded in the audit log
+const (
+	OutcomeSuccess        = "success"
+	OutcomeDenied         = "denied"
+	OutcomeKeyUnavailable = "key_unavailable"
+	OutcomeProviderError  = "provider_error"
+	OutcomeFailed         = "failed"
+	OutcomeCanceled       = "canceled"
+	OutcomeCacheHit       = "cache_hit"
+)
+
+// Record is one audit entry. Hash covers every other field, including the
+// previous record's hash, so editing or removing a record breaks the chain.
+type Record struct {
+	Seq              uint64    `json:"seq"`
+	Timestamp        time.Time `json:"timestamp"`
+	Address          string    `json:"address"`
+	KeyOwner         string    `json:"key_owner,omitempty"`
+	KeyName          string    `json:"key_name,omitempty"`
+	GrantID          string    `json:"grant_id,omitempty"`
+	Action           string    `json:"action"`
+	Model            string    `json:"model,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens,omitempty"`
+	CompletionTokens int       `json:"completion_tokens,omitempty"`
+	RequestHash      string    `json:"request_hash,omitempty"`
+	Outcome          string    `json:"outcome"`
+	PrevHash         string    `json:"prev_hash"`
+	Hash             string    `json:"hash"`
+}
+
+// Checkpoint pins the chain head at a sequence number. Checkpoints are kept
+// in their own file so truncating the log's tail is also detectable, and are
+// signed so rewriting the whole chain and its checkpoints is too.
+type Checkpoint struct {
+	Seq       uint64    `json:"seq"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+	Signature string    `json:"signature,omitempty"`
+}
+
+// genesisHash is the previous hash of the first record
+var genesisHash = strings.Repeat("0", 64)
+
+// ComputeHash returns the hex SHA-256 of the record with its Hash field empty
+func (r Record) ComputeHash() string {
+	r.Hash = ""
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashRequest returns the hex SHA-256 of the request parts, so the log can
+// prove what was asked without storing the prompt itself
+func HashRequest(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Log appends hash-chained records to a JSON-lines file and writes a
+// checkpoint every interval records
+type Log struct {
+	mu              sync.Mutex
+	file            *os.File
+	checkpointsFile *os.File
+	interval        uint64
+	seq             uint64
+	head            string
+	checkpointed    uint64
+	signer          ed25519.PrivateKey
+}
+
+// NewLog opens the audit log and checkpoint file, replaying the log to find
+// the chain head. interval <= 0 disables checkpoints; a nil signer leaves
+// them unsigned.
+func NewLog(path, checkpointsPath string, interval int, signer ed25519.PrivateKey) (*Log, error) {
+	for _, p := range []string{path, checkpointsPath} {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create audit directory: %v", err)
+		}
+	}
+
+	l := &Log{head: genesisHash, signer: signer}
+	if interval > 0 {
+		l.interval = uint64(interval)
+	}
+
+	if err := l.replay(path); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %v", err)
+	}
+	l.file = file
+
+	checkpoints, err := os.OpenFile(checkpointsPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open audit checkpoint file: %v", err)
+	}
+	l.checkpointsFile = checkpoints
+
+	return l, nil
+}
+
+// replay continues the chain from the last readable record; damage earlier
+// in the file is left for Verify to report
+func (l *Log) replay(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open audit file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		l.seq = rec.Seq
+		l.head = rec.Hash
+	}
+	return scanner.Err()
+}
+
+// Append chains rec onto the log and writes it, followed by a checkpoint when one is due
+func (l *Log) Append(rec Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec.Seq = l.seq + 1
+	if rec.Timestamp.IsZero() {
+		rec.Timestamp = time.Now().UTC()
+	}
+	rec.PrevHash = l.head
+	rec.Hash = rec.ComputeHash()
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %v", err)
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %v", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit file: %v", err)
+	}
+
+	l.seq = rec.Seq
+	l.head = rec.Hash
+
+	if l.interval > 0 && rec.Seq%l.interval == 0 {
+		return l.checkpoint()
+	}
+	return nil
+}
+
+// Checkpoint writes the current chain head to the checkpoint file
+func (l *Log) Checkpoint() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.seq == 0 || l.seq == l.checkpointed {
+		return nil
+	}
+	return l.checkpoint()
+}
+
+func (l *Log) checkpoint() error {
+	cp := Checkpoint{Seq: l.seq, Hash: l.head, Timestamp: time.Now().UTC()}
+	if l.signer != nil {
+		cp.Sign(l.signer)
+	}
+
+	line, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit checkpoint: %v", err)
+	}
+	if _, err := l.checkpointsFile.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit checkpoint: %v", err)
+	}
+	l.checkpointed = l.seq
+	return l.checkpointsFile.Sync()
+}
+
+// Close checkpoints the chain head and closes both files
+func (l *Log) Close() {
+	l.Checkpoint()
+	if l.file != nil {
+		l.file.Close()
+	}
+	if l.checkpointsFile != nil {
+		l.checkpointsFile.Close()
+	}
+}
@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Checkpoints are signed with an Ed25519 key that is kept away from the log
+// files, normally behind a vault:// reference. Anyone who can rewrite the log
+// and its checkpoint file still cannot produce a checkpoint that verifies
+// against the public key given to auditverify.
+
+// checkpointMessage is the text a checkpoint signature covers
+func checkpointMessage(cp Checkpoint) []byte {
+	return []byte(fmt.Sprintf("b.env audit checkpoint\nseq: %d\nhash: %s\ntimestamp: %s",
+		cp.Seq, cp.Hash, cp.Timestamp.UTC().Format(time.RFC3339Nano)))
+}
+
+// Sign sets the checkpoint's signature
+func (cp *Checkpoint) Sign(key ed25519.PrivateKey) {
+	cp.Signature = hex.EncodeToString(ed25519.Sign(key, checkpointMessage(*cp)))
+}
+
+// VerifySignature reports whether the checkpoint was signed by the holder of
+// the private half of key
+func (cp Checkpoint) VerifySignature(key ed25519.PublicKey) bool {
+	sig, err := hex.DecodeString(cp.Signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(key, checkpointMessage(cp), sig)
+}
+
+// ParseSigningKey decodes a hex Ed25519 seed (32 bytes) or private key (64 bytes)
+func ParseSigningKey(s string) (ed25519.PrivateKey, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode audit signing key: %v", err)
+	}
+	switch len(data) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(data), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(data), nil
+	default:
+		return nil, fmt.Errorf("audit signing key must be %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(data))
+	}
+}
+
+// ParsePublicKey decodes a hex Ed25519 public key
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode audit public key: %v", err)
+	}
+	if len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("audit public key must be %d bytes, got %d", ed25519.PublicKeySize, len(data))
+	}
+	return ed25519.PublicKey(data), nil
+}
@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return public, private
+}
+
+// writeLog appends n records through a signed log and closes it
+func writeLog(t *testing.T, dir string, n int, signer ed25519.PrivateKey) (string, string) {
+	t.Helper()
+	path := filepath.Join(dir, "audit.jsonl")
+	checkpoints := filepath.Join(dir, "audit_checkpoints.jsonl")
+
+	log, err := NewLog(path, checkpoints, 2, signer)
+	if err != nil {
+		t.Fatalf("NewLog: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		if err := log.Append(Record{Address: "0xabc", Action: ActionCompletion, Outcome: OutcomeSuccess}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	log.Close()
+	return path, checkpoints
+}
+
+func TestSignedCheckpointsVerify(t *testing.T) {
+	public, private := newTestKey(t)
+	path, checkpoints := writeLog(t, t.TempDir(), 5, private)
+
+	report, err := Verify(path, checkpoints, public)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !report.OK() || report.Checkpoints != 3 {
+		t.Fatalf("got %d checkpoints and problems %v, want 3 and none", report.Checkpoints, report.Problems)
+	}
+}
+
+// TestRewrittenChainIsDetected rebuilds the log and its checkpoints from
+// scratch, as someone with write access to both files could, and expects the
+// forged checkpoints to fail against the real public key
+func TestRewrittenChainIsDetected(t *testing.T) {
+	public, _ := newTestKey(t)
+	_, forger := newTestKey(t)
+	path, checkpoints := writeLog(t, t.TempDir(), 4, forger)
+
+	report, err := Verify(path, checkpoints, public)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if report.OK() {
+		t.Fatal("forged checkpoints verified")
+	}
+	for _, p := range report.Problems {
+		if p.Reason != "checkpoint signature is invalid" {
+			t.Fatalf("unexpected problem: %s", p)
+		}
+	}
+}
+
+func TestUnsignedCheckpointsFailWithPublicKey(t *testing.T) {
+	public, _ := newTestKey(t)
+	path, checkpoints := writeLog(t, t.TempDir(), 2, nil)
+
+	if report, _ := Verify(path, checkpoints, nil); !report.OK() {
+		t.Fatalf("unsigned log without a public key: %v", report.Problems)
+	}
+	report, err := Verify(path, checkpoints, public)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if report.OK() || report.Problems[0].Reason != "checkpoint is not signed" {
+		t.Fatalf("got %v, want an unsigned checkpoint problem", report.Problems)
+	}
+}
+
+func TestEditedCheckpointFailsSignature(t *testing.T) {
+	public, private := newTestKey(t)
+	path, checkpoints := writeLog(t, t.TempDir(), 2, private)
+
+	data, err := os.ReadFile(checkpoints)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal([]byte(strings.SplitN(string(data), "\n", 2)[0]), &cp); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	cp.Hash = strings.Repeat("f", 64)
+	line, _ := json.Marshal(cp)
+	if err := os.WriteFile(checkpoints, append(line, '\n'), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	report, err := Verify(path, checkpoints, public)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if report.OK() || report.Problems[0].Reason != "checkpoint signature is invalid" {
+		t.Fatalf("got %v, want an invalid signature", report.Problems)
+	}
+}
+
+func TestDeletedCheckpointsAreReported(t *testing.T) {
+	public, private := newTestKey(t)
+	path, checkpoints := writeLog(t, t.TempDir(), 3, private)
+	if err := os.Remove(checkpoints); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	report, err := Verify(path, checkpoints, public)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if report.OK() {
+		t.Fatal("log without checkpoints verified against a public key")
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	public, private := newTestKey(t)
+
+	for _, encoded := range []string{hex.EncodeToString(private.Seed()), "0x" + hex.EncodeToString(private)} {
+		key, err := ParseSigningKey(encoded)
+		if err != nil {
+			t.Fatalf("ParseSigningKey(%d chars): %v", len(encoded), err)
+		}
+		if !key.Equal(private) {
+			t.Fatal("parsed signing key differs")
+		}
+	}
+	if _, err := ParseSigningKey("abcd"); err == nil {
+		t.Fatal("short signing key accepted")
+	}
+
+	key, err := ParsePublicKey(hex.EncodeToString(public))
+	if err != nil || !key.Equal(public) {
+		t.Fatalf("ParsePublicKey: %v", err)
+	}
+	if _, err := ParsePublicKey("zz"); err == nil {
+		t.Fatal("non-hex public key accepted")
+	}
+}
@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Problem describes one integrity failure found by Verify
+type Problem struct {
+	Line   int    // 1-based line in the audit log, 0 for checkpoint problems
+	Seq    uint64 // sequence number involved, if known
+	Reason string
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("checkpoint seq %d: %s", p.Seq, p.Reason)
+	}
+	return fmt.Sprintf("line %d (seq %d): %s", p.Line, p.Seq, p.Reason)
+}
+
+// Report summarizes a verification run
+type Report struct {
+	Records     int
+	Checkpoints int
+	Head        string
+	Problems    []Problem
+}
+
+// OK reports whether the log verified cleanly
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify walks the audit log and checks that sequence numbers have no gaps,
+// every hash recomputes and links to its predecessor, and every checkpoint
+// matches the record at its sequence number. checkpointsPath may be empty.
+// With a public key, every checkpoint must also carry a valid signature;
+// without one, checkpoints only catch truncation, not a rewritten chain.
+func Verify(path, checkpointsPath string, publicKey ed25519.PublicKey) (*Report, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %v", err)
+	}
+	defer file.Close()
+
+	report := &Report{Head: genesisHash}
+	hashes := make(map[uint64]string)
+
+	var expectedSeq uint64 = 1
+	prevHash := genesisHash
+	line := 0
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line++
+
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			report.Problems = append(report.Problems, Problem{Line: line, Seq: expectedSeq, Reason: "unreadable record"})
+			continue
+		}
+		report.Records++
+
+		if rec.Seq != expectedSeq {
+			report.Problems = append(report.Problems, Problem{
+				Line:   line,
+				Seq:    rec.Seq,
+				Reason: fmt.Sprintf("sequence gap: expected %d", expectedSeq),
+			})
+		}
+		if rec.PrevHash != prevHash {
+			report.Problems = append(report.Problems, Problem{Line: line, Seq: rec.Seq, Reason: "previous hash does not match the chain"})
+		}
+		if rec.ComputeHash() != rec.Hash {
+			report.Problems = append(report.Problems, Problem{Line: line, Seq: rec.Seq, Reason: "record hash does not match its contents"})
+		}
+
+		hashes[rec.Seq] = rec.Hash
+		expectedSeq = rec.Seq + 1
+		prevHash = rec.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit file: %v", err)
+	}
+	report.Head = prevHash
+
+	if checkpointsPath == "" {
+		return report, nil
+	}
+	if err := verifyCheckpoints(checkpointsPath, hashes, publicKey, report); err != nil {
+		return nil, err
+	}
+	// A deleted checkpoint file would otherwise leave nothing to check against
+	if publicKey != nil && report.Records > 0 && report.Checkpoints == 0 {
+		report.Problems = append(report.Problems, Problem{Reason: "no signed checkpoints found"})
+	}
+	return report, nil
+}
+
+func verifyCheckpoints(path string, hashes map[uint64]string, publicKey ed25519.PublicKey, report *Report) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open audit checkpoint file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var cp Checkpoint
+		if err := json.Unmarshal(scanner.Bytes(), &cp); err != nil {
+			report.Problems = append(report.Problems, Problem{Reason: "unreadable checkpoint"})
+			continue
+		}
+		report.Checkpoints++
+
+		if publicKey != nil {
+			if cp.Signature == "" {
+				report.Problems = append(report.Problems, Problem{Seq: cp.Seq, Reason: "checkpoint is not signed"})
+				continue
+			}
+			if !cp.VerifySignature(publicKey) {
+				report.Problems = append(report.Problems, Problem{Seq: cp.Seq, Reason: "checkpoint signature is invalid"})
+				continue
+			}
+		}
+
+		hash, ok := hashes[cp.Seq]
+		switch {
+		case !ok:
+			report.Problems = append(report.Problems, Problem{Seq: cp.Seq, Reason: "record missing from the log; it may have been truncated"})
+		case hash != cp.Hash:
+			report.Problems = append(report.Problems, Problem{Seq: cp.Seq, Reason: "record hash differs from the checkpoint"})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit checkpoint file: %v", err)
+	}
+	return nil
+}
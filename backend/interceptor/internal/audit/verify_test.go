@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// readRecords returns the log's lines as records
+func readRecords(t *testing.T, path string) []Record {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	var records []Record
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var rec Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+// writeRecords replaces the log with records as given
+func writeRecords(t *testing.T, path string, records []Record) {
+	t.Helper()
+	var b strings.Builder
+	for _, rec := range records {
+		line, _ := json.Marshal(rec)
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestVerifyCleanChain(t *testing.T) {
+	path, checkpoints := writeLog(t, t.TempDir(), 5, nil)
+
+	report, err := Verify(path, checkpoints, nil)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !report.OK() || report.Records != 5 {
+		t.Fatalf("got %d records and problems %v", report.Records, report.Problems)
+	}
+	if records := readRecords(t, path); report.Head != records[4].Hash || records[0].PrevHash != genesisHash {
+		t.Fatal("chain head or genesis link is wrong")
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func([]Record) []Record
+		want   string
+	}{
+		{"edited field", func(r []Record) []Record {
+			r[1].Outcome = OutcomeDenied
+			return r
+		}, "record hash does not match its contents"},
+		{"removed record", func(r []Record) []Record {
+			return append(r[:2], r[3:]...)
+		}, "sequence gap: expected 3"},
+		{"rehashed edit", func(r []Record) []Record {
+			// Recomputing the edited record's hash still breaks the next link
+			r[1].Model = "gpt-4o"
+			r[1].Hash = r[1].ComputeHash()
+			return r
+		}, "previous hash does not match the chain"},
+		{"reordered", func(r []Record) []Record {
+			r[1], r[2] = r[2], r[1]
+			return r
+		}, "sequence gap"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, _ := writeLog(t, t.TempDir(), 4, nil)
+			writeRecords(t, path, tt.tamper(readRecords(t, path)))
+
+			report, err := Verify(path, "", nil)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			found := false
+			for _, p := range report.Problems {
+				found = found || strings.Contains(p.Reason, tt.want)
+			}
+			if !found {
+				t.Fatalf("problems %v do not mention %q", report.Problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyDetectsTruncation(t *testing.T) {
+	path, checkpoints := writeLog(t, t.TempDir(), 4, nil)
+	writeRecords(t, path, readRecords(t, path)[:3])
+
+	report, err := Verify(path, checkpoints, nil)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if report.OK() || !strings.Contains(report.Problems[0].Reason, "truncated") {
+		t.Fatalf("got %v, want a truncation problem", report.Problems)
+	}
+}
+
+func TestLogContinuesChainAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	writeLog(t, dir, 2, nil)
+	path, checkpoints := writeLog(t, dir, 2, nil)
+
+	report, err := Verify(path, checkpoints, nil)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !report.OK() || report.Records != 4 {
+		t.Fatalf("got %d records and problems %v", report.Records, report.Problems)
+	}
+}
@@ -0,0 +1,72 @@
+package chat
+
+import "time"
+
+// Frame types sent by the client. The first frame of a connection must be
+// auth; chat starts a turn and cancel stops one, both by conversation.
+const (
+	FrameAuth   = "auth"
+	FrameChat   = "chat"
+	FrameCancel = "cancel"
+)
+
+// Frame types sent by the server. A turn streams delta frames and ends with
+// exactly one done, canceled or error frame.
+const (
+	FrameReady    = "ready"
+	FrameDelta    = "delta"
+	FrameDone     = "done"
+	FrameCanceled = "canceled"
+	FrameError    = "error"
+)
+
+// Turn is one message on a conversation, with the options of the completion
+// endpoint. A conversation runs one turn at a time.
+type Turn struct {
+	ConversationID string   `json:"conversation_id"`
+	Message        string   `json:"message"`
+	Model          string   `json:"model,omitempty"`
+	Owner          string   `json:"owner,omitempty"`
+	KeyName        string   `json:"key_name,omitempty"`
+	System         string   `json:"system,omitempty"`
+	Temperature    *float64 `json:"temperature,omitempty"`
+	MaxTokens      int      `json:"max_tokens,omitempty"`
+}
+
+// ClientFrame is a frame from the client; Token is set on auth, the turn's
+// fields on chat and its conversation ID on cancel
+type ClientFrame struct {
+	Type  string `json:"type"`
+	Token string `json:"token,omitempty"`
+	Turn
+}
+
+// Frame is a frame from the server
+type Frame struct {
+	Type           string `json:"type"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	// Content is a piece of the reply on delta frames
+	Content string `json:"content,omitempty"`
+	// Address and ExpiresAt describe the session on the ready frame
+	Address   string     `json:"address,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Route and token counts describe the finished turn on done frames
+	Route            string `json:"route,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int    `json:"completion_tokens,omitempty"`
+	Truncated        bool   `json:"truncated,omitempty"`
+	Error            *Error `json:"error,omitempty"`
+}
+
+// Error explains an error frame. Types are stable for clients to switch on.
+type Error struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	// RetryAfter is in whole seconds
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// Failure returns an error frame
+func Failure(kind, message string) Frame {
+	return Frame{Type: FrameError, Error: &Error{Type: kind, Message: message}}
+}
@@ -0,0 +1,360 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interceptor/internal/metrics"
+	"interceptor/internal/middleware"
+	"interceptor/internal/sessions"
+	"interceptor/pkg/logger"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+)
+
+// writeTimeout bounds each frame written to a client
+const writeTimeout = 10 * time.Second
+
+// ErrCanceled is the cancellation cause of a turn the client canceled
+var ErrCanceled = errors.New("turn canceled by client")
+
+// TurnFunc serves one turn for address, passing each piece of the reply to
+// delta as it arrives. It returns the done, canceled or error frame that ends
+// the turn. ctx ends when the client cancels the turn or goes away.
+type TurnFunc func(ctx context.Context, address string, turn Turn, delta func(string)) Frame
+
+// Options tune connections
+type Options struct {
+	// AuthTimeout bounds the wait for the auth frame
+	AuthTimeout time.Duration
+	// PingInterval is how often clients are pinged; one silent for two
+	// intervals is disconnected
+	PingInterval time.Duration
+	// MaxTurns bounds the turns running at once on a connection
+	MaxTurns int
+	// TurnTimeout bounds each turn
+	TurnTimeout time.Duration
+	// MaxFrameSize bounds a client frame, in bytes
+	MaxFrameSize int64
+}
+
+// Hub serves chat connections: it authenticates each with a session token,
+// runs its turns side by side and closes every connection at shutdown.
+type Hub struct {
+	sessions *sessions.Issuer
+	serve    TurnFunc
+	opts     Options
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	closing bool
+	running sync.WaitGroup
+}
+
+// NewHub returns a hub that checks tokens with issuer and serves turns with serve
+func NewHub(issuer *sessions.Issuer, serve TurnFunc, opts Options) *Hub {
+	return &Hub{
+		sessions: issuer,
+		serve:    serve,
+		opts:     opts,
+		clients:  make(map[*client]struct{}),
+	}
+}
+
+// Serve runs a connection until the client leaves or the hub closes. log and
+// correlationID come from the upgrade request.
+func (h *Hub) Serve(conn *websocket.Conn, log *logger.CustomLogger, correlationID string) {
+	ctx, cancel := context.WithCancel(middleware.WithCorrelationID(context.Background(), correlationID))
+	c := &client{
+		hub:    h,
+		conn:   conn,
+		log:    log,
+		ctx:    ctx,
+		cancel: cancel,
+		turns:  make(map[string]context.CancelCauseFunc),
+	}
+	defer c.conn.Close()
+	defer cancel()
+	// The connection goes back to a pool once Serve returns, so a close from
+	// Hub.Close must be over by then
+	defer func() {
+		c.closeMu.Lock()
+		c.closed = true
+		c.closeMu.Unlock()
+	}()
+
+	if !h.add(c) {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+	defer h.remove(c)
+
+	metrics.ChatConnections.Inc()
+	defer metrics.ChatConnections.Dec()
+
+	conn.SetReadLimit(h.opts.MaxFrameSize)
+	if err := c.authenticate(); err != nil {
+		c.log.Infow("chat connection rejected", "error", err)
+		c.close(websocket.ClosePolicyViolation, "unauthorized")
+		return
+	}
+
+	c.log = c.log.With("address", c.address)
+	c.log.Infow("chat connection opened", "expires_at", c.expiresAt)
+	c.run()
+	c.log.Infow("chat connection closed")
+}
+
+// Close ends every connection, canceling its running turns, and waits until
+// all have finished or ctx is done
+func (h *Hub) Close(ctx context.Context) error {
+	h.mu.Lock()
+	h.closing = true
+	clients := make([]*client, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("chat connections still open: %v", ctx.Err())
+	}
+}
+
+func (h *Hub) add(c *client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return false
+	}
+	h.clients[c] = struct{}{}
+	h.running.Add(1)
+	return true
+}
+
+func (h *Hub) remove(c *client) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+	h.running.Done()
+}
+
+// client is one connection and the turns running on it
+type client struct {
+	hub  *Hub
+	conn *websocket.Conn
+	log  *logger.CustomLogger
+
+	address   string
+	expiresAt time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	writeMu sync.Mutex
+
+	closeMu sync.Mutex
+	closed  bool
+
+	turnsMu sync.Mutex
+	turns   map[string]context.CancelCauseFunc
+	running sync.WaitGroup
+}
+
+// authenticate reads the auth frame and checks its session token
+func (c *client) authenticate() error {
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.opts.AuthTimeout))
+
+	var frame ClientFrame
+	if err := c.conn.ReadJSON(&frame); err != nil {
+		return fmt.Errorf("failed to read auth frame: %v", err)
+	}
+	if frame.Type != FrameAuth {
+		c.send(Failure("unauthorized", "The first frame must be an auth frame"))
+		return fmt.Errorf("first frame was %q", frame.Type)
+	}
+
+	session, err := c.hub.sessions.Verify(frame.Token)
+	if err != nil {
+		c.send(Failure("unauthorized", err.Error()))
+		return err
+	}
+	c.address = session.Address
+	c.expiresAt = session.ExpiresAt
+
+	return c.send(Frame{Type: FrameReady, Address: c.address, ExpiresAt: &c.expiresAt})
+}
+
+// run reads frames until the connection ends, then cancels the turns still
+// running and waits for them
+func (c *client) run() {
+	idle := 2 * c.hub.opts.PingInterval
+	c.conn.SetReadDeadline(time.Now().Add(idle))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(idle))
+	})
+
+	c.running.Add(1)
+	go c.ping()
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && c.ctx.Err() == nil {
+				c.log.Infow("chat connection lost", "error", err)
+			}
+			break
+		}
+		c.conn.SetReadDeadline(time.Now().Add(idle))
+
+		var frame ClientFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			c.send(Failure("invalid_frame", "Frame is not valid JSON"))
+			continue
+		}
+		switch frame.Type {
+		case FrameChat:
+			c.start(frame.Turn)
+		case FrameCancel:
+			c.stop(frame.ConversationID)
+		default:
+			c.send(Failure("invalid_frame", fmt.Sprintf("Unknown frame type %q", frame.Type)))
+		}
+	}
+
+	c.cancel()
+	c.running.Wait()
+}
+
+// start runs a turn in the background, unless its conversation is busy or
+// the connection has no room for another
+func (c *client) start(turn Turn) {
+	id := turn.ConversationID
+	if id == "" || turn.Message == "" {
+		c.send(Failure("invalid_request", "conversation_id and message are required"))
+		return
+	}
+	if time.Now().After(c.expiresAt) {
+		c.send(Failure("session_expired", sessions.ErrExpired.Error()))
+		c.close(websocket.ClosePolicyViolation, "session expired")
+		return
+	}
+
+	c.turnsMu.Lock()
+	if _, busy := c.turns[id]; busy {
+		c.turnsMu.Unlock()
+		frame := Failure("conversation_busy", "A turn is already running on this conversation")
+		frame.ConversationID = id
+		c.send(frame)
+		return
+	}
+	if len(c.turns) >= c.hub.opts.MaxTurns {
+		c.turnsMu.Unlock()
+		frame := Failure("too_many_turns", fmt.Sprintf("At most %d turns may run at once", c.hub.opts.MaxTurns))
+		frame.ConversationID = id
+		c.send(frame)
+		return
+	}
+	ctx, cancel := context.WithCancelCause(c.ctx)
+	c.turns[id] = cancel
+	c.running.Add(1)
+	c.turnsMu.Unlock()
+
+	go func() {
+		defer c.running.Done()
+		ctx, cancelTimeout := context.WithTimeout(ctx, c.hub.opts.TurnTimeout)
+		defer cancelTimeout()
+
+		frame := c.hub.serve(ctx, c.address, turn, func(delta string) {
+			c.send(Frame{Type: FrameDelta, ConversationID: id, Content: delta})
+		})
+
+		// The conversation is free again before the client hears the turn ended
+		c.turnsMu.Lock()
+		delete(c.turns, id)
+		c.turnsMu.Unlock()
+		cancel(nil)
+
+		metrics.ChatTurns.WithLabelValues(frame.Type).Inc()
+		frame.ConversationID = id
+		c.send(frame)
+	}()
+}
+
+// stop cancels the turn running on a conversation
+func (c *client) stop(id string) {
+	c.turnsMu.Lock()
+	cancel, ok := c.turns[id]
+	c.turnsMu.Unlock()
+
+	if !ok {
+		frame := Failure("no_turn", "No turn is running on this conversation")
+		frame.ConversationID = id
+		c.send(frame)
+		return
+	}
+	cancel(ErrCanceled)
+}
+
+// ping keeps the connection alive until it ends; the pong handler extends
+// the read deadline
+func (c *client) ping() {
+	defer c.running.Done()
+	ticker := time.NewTicker(c.hub.opts.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// send writes one frame; frames from different turns interleave whole
+func (c *client) send(frame Frame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := c.conn.WriteJSON(frame); err != nil {
+		c.log.Debugw("failed to write chat frame", "type", frame.Type, "error", err)
+		return err
+	}
+	return nil
+}
+
+// close cancels the connection's turns and sends a close frame with code.
+// Closing a hijacked connection waits for Serve to return, so the read loop
+// is ended by expiring its deadline instead.
+func (c *client) close(code int, reason string) {
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+	if c.closed {
+		return
+	}
+
+	c.cancel()
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeTimeout))
+	c.conn.SetReadDeadline(time.Now())
+}
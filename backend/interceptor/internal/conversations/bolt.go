@@ -0,0 +1,283 @@
+package conversations
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of the conversation database. Turns and the owner index hold one
+// nested bucket per conversation and per owner.
+var (
+	conversationsBucket = []byte("conversations")
+	turnsBucket         = []byte("turns")
+	ownersBucket        = []byte("owners")
+)
+
+// BoltStore keeps conversations in an embedded bbolt database
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens or creates the database at path
+func NewBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create conversations directory: %v", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open conversations database: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{conversationsBucket, turnsBucket, ownersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize conversations database: %v", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Create stores a new conversation with no turns
+func (s *BoltStore) Create(conv *Conversation) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(conversationsBucket).Get([]byte(conv.ID)) != nil {
+			return fmt.Errorf("conversation %s already exists", conv.ID)
+		}
+		return s.create(tx, conv)
+	})
+}
+
+// Get returns the conversation with the given ID
+func (s *BoltStore) Get(id string) (*Conversation, error) {
+	var conv *Conversation
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		conv, err = getConversation(tx, id)
+		return err
+	})
+	return conv, err
+}
+
+// ListByOwner returns the owner's conversations, most recently updated first
+func (s *BoltStore) ListByOwner(owner string) ([]*Conversation, error) {
+	result := make([]*Conversation, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(ownersBucket).Bucket([]byte(owner))
+		if index == nil {
+			return nil
+		}
+		return index.ForEach(func(id, _ []byte) error {
+			conv, err := getConversation(tx, string(id))
+			if err != nil {
+				return err
+			}
+			result = append(result, conv)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].UpdatedAt.After(result[j].UpdatedAt)
+	})
+	return result, nil
+}
+
+// Turns returns the turns of a conversation in order
+func (s *BoltStore) Turns(id string) ([]Turn, error) {
+	turns := make([]Turn, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(turnsBucket).Bucket([]byte(id))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		return bucket.ForEach(func(_, data []byte) error {
+			var turn Turn
+			if err := json.Unmarshal(data, &turn); err != nil {
+				return fmt.Errorf("failed to parse turn: %v", err)
+			}
+			turns = append(turns, turn)
+			return nil
+		})
+	})
+	return turns, err
+}
+
+// Append adds turns to the end of a conversation
+func (s *BoltStore) Append(id string, turns ...Turn) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		conv, err := getConversation(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := appendTurns(tx.Bucket(turnsBucket).Bucket([]byte(id)), turns); err != nil {
+			return err
+		}
+		conv.TurnCount += len(turns)
+		conv.UpdatedAt = time.Now().UTC()
+		return putConversation(tx, conv)
+	})
+}
+
+// SetSummary records a summary of the first through turns
+func (s *BoltStore) SetSummary(id, summary string, through int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		conv, err := getConversation(tx, id)
+		if err != nil {
+			return err
+		}
+		conv.Summary = summary
+		conv.SummarizedThrough = through
+		return putConversation(tx, conv)
+	})
+}
+
+// Fork copies the first through turns of id, with its settings and any
+// summary they cover, into a new conversation for the same owner
+func (s *BoltStore) Fork(id string, through int) (*Conversation, error) {
+	var fork *Conversation
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		parent, err := getConversation(tx, id)
+		if err != nil {
+			return err
+		}
+		if through < 0 || through > parent.TurnCount {
+			return fmt.Errorf("conversation %s has %d turns, cannot fork at %d", id, parent.TurnCount, through)
+		}
+
+		now := time.Now().UTC()
+		fork = &Conversation{
+			ID:        NewID(),
+			Owner:     parent.Owner,
+			Title:     parent.Title,
+			Model:     parent.Model,
+			System:    parent.System,
+			ParentID:  parent.ID,
+			ForkedAt:  through,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if parent.SummarizedThrough <= through {
+			fork.Summary = parent.Summary
+			fork.SummarizedThrough = parent.SummarizedThrough
+		}
+		if err := s.create(tx, fork); err != nil {
+			return err
+		}
+
+		source := tx.Bucket(turnsBucket).Bucket([]byte(parent.ID))
+		target := tx.Bucket(turnsBucket).Bucket([]byte(fork.ID))
+		cursor := source.Cursor()
+		for k, v := cursor.First(); k != nil && fork.TurnCount < through; k, v = cursor.Next() {
+			if err := target.Put(k, v); err != nil {
+				return err
+			}
+			fork.TurnCount++
+		}
+		if err := target.SetSequence(source.Sequence()); err != nil {
+			return err
+		}
+		return putConversation(tx, fork)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fork, nil
+}
+
+// Delete removes a conversation and its turns
+func (s *BoltStore) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		conv, err := getConversation(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(conversationsBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(turnsBucket).DeleteBucket([]byte(id)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		if index := tx.Bucket(ownersBucket).Bucket([]byte(conv.Owner)); index != nil {
+			return index.Delete([]byte(id))
+		}
+		return nil
+	})
+}
+
+// Close closes the database
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// create writes a new conversation with its turn bucket and index entry
+func (s *BoltStore) create(tx *bolt.Tx, conv *Conversation) error {
+	if _, err := tx.Bucket(turnsBucket).CreateBucket([]byte(conv.ID)); err != nil {
+		return fmt.Errorf("failed to create turns for %s: %v", conv.ID, err)
+	}
+	index, err := tx.Bucket(ownersBucket).CreateBucketIfNotExists([]byte(conv.Owner))
+	if err != nil {
+		return err
+	}
+	if err := index.Put([]byte(conv.ID), nil); err != nil {
+		return err
+	}
+	return putConversation(tx, conv)
+}
+
+func getConversation(tx *bolt.Tx, id string) (*Conversation, error) {
+	data := tx.Bucket(conversationsBucket).Get([]byte(id))
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	var conv Conversation
+	if err := json.Unmarshal(data, &conv); err != nil {
+		return nil, fmt.Errorf("failed to parse conversation %s: %v", id, err)
+	}
+	return &conv, nil
+}
+
+func putConversation(tx *bolt.Tx, conv *Conversation) error {
+	data, err := json.Marshal(conv)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation: %v", err)
+	}
+	return tx.Bucket(conversationsBucket).Put([]byte(conv.ID), data)
+}
+
+// appendTurns stores turns under big-endian sequence keys so they iterate in order
+func appendTurns(bucket *bolt.Bucket, turns []Turn) error {
+	for _, turn := range turns {
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(turn)
+		if err != nil {
+			return fmt.Errorf("failed to marshal turn: %v", err)
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		if err := bucket.Put(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
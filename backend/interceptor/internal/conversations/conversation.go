@@ -0,0 +1,76 @@
+package conversations
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Roles of a turn
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Conversation is a chat owned by one wallet address. Its turns are stored
+// separately and appended as the chat goes on.
+type Conversation struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+	Title string `json:"title,omitempty"`
+	// Model and System are used for turns that do not set their own
+	Model  string `json:"model,omitempty"`
+	System string `json:"system,omitempty"`
+	// ParentID and ForkedAt name the conversation and turn count this one was forked from
+	ParentID string `json:"parent_id,omitempty"`
+	ForkedAt int    `json:"forked_at,omitempty"`
+	// Summary condenses the first SummarizedThrough turns for the summarize strategy
+	Summary           string    `json:"summary,omitempty"`
+	SummarizedThrough int       `json:"summarized_through,omitempty"`
+	TurnCount         int       `json:"turn_count"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Turn is one message of a conversation
+type Turn struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// Route is the provider/model that produced an assistant turn
+	Route     string    `json:"route,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store persists conversations and their turns
+type Store interface {
+	Create(conv *Conversation) error
+	Get(id string) (*Conversation, error)
+	ListByOwner(owner string) ([]*Conversation, error)
+	// Turns returns the turns of a conversation in order
+	Turns(id string) ([]Turn, error)
+	Append(id string, turns ...Turn) error
+	SetSummary(id, summary string, through int) error
+	// Fork copies the first through turns of id into a new conversation
+	Fork(id string, through int) (*Conversation, error)
+	Delete(id string) error
+	Close() error
+}
+
+// ErrNotFound is returned when a conversation ID is unknown
+var ErrNotFound = fmt.Errorf("conversation not found")
+
+// NewID returns a random conversation ID
+func NewID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Normalize lowercases the owner so lookups are case-insensitive
+func (c *Conversation) Normalize() {
+	c.Owner = strings.ToLower(strings.TrimSpace(c.Owner))
+	c.Title = strings.TrimSpace(c.Title)
+	c.Model = strings.TrimSpace(c.Model)
+}
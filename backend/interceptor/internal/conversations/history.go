@@ -0,0 +1,71 @@
+package conversations
+
+import (
+	"interceptor/internal/tokenizer"
+	"strings"
+)
+
+// Strategies for history that does not fit the model's budget. Truncate
+// leaves out the oldest turns; summarize condenses them into a summary that
+// is sent in their place.
+const (
+	StrategyTruncate  = "truncate"
+	StrategySummarize = "summarize"
+)
+
+// SummaryInstruction is the system prompt of the call that condenses turns
+const SummaryInstruction = "Condense the conversation below into a brief summary that keeps the facts, decisions and open questions a reader needs to continue it. Reply with the summary only."
+
+// Messages converts turns into chat messages
+func Messages(turns []Turn) []tokenizer.Message {
+	messages := make([]tokenizer.Message, len(turns))
+	for i, turn := range turns {
+		messages[i] = tokenizer.Message{Role: turn.Role, Content: turn.Content}
+	}
+	return messages
+}
+
+// SummaryMessage wraps a summary as the system message sent before the
+// turns it does not cover
+func SummaryMessage(summary string) tokenizer.Message {
+	return tokenizer.Message{Role: "system", Content: "Summary of the earlier conversation:\n" + summary}
+}
+
+// Window returns the index of the first turn to send: the oldest turn at or
+// after from such that it and every later turn fit budget together with head
+// and next. History always opens on a user turn, as some providers require;
+// it returns len(turns) when none fit.
+func Window(counter tokenizer.Counter, head []tokenizer.Message, turns []Turn, from int, next tokenizer.Message, budget int) int {
+	used := tokenizer.CountMessages(counter, append(append([]tokenizer.Message{}, head...), next))
+	start := len(turns)
+	for start > from {
+		cost := tokenizer.CountMessage(counter, tokenizer.Message{Role: turns[start-1].Role, Content: turns[start-1].Content})
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		start--
+	}
+	for start < len(turns) && turns[start].Role != RoleUser {
+		start++
+	}
+	return start
+}
+
+// Transcript renders a previous summary and the turns after it as the input
+// of a summary call
+func Transcript(previous string, turns []Turn) string {
+	var b strings.Builder
+	if previous != "" {
+		b.WriteString("Earlier summary:\n")
+		b.WriteString(previous)
+		b.WriteString("\n\n")
+	}
+	for _, turn := range turns {
+		b.WriteString(turn.Role)
+		b.WriteString(": ")
+		b.WriteString(turn.Content)
+		b.WriteString("\n\n")
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,108 @@
+package grants
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"interceptor/internal/wallet"
+	"strings"
+	"time"
+)
+
+// Grant lets a grantee wallet use the API key stored for an owner wallet
+type Grant struct {
+	ID        string     `json:"id"`
+	Owner     string     `json:"owner"`
+	Grantee   string     `json:"grantee"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	Models    []string   `json:"models"`
+	SpendCap  float64    `json:"spend_cap"`
+	Nonce     string     `json:"nonce"`
+	Signature string     `json:"signature"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Normalize lowercases addresses and model names so lookups are case-insensitive
+func (g *Grant) Normalize() {
+	g.Owner = strings.ToLower(strings.TrimSpace(g.Owner))
+	g.Grantee = strings.ToLower(strings.TrimSpace(g.Grantee))
+	for i, model := range g.Models {
+		g.Models[i] = strings.ToLower(strings.TrimSpace(model))
+	}
+	g.ExpiresAt = g.ExpiresAt.UTC()
+}
+
+// Message returns the canonical text the owner signs to issue the grant
+func (g *Grant) Message() string {
+	models := "*"
+	if len(g.Models) > 0 {
+		models = strings.Join(g.Models, ",")
+	}
+
+	return fmt.Sprintf("b.env access grant\nowner: %s\ngrantee: %s\nexpires: %s\nmodels: %s\nspend cap: %.2f\nnonce: %s",
+		g.Owner,
+		g.Grantee,
+		g.ExpiresAt.Format(time.RFC3339),
+		models,
+		g.SpendCap,
+		g.Nonce,
+	)
+}
+
+// RevokeMessage returns the canonical text the owner signs to revoke the grant
+func (g *Grant) RevokeMessage() string {
+	return fmt.Sprintf("b.env revoke grant\nid: %s", g.ID)
+}
+
+// ComputeID derives a stable grant ID from the signed message
+func (g *Grant) ComputeID() string {
+	sum := sha256.Sum256([]byte(g.Message()))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Validate checks that the grant has all required fields
+func (g *Grant) Validate() error {
+	if !wallet.IsAddress(g.Owner) {
+		return fmt.Errorf("owner must be a 0x-prefixed 20-byte address")
+	}
+	if !wallet.IsAddress(g.Grantee) {
+		return fmt.Errorf("grantee must be a 0x-prefixed 20-byte address")
+	}
+	if g.Owner == g.Grantee {
+		return fmt.Errorf("owner and grantee must differ")
+	}
+	if g.ExpiresAt.IsZero() {
+		return fmt.Errorf("expires_at is required")
+	}
+	if g.SpendCap < 0 {
+		return fmt.Errorf("spend_cap cannot be negative")
+	}
+	if g.Nonce == "" {
+		return fmt.Errorf("nonce is required")
+	}
+	if g.Signature == "" {
+		return fmt.Errorf("signature is required")
+	}
+	return nil
+}
+
+// Active reports whether the grant is usable at the given time
+func (g *Grant) Active(now time.Time) bool {
+	return g.RevokedAt == nil && now.Before(g.ExpiresAt)
+}
+
+// AllowsModel reports whether the grant covers the given model.
+// An empty allowlist covers every model.
+func (g *Grant) AllowsModel(model string) bool {
+	if len(g.Models) == 0 {
+		return true
+	}
+	model = strings.ToLower(model)
+	for _, allowed := range g.Models {
+		if allowed == "*" || allowed == model {
+			return true
+		}
+	}
+	return false
+}
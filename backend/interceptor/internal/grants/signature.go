@@ -0,0 +1,13 @@
+package grants
+
+import "interceptor/internal/wallet"
+
+// VerifySignature checks that the grant was signed by its owner
+func VerifySignature(g *Grant) error {
+	return wallet.VerifySigner(g.Message(), g.Signature, g.Owner)
+}
+
+// VerifyRevocation checks that a revocation signature was produced by the grant owner
+func VerifyRevocation(g *Grant, signature string) error {
+	return wallet.VerifySigner(g.RevokeMessage(), signature, g.Owner)
+}
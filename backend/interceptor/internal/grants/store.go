@@ -0,0 +1,174 @@
+package grants
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store persists grants and answers lookups by owner and grantee
+type Store interface {
+	Put(grant *Grant) error
+	Get(id string) (*Grant, error)
+	ListByOwner(owner string) ([]*Grant, error)
+	ListByGrantee(grantee string) ([]*Grant, error)
+	Revoke(id string, at time.Time) error
+}
+
+// ErrNotFound is returned when a grant ID is unknown
+var ErrNotFound = fmt.Errorf("grant not found")
+
+// FileStore keeps grants in memory and writes them to a JSON file on every change
+type FileStore struct {
+	mu     sync.RWMutex
+	path   string
+	grants map[string]*Grant
+}
+
+// NewFileStore loads grants from path, creating the file on first write
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path:   path,
+		grants: make(map[string]*Grant),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read grants file: %v", err)
+	}
+
+	var list []*Grant
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse grants file: %v", err)
+	}
+	for _, g := range list {
+		s.grants[g.ID] = g
+	}
+
+	return s, nil
+}
+
+// Put stores a new grant
+func (s *FileStore) Put(grant *Grant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.grants[grant.ID]; exists {
+		return fmt.Errorf("grant %s already exists", grant.ID)
+	}
+	s.grants[grant.ID] = grant
+
+	// A grant that did not reach the file must not be usable either
+	if err := s.save(); err != nil {
+		delete(s.grants, grant.ID)
+		return err
+	}
+	return nil
+}
+
+// Get returns a copy of the grant with the given ID
+func (s *FileStore) Get(id string) (*Grant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	g, ok := s.grants[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *g
+	return &copied, nil
+}
+
+// ListByOwner returns every grant issued by owner, newest first
+func (s *FileStore) ListByOwner(owner string) ([]*Grant, error) {
+	return s.list(func(g *Grant) bool { return g.Owner == owner }), nil
+}
+
+// ListByGrantee returns every grant issued to grantee, newest first
+func (s *FileStore) ListByGrantee(grantee string) ([]*Grant, error) {
+	return s.list(func(g *Grant) bool { return g.Grantee == grantee }), nil
+}
+
+// Revoke marks a grant as revoked from the given time
+func (s *FileStore) Revoke(id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.grants[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if g.RevokedAt != nil {
+		return nil
+	}
+	revokedAt := at.UTC()
+	g.RevokedAt = &revokedAt
+
+	if err := s.save(); err != nil {
+		g.RevokedAt = nil
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) list(match func(*Grant) bool) []*Grant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*Grant, 0)
+	for _, g := range s.grants {
+		if match(g) {
+			copied := *g
+			result = append(result, &copied)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result
+}
+
+// save writes all grants to disk; callers must hold the write lock
+func (s *FileStore) save() error {
+	list := make([]*Grant, 0, len(s.grants))
+	for _, g := range s.grants {
+		list = append(list, g)
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal grants: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create grants directory: %v", err)
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated store
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write grants file: %v", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// FindActive returns the active grant from owner to grantee, if any
+func FindActive(store Store, owner, grantee string, now time.Time) (*Grant, error) {
+	list, err := store.ListByGrantee(grantee)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range list {
+		if g.Owner == owner && g.Active(now) {
+			return g, nil
+		}
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"interceptor/internal/audit"
+	"interceptor/pkg/logger"
+)
+
+var globalAudit *audit.Log
+
+// InitializeAudit sets the audit log that key use and LLM calls are recorded in
+func InitializeAudit(log *audit.Log) {
+	globalAudit = log
+}
+
+// recordAudit appends rec to the audit log; a failed write is logged but
+// does not fail the request that produced it
+func recordAudit(log *logger.CustomLogger, rec audit.Record) {
+	if globalAudit == nil {
+		return
+	}
+	if err := globalAudit.Append(rec); err != nil {
+		log.Errorw("failed to write audit record", "action", rec.Action, "error", err)
+	}
+}
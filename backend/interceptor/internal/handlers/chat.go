@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"interceptor/internal/audit"
+	"interceptor/internal/chat"
+	"interceptor/internal/conversations"
+	"interceptor/internal/keyring"
+	"interceptor/internal/metrics"
+	"interceptor/internal/middleware"
+	"interceptor/internal/policy"
+	"interceptor/internal/providers"
+	"interceptor/internal/tokenizer"
+	"interceptor/internal/usage"
+	"interceptor/internal/webhooks"
+	"interceptor/pkg/logger"
+	"math"
+	"strings"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Locals the upgrade handler hands on to the connection
+const (
+	localsChatLogger      = "chat_logger"
+	localsChatCorrelation = "chat_correlation_id"
+)
+
+var globalChatHub *chat.Hub
+
+// InitializeChat sets the hub that serves chat connections
+func InitializeChat(hub *chat.Hub) {
+	globalChatHub = hub
+}
+
+// ChatUpgradeHandler admits WebSocket upgrades to the chat endpoint. The
+// connection authenticates with its first frame, not on the upgrade, so the
+// session token stays out of URLs and request logs.
+func ChatUpgradeHandler(c *fiber.Ctx) error {
+	if globalChatHub == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Chat is not available",
+		})
+	}
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Chat requires a WebSocket connection",
+		})
+	}
+
+	c.Locals(localsChatLogger, middleware.Logger(c))
+	c.Locals(localsChatCorrelation, middleware.CorrelationID(c.UserContext()))
+	return c.Next()
+}
+
+// ChatSocketHandler serves an upgraded chat connection until it closes
+func ChatSocketHandler(conn *websocket.Conn) {
+	log, ok := conn.Locals(localsChatLogger).(*logger.CustomLogger)
+	if !ok {
+		log = logger.Logger
+	}
+	correlationID, _ := conn.Locals(localsChatCorrelation).(string)
+	globalChatHub.Serve(conn, log, correlationID)
+}
+
+// ServeChatTurn runs one chat turn under the same rate limit, grant, policy,
+// context window and metering as the completion endpoint, streaming the
+// reply through delta. Replies are not cached.
+func ServeChatTurn(ctx context.Context, address string, turn chat.Turn, delta func(string)) chat.Frame {
+	log := logger.With("correlation_id", middleware.CorrelationID(ctx), "address", address, "conversation_id", turn.ConversationID)
+
+	if globalRateLimiter != nil {
+		if allowed, wait := globalRateLimiter.Allow(address); !allowed {
+			frame := chat.Failure("rate_limited", "Rate limit exceeded")
+			frame.Error.RetryAfter = int(math.Ceil(wait.Seconds()))
+			return frame
+		}
+	}
+
+	if turn.Temperature != nil && (*turn.Temperature < 0 || *turn.Temperature > 2) {
+		return chat.Failure("invalid_request", "Temperature must be between 0 and 2")
+	}
+	if turn.MaxTokens < 0 {
+		return chat.Failure("invalid_request", "max_tokens must be a positive integer")
+	}
+
+	conv, fiberErr := ownedConversation(turn.ConversationID, address)
+	if fiberErr != nil {
+		return chat.Failure("conversation_not_found", fiberErr.Message)
+	}
+	model := turn.Model
+	if model == "" {
+		model = conv.Model
+	}
+	if model == "" {
+		model = defaultModel
+	}
+	system := turn.System
+	if system == "" {
+		system = conv.System
+	}
+	log = log.With("model", model)
+
+	auditRecord := audit.Record{
+		Address:     address,
+		Action:      audit.ActionChatTurn,
+		Model:       model,
+		RequestHash: audit.HashRequest(address, model, turn.Message),
+	}
+
+	owner := strings.ToLower(turn.Owner)
+	keyOwner, grant, fiberErr := resolveKeyOwner(address, owner, model)
+	if fiberErr != nil {
+		auditRecord.KeyOwner = owner
+		auditRecord.Outcome = audit.OutcomeDenied
+		recordAudit(log, auditRecord)
+		return chat.Failure("grant_denied", fiberErr.Message)
+	}
+	auditRecord.KeyOwner = keyOwner
+	auditRecord.KeyName = turn.KeyName
+	if grant != nil {
+		auditRecord.GrantID = grant.ID
+	}
+
+	policyRequest := policy.Request{
+		Address:     address,
+		GrantID:     auditRecord.GrantID,
+		Model:       model,
+		MaxTokens:   turn.MaxTokens,
+		Temperature: turn.Temperature,
+		System:      system,
+	}
+	limits, err := checkPolicy(policyRequest)
+	if err != nil {
+		var denial *policy.Denial
+		if !errors.As(err, &denial) {
+			denial = &policy.Denial{Reason: err.Error()}
+		}
+		auditRecord.Outcome = audit.OutcomeDenied
+		recordAudit(log, auditRecord)
+		log.Warnw("chat turn denied by policy", "rule", denial.RuleID, "field", denial.Field, "reason", denial.Reason)
+		return chat.Failure("policy_denied", denial.Reason)
+	}
+	maxTokens := turn.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = limits.MaxTokens
+	}
+
+	credentials := routeCredentials(keyOwner, grant, policyRequest)
+	routes := globalRouter.Routes(model, turn.KeyName)
+
+	head := []tokenizer.Message{}
+	if system != "" {
+		head = append(head, tokenizer.Message{Role: "system", Content: system})
+	}
+	next := tokenizer.Message{Role: "user", Content: turn.Message}
+	summarize := func(ctx context.Context, previous string, turns []conversations.Turn) (string, error) {
+		return summarizeTurns(ctx, log, auditRecord, grant, model, routes, credentials, previous, turns)
+	}
+	head, history, err := conversationHistory(ctx, log, conv, head, next, model, maxTokens, summarize)
+	if err != nil {
+		if ctx.Err() != nil {
+			return chatEnded(ctx, log, auditRecord)
+		}
+		log.Errorw("failed to load conversation history", "error", err)
+		return chat.Failure("internal_error", "Failed to load conversation history")
+	}
+	prompt := append(append(head, conversations.Messages(history)...), next)
+
+	overflow := limits.Overflow
+	if overflow == "" {
+		overflow = globalOverflow
+	}
+	fit, err := fitContext(model, prompt, maxTokens, overflow)
+	if err != nil {
+		var contextErr *tokenizer.ContextError
+		if !errors.As(err, &contextErr) {
+			log.Errorw("failed to count prompt tokens", "error", err)
+			return chat.Failure("internal_error", "Failed to count prompt tokens")
+		}
+		metrics.ContextOverflows.WithLabelValues("rejected").Inc()
+		auditRecord.Outcome = audit.OutcomeDenied
+		recordAudit(log, auditRecord)
+		return chat.Failure("context_length_exceeded", contextErr.Error())
+	}
+	if fit.Truncated() {
+		metrics.ContextOverflows.WithLabelValues("truncated").Inc()
+		log.Infow("prompt truncated to fit context window", "prompt_tokens", fit.PromptTokens, "dropped", fit.Dropped, "trimmed", fit.Trimmed)
+	}
+	systemPrompt, historyMessages, promptMessage := splitPrompt(fit.Messages)
+
+	reservation, fiberErr := reserveGrantSpend(grant, routes, fit.PromptTokens, maxTokens, 1)
+	if fiberErr != nil {
+		auditRecord.Outcome = audit.OutcomeDenied
+		recordAudit(log, auditRecord)
+		return chat.Failure("grant_denied", fiberErr.Message)
+	}
+	defer reservation.Release()
+
+	result, err := globalRouter.Complete(ctx, providers.Request{
+		Model:       model,
+		History:     historyMessages,
+		Prompt:      promptMessage,
+		Temperature: turn.Temperature,
+		MaxTokens:   maxTokens,
+		System:      systemPrompt,
+		OnDelta:     delta,
+	}, routes, withContextFit(credentials, model, fit.Messages, maxTokens))
+	if result.KeyName != "" {
+		auditRecord.KeyName = result.KeyName
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return chatEnded(ctx, log, auditRecord)
+		}
+
+		var providerErr *providers.Error
+		if errors.As(err, &providerErr) {
+			auditRecord.Outcome = audit.OutcomeProviderError
+			recordAudit(log, auditRecord)
+			log.Warnw("provider call failed", "key_owner", keyOwner, "route", result.Route.String(), "attempts", result.Attempts, "error", err)
+			frame := chat.Failure("provider_error", providerMessage(providerErr, result.KeyName))
+			frame.Error.RetryAfter = providerErr.Body().RetryAfter
+			return frame
+		}
+
+		log.Warnw("key resolution failed", "key_owner", keyOwner, "key_name", turn.KeyName, "error", err)
+		auditRecord.Outcome = audit.OutcomeKeyUnavailable
+		recordAudit(log, auditRecord)
+		if errors.Is(err, keyring.ErrTimeout) {
+			return chat.Failure("key_unavailable", "No API key received within timeout")
+		}
+		return chat.Failure("key_unavailable", fmt.Sprintf("No API key available: %v", err))
+	}
+
+	// Servers that report no usage on streams are metered by our own count
+	if result.PromptTokens == 0 && result.CompletionTokens == 0 {
+		result.PromptTokens = fit.PromptTokens
+		if counter, err := tokenizer.ForModel(result.Route.Model).Counter(); err == nil {
+			result.CompletionTokens = counter.Count(result.Content)
+		}
+	}
+
+	record := usage.Record{
+		Address:          address,
+		KeyOwner:         keyOwner,
+		KeyName:          result.KeyName,
+		GrantID:          auditRecord.GrantID,
+		Model:            result.Route.Model,
+		Route:            result.Route.String(),
+		Attempts:         result.Attempts,
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.CompletionTokens,
+	}
+	if !strings.EqualFold(result.Route.Model, model) {
+		record.RequestedModel = model
+	}
+	if err := globalUsage.Record(record); err != nil {
+		log.Errorw("failed to record usage", "error", err)
+	}
+
+	auditRecord.PromptTokens = result.PromptTokens
+	auditRecord.CompletionTokens = result.CompletionTokens
+	auditRecord.Outcome = audit.OutcomeSuccess
+	recordAudit(log, auditRecord)
+
+	log.Infow("chat turn served",
+		"key_owner", keyOwner,
+		"key_name", result.KeyName,
+		"grant_id", record.GrantID,
+		"route", record.Route,
+		"attempts", result.Attempts,
+		"prompt_tokens", result.PromptTokens,
+		"completion_tokens", result.CompletionTokens,
+	)
+
+	appendTurns(log, conv, turn.Message, result.Content, record.Route)
+
+	notify(log, address, webhooks.EventCompletionFinished, fiber.Map{
+		"correlation_id":    middleware.CorrelationID(ctx),
+		"model":             model,
+		"route":             record.Route,
+		"prompt_tokens":     result.PromptTokens,
+		"completion_tokens": result.CompletionTokens,
+		"content":           result.Content,
+		"conversation_id":   conv.ID,
+	})
+
+	return chat.Frame{
+		Type:             chat.FrameDone,
+		Route:            record.Route,
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.CompletionTokens,
+		Truncated:        fit.Truncated(),
+	}
+}
+
+// chatEnded records a turn cut short by its deadline, by a cancel frame or
+// by the connection closing
+func chatEnded(ctx context.Context, log *logger.CustomLogger, auditRecord audit.Record) chat.Frame {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		auditRecord.Outcome = audit.OutcomeFailed
+		recordAudit(log, auditRecord)
+		log.Warnw("chat turn exceeded its deadline")
+		return chat.Failure("timeout", "Turn exceeded its deadline")
+	}
+
+	auditRecord.Outcome = audit.OutcomeCanceled
+	recordAudit(log, auditRecord)
+	log.Infow("chat turn canceled", "cause", context.Cause(ctx))
+	return chat.Frame{Type: chat.FrameCanceled}
+}
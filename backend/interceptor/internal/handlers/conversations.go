@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"interceptor/internal/audit"
+	"interceptor/internal/conversations"
+	"interceptor/internal/grants"
+	"interceptor/internal/middleware"
+	"interceptor/internal/providers"
+	"interceptor/internal/tokenizer"
+	"interceptor/internal/usage"
+	"interceptor/pkg/logger"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	globalConversations    conversations.Store
+	globalHistoryStrategy  = conversations.StrategyTruncate
+	globalSummaryMaxTokens int
+)
+
+// InitializeConversations sets the conversation store and how history that
+// no longer fits a model is shortened
+func InitializeConversations(store conversations.Store, strategy string, summaryMaxTokens int) {
+	globalConversations = store
+	globalHistoryStrategy = strings.ToLower(strategy)
+	globalSummaryMaxTokens = summaryMaxTokens
+}
+
+// ownedConversation returns the conversation if address owns it. Someone
+// else's conversation is reported as missing so IDs cannot be probed.
+func ownedConversation(id, address string) (*conversations.Conversation, *fiber.Error) {
+	if globalConversations == nil {
+		return nil, fiber.NewError(fiber.StatusServiceUnavailable, "Conversations are not available")
+	}
+
+	conv, err := globalConversations.Get(id)
+	if err != nil || conv.Owner != address {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Conversation not found")
+	}
+	return conv, nil
+}
+
+// summarizer condenses turns that no longer fit; the completion handler binds
+// it to the request's routes and keys so summaries are billed like turns
+type summarizer func(ctx context.Context, previous string, turns []conversations.Turn) (string, error)
+
+// conversationHistory returns the system messages and turns sent before the
+// next message. Turns that do not fit the model's budget are left out or,
+// under the summarize strategy, condensed into the conversation's summary.
+func conversationHistory(ctx context.Context, log *logger.CustomLogger, conv *conversations.Conversation, head []tokenizer.Message, next tokenizer.Message, model string, maxTokens int, summarize summarizer) ([]tokenizer.Message, []conversations.Turn, error) {
+	turns, err := globalConversations.Turns(conv.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	from := 0
+	withSummary := head
+	if globalHistoryStrategy == conversations.StrategySummarize && conv.Summary != "" {
+		from = conv.SummarizedThrough
+		withSummary = append(append([]tokenizer.Message{}, head...), conversations.SummaryMessage(conv.Summary))
+	}
+
+	entry, budget := promptBudget(model, maxTokens)
+	if budget == 0 {
+		// Unknown window: send everything and let the provider decide
+		return withSummary, turns[from:], nil
+	}
+	counter, err := entry.Counter()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if globalHistoryStrategy != conversations.StrategySummarize {
+		start := conversations.Window(counter, head, turns, 0, next, budget)
+		return head, turns[start:], nil
+	}
+
+	// Leave room for the summary that replaces the turns left out
+	start := conversations.Window(counter, withSummary, turns, from, next, budget-globalSummaryMaxTokens)
+	if start == from {
+		return withSummary, turns[start:], nil
+	}
+
+	summary, err := summarize(ctx, conv.Summary, turns[from:start])
+	if err != nil {
+		log.Warnw("failed to summarize conversation, leaving out older turns", "conversation_id", conv.ID, "error", err)
+		return withSummary, turns[start:], nil
+	}
+	if err := globalConversations.SetSummary(conv.ID, summary, start); err != nil {
+		log.Errorw("failed to store conversation summary", "conversation_id", conv.ID, "error", err)
+	}
+	conv.Summary, conv.SummarizedThrough = summary, start
+
+	withSummary = append(append([]tokenizer.Message{}, head...), conversations.SummaryMessage(summary))
+	return withSummary, turns[start:], nil
+}
+
+// summarizeTurns asks the model for a summary of turns, extending previous.
+// The call is billed, held against grant and audited for the caller like any
+// completion.
+func summarizeTurns(ctx context.Context, log *logger.CustomLogger, caller audit.Record, grant *grants.Grant, model string, routes []providers.Route, keys providers.KeyFunc, previous string, turns []conversations.Turn) (string, error) {
+	prompt := []tokenizer.Message{
+		{Role: "system", Content: conversations.SummaryInstruction},
+		{Role: "user", Content: conversations.Transcript(previous, turns)},
+	}
+	fit, err := fitContext(model, prompt, globalSummaryMaxTokens, tokenizer.OverflowTruncate)
+	if err != nil {
+		return "", err
+	}
+
+	reservation, fiberErr := reserveGrantSpend(grant, routes, fit.PromptTokens, globalSummaryMaxTokens, 1)
+	if fiberErr != nil {
+		return "", fiberErr
+	}
+	defer reservation.Release()
+
+	result, err := globalRouter.Complete(ctx, providers.Request{
+		Model:     model,
+		System:    conversations.SummaryInstruction,
+		Prompt:    fit.Messages[len(fit.Messages)-1].Content,
+		MaxTokens: globalSummaryMaxTokens,
+	}, routes, keys)
+
+	auditRecord := caller
+	auditRecord.Action = audit.ActionSummary
+	auditRecord.RequestHash = audit.HashRequest(caller.Address, model, fit.Messages[len(fit.Messages)-1].Content)
+	if result.KeyName != "" {
+		auditRecord.KeyName = result.KeyName
+	}
+	if err != nil {
+		auditRecord.Outcome = audit.OutcomeProviderError
+		recordAudit(log, auditRecord)
+		return "", err
+	}
+
+	record := usage.Record{
+		Address:          caller.Address,
+		KeyOwner:         caller.KeyOwner,
+		KeyName:          result.KeyName,
+		GrantID:          caller.GrantID,
+		Model:            result.Route.Model,
+		Route:            result.Route.String(),
+		Attempts:         result.Attempts,
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.CompletionTokens,
+	}
+	if err := globalUsage.Record(record); err != nil {
+		log.Errorw("failed to record usage", "error", err)
+	}
+
+	auditRecord.PromptTokens = result.PromptTokens
+	auditRecord.CompletionTokens = result.CompletionTokens
+	auditRecord.Outcome = audit.OutcomeSuccess
+	recordAudit(log, auditRecord)
+
+	log.Infow("conversation summarized", "turns", len(turns), "route", record.Route, "completion_tokens", result.CompletionTokens)
+	return strings.TrimSpace(result.Content), nil
+}
+
+// splitPrompt turns fitted messages back into a provider request: leading
+// system messages become the system prompt, the last message the prompt. A
+// conversation that ends on tool results has no prompt.
+func splitPrompt(messages []tokenizer.Message) (system string, history []providers.Message, prompt string) {
+	end := len(messages) - 1
+	if messages[end].Role == "user" {
+		prompt = messages[end].Content
+	} else {
+		end = len(messages)
+	}
+
+	var systems []string
+	i := 0
+	for ; i < len(messages)-1 && messages[i].Role == "system"; i++ {
+		systems = append(systems, messages[i].Content)
+	}
+	for ; i < end; i++ {
+		history = append(history, providers.Message{
+			Role:       messages[i].Role,
+			Content:    messages[i].Content,
+			ToolCalls:  messages[i].ToolCalls,
+			ToolCallID: messages[i].ToolCallID,
+		})
+	}
+	return strings.Join(systems, "\n\n"), history, prompt
+}
+
+// appendTurns records the user message and the reply that answered it
+func appendTurns(log *logger.CustomLogger, conv *conversations.Conversation, message, reply, route string) {
+	now := time.Now().UTC()
+	err := globalConversations.Append(conv.ID,
+		conversations.Turn{Role: conversations.RoleUser, Content: message, CreatedAt: now},
+		conversations.Turn{Role: conversations.RoleAssistant, Content: reply, Route: route, CreatedAt: now},
+	)
+	if err != nil {
+		log.Errorw("failed to append conversation turns", "conversation_id", conv.ID, "error", err)
+	}
+}
+
+// CreateConversationHandler starts a conversation owned by the session's address
+func CreateConversationHandler(c *fiber.Ctx) error {
+	if globalConversations == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Conversations are not available",
+		})
+	}
+
+	var requestBody struct {
+		Address string `json:"address"`
+		Title   string `json:"title"`
+		Model   string `json:"model"`
+		System  string `json:"system"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid JSON format",
+		})
+	}
+	address, fiberErr := sessionAddress(c, requestBody.Address)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	now := time.Now().UTC()
+	conv := &conversations.Conversation{
+		ID:        conversations.NewID(),
+		Owner:     address,
+		Title:     requestBody.Title,
+		Model:     requestBody.Model,
+		System:    requestBody.System,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	conv.Normalize()
+
+	if err := globalConversations.Create(conv); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	middleware.Logger(c).Infow("conversation created", "conversation_id", conv.ID, "owner", conv.Owner)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":       "success",
+		"conversation": conv,
+	})
+}
+
+// ListConversationsHandler lists the conversations of the session's address
+func ListConversationsHandler(c *fiber.Ctx) error {
+	if globalConversations == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Conversations are not available",
+		})
+	}
+
+	address, fiberErr := sessionAddress(c, c.Query("address"))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	list, err := globalConversations.ListByOwner(address)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":        "success",
+		"conversations": list,
+	})
+}
+
+// GetConversationHandler returns a conversation with its turns
+func GetConversationHandler(c *fiber.Ctx) error {
+	address, fiberErr := sessionAddress(c, c.Query("address"))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	conv, fiberErr := ownedConversation(c.Params("id"), address)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	turns, err := globalConversations.Turns(conv.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":       "success",
+		"conversation": conv,
+		"turns":        turns,
+	})
+}
+
+// ForkConversationHandler copies a conversation, up to an optional number of
+// turns, into a new one the caller can take elsewhere
+func ForkConversationHandler(c *fiber.Ctx) error {
+	var requestBody struct {
+		Address string `json:"address"`
+		Through *int   `json:"through"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid JSON format",
+		})
+	}
+
+	address, fiberErr := sessionAddress(c, requestBody.Address)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	conv, fiberErr := ownedConversation(c.Params("id"), address)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	through := conv.TurnCount
+	if requestBody.Through != nil {
+		through = *requestBody.Through
+	}
+	if through < 0 || through > conv.TurnCount {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "through must be between 0 and the conversation's turn count",
+		})
+	}
+
+	fork, err := globalConversations.Fork(conv.ID, through)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	middleware.Logger(c).Infow("conversation forked", "conversation_id", fork.ID, "parent_id", conv.ID, "through", through)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":       "success",
+		"conversation": fork,
+	})
+}
+
+// DeleteConversationHandler deletes a conversation and its turns
+func DeleteConversationHandler(c *fiber.Ctx) error {
+	address, fiberErr := sessionAddress(c, c.Query("address"))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	conv, fiberErr := ownedConversation(c.Params("id"), address)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	if err := globalConversations.Delete(conv.ID); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, conversations.ErrNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	middleware.Logger(c).Infow("conversation deleted", "conversation_id", conv.ID)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Conversation deleted",
+	})
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"interceptor/internal/grants"
+	"interceptor/internal/middleware"
+	"interceptor/internal/providers"
+	"interceptor/internal/usage"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	globalGrants grants.Store
+	globalUsage  *usage.Recorder
+)
+
+// InitializeGrantHandlers sets the grant store and usage recorder used by the handlers
+func InitializeGrantHandlers(store grants.Store, recorder *usage.Recorder) {
+	globalGrants = store
+	globalUsage = recorder
+}
+
+// CreateGrantHandler stores a grant signed by the key owner
+func CreateGrantHandler(c *fiber.Ctx) error {
+	var grant grants.Grant
+	if err := c.BodyParser(&grant); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid JSON format",
+		})
+	}
+
+	grant.Normalize()
+	if err := grant.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	if !grant.Active(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Grant is already expired",
+		})
+	}
+
+	if err := grants.VerifySignature(&grant); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	grant.ID = grant.ComputeID()
+	grant.CreatedAt = time.Now().UTC()
+	grant.RevokedAt = nil
+
+	if err := globalGrants.Put(&grant); err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	middleware.Logger(c).Infow("grant created",
+		"grant_id", grant.ID,
+		"owner", grant.Owner,
+		"grantee", grant.Grantee,
+		"expires_at", grant.ExpiresAt,
+	)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status": "success",
+		"grant":  grant,
+	})
+}
+
+// ListGrantsHandler lists the grants the session's address issued
+// (?role=owner), received (?role=grantee) or both, along with their spend
+func ListGrantsHandler(c *fiber.Ctx) error {
+	address, fiberErr := sessionAddress(c, "")
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	var (
+		list     []*grants.Grant
+		received []*grants.Grant
+		err      error
+	)
+	switch c.Query("role") {
+	case "owner":
+		list, err = globalGrants.ListByOwner(address)
+	case "grantee":
+		list, err = globalGrants.ListByGrantee(address)
+	case "":
+		list, err = globalGrants.ListByOwner(address)
+		if err == nil {
+			received, err = globalGrants.ListByGrantee(address)
+			list = append(list, received...)
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "role must be owner or grantee",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	now := time.Now()
+	result := make([]fiber.Map, 0, len(list))
+	for _, g := range list {
+		result = append(result, fiber.Map{
+			"grant":  g,
+			"active": g.Active(now),
+			"spent":  globalUsage.GrantSpend(g.ID),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"grants": result,
+	})
+}
+
+// RevokeGrantHandler revokes a grant given the owner's signature over the revoke message
+func RevokeGrantHandler(c *fiber.Ctx) error {
+	var requestBody struct {
+		Signature string `json:"signature"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil || requestBody.Signature == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Signature is required",
+		})
+	}
+
+	grant, err := globalGrants.Get(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	if err := grants.VerifyRevocation(grant, requestBody.Signature); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	if err := globalGrants.Revoke(grant.ID, time.Now()); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	middleware.Logger(c).Infow("grant revoked", "grant_id", grant.ID, "owner", grant.Owner)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Grant revoked",
+	})
+}
+
+// resolveKeyOwner decides whose stored key serves a request. Callers use their
+// own key unless they name a different owner, in which case an active grant
+// from that owner must cover the requested model and still have budget left.
+func resolveKeyOwner(caller, owner, model string) (string, *grants.Grant, *fiber.Error) {
+	if owner == "" || owner == caller {
+		return caller, nil, nil
+	}
+
+	grant, err := grants.FindActive(globalGrants, owner, caller, time.Now())
+	if err != nil {
+		return "", nil, fiber.NewError(fiber.StatusForbidden, "No active grant from owner to caller")
+	}
+
+	if !grant.AllowsModel(model) {
+		return "", nil, fiber.NewError(fiber.StatusForbidden, "Model "+model+" is not allowed by grant")
+	}
+
+	// A fast refusal only; reserveGrantSpend decides atomically at dispatch
+	if grant.SpendCap > 0 && globalUsage.Committed(grant.ID) >= grant.SpendCap {
+		return "", nil, fiber.NewError(fiber.StatusPaymentRequired, "Grant spending cap reached")
+	}
+
+	return owner, grant, nil
+}
+
+// reserveGrantSpend holds the most a call can cost against a capped grant:
+// the prompt plus maxTokens of completion, priced by the dearest route, for
+// each of calls completions. The caller releases it once the usage is
+// recorded. No grant or no cap holds nothing.
+func reserveGrantSpend(grant *grants.Grant, routes []providers.Route, promptTokens, maxTokens, calls int) (*usage.Reservation, *fiber.Error) {
+	if grant == nil || grant.SpendCap <= 0 {
+		return nil, nil
+	}
+	if maxTokens == 0 {
+		maxTokens = globalReserveTokens
+	}
+	var estimate float64
+	for _, route := range routes {
+		estimate = math.Max(estimate, usage.Cost(route.Model, promptTokens, maxTokens))
+	}
+	reservation, err := globalUsage.Reserve(grant.ID, grant.SpendCap, estimate*float64(calls))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusPaymentRequired, "Grant spending cap reached")
+	}
+	return reservation, nil
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"interceptor/internal/health"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// providerPingURL answers any request, authenticated or not, while OpenAI is up
+const providerPingURL = "https://api.openai.com/v1/models"
+
+var globalHealthTimeout = 2 * time.Second
+
+// InitializeHealth sets the time each dependency check may take
+func InitializeHealth(timeout time.Duration) {
+	globalHealthTimeout = timeout
+}
+
+// LivezHandler reports whether the process needs a restart
+func LivezHandler(c *fiber.Ctx) error {
+	return probe(c, true)
+}
+
+// ReadyzHandler reports whether the service can take traffic
+func ReadyzHandler(c *fiber.Ctx) error {
+	return probe(c, false)
+}
+
+func probe(c *fiber.Ctx, live bool) error {
+	report := health.Run(c.UserContext(), live, globalHealthTimeout)
+
+	status := fiber.StatusOK
+	if !report.Healthy() {
+		status = fiber.StatusServiceUnavailable
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(status).JSON(report)
+}
+
+// CheckProvider reports whether the OpenAI API can be reached. Any response
+// below 500 counts, since the check sends no key.
+func CheckProvider(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, providerPingURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create provider request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach provider: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("provider returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -94,7 +94,8 @@ func ConsumeMessages(messages <-chan amqp.Delivery) (string, error) {
 		for key, value := range msg.Headers {
 			logger.Info("    %s: %v", key, value)
 		}
-		logger.Info("  Raw Body: %s", string(msg.Body))
+		// Bodies carry keys base64-encoded, out of reach of redaction
+		logger.Info("  Body: %d bytes", len(msg.Body))
 
 		// First unmarshal the outer message
 		var outerMsg RawMessage
@@ -112,7 +113,7 @@ func ConsumeMessages(messages <-chan amqp.Delivery) (string, error) {
 			return "", err
 		}
 
-		logger.Info("Final decoded message: %s", string(decodedBody))
+		logger.Debug("Decoded message: %d bytes", len(decodedBody))
 		msg.Ack(false)
 
 		return string(decodedBody), nil
@@ -1,16 +1,29 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"interceptor/internal/audit"
+	"interceptor/internal/conversations"
+	"interceptor/internal/grants"
+	"interceptor/internal/health"
+	"interceptor/internal/keyring"
+	"interceptor/internal/metrics"
+	"interceptor/internal/middleware"
+	"interceptor/internal/policy"
+	"interceptor/internal/providers"
+	"interceptor/internal/respcache"
+	"interceptor/internal/tokenizer"
+	"interceptor/internal/usage"
+	"interceptor/internal/webhooks"
+	"interceptor/pkg/logger"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/streadway/amqp"
 )
 
 // var (
@@ -26,8 +39,15 @@ func HomeHandler(c *fiber.Ctx) error {
 	})
 }
 
-// HealthCheckHandler responds to the health check route
+// HealthCheckHandler responds to the health check route. It reports readiness
+// in the original response shape; /readyz has the per-check detail.
 func HealthCheckHandler(c *fiber.Ctx) error {
+	if report := health.Run(c.UserContext(), false, globalHealthTimeout); !report.Healthy() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Service is not ready",
+		})
+	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status":  "success",
 		"message": "Service is healthy",
@@ -72,169 +92,538 @@ func PublishMessageThroughBroker(c *fiber.Ctx) error {
 		})
 	}
 
-	// Access the fields from the map
+	// The caller is the address its session token was issued to; a body
+	// address, if sent, must be the same
 	address, ok := requestBody["address"].(string)
-	if !ok {
+	if !ok && requestBody["address"] != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Address is required and must be a string",
+			"message": "Address must be a string",
+		})
+	}
+	address, fiberErr := sessionAddress(c, address)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
 		})
 	}
 
+	// Earlier messages may carry tool calls and their results, in which case
+	// the message itself may be left out
+	messages, err := parseMessages(requestBody["messages"])
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
 	message, ok := requestBody["message"].(string)
-	if !ok {
+	if !ok && (requestBody["message"] != nil || len(messages) == 0) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Message is required and must be a string",
 		})
 	}
 
-	// Create the message for the API key request
-	rabbitMessage := amqp.Publishing{
-		ContentType: "application/json",
-		Body:        []byte(address),
+	// Optional fields: the model to call and the owner whose key to use
+	model, _ := requestBody["model"].(string)
+	owner, _ := requestBody["owner"].(string)
+
+	// Sampling and caching: temperature 0 makes a completion cacheable, and
+	// cache opts in regardless
+	var temperature *float64
+	if value, ok := requestBody["temperature"].(float64); ok {
+		if value < 0 || value > 2 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Temperature must be between 0 and 2",
+			})
+		}
+		temperature = &value
 	}
+	optInCache, _ := requestBody["cache"].(bool)
+
+	// Optional limits and prompt shaping, all subject to policy
+	var maxTokens int
+	if value, ok := requestBody["max_tokens"]; ok {
+		number, isNumber := value.(float64)
+		if !isNumber || number < 1 || number != float64(int(number)) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "max_tokens must be a positive integer",
+			})
+		}
+		maxTokens = int(number)
+	}
+	system, _ := requestBody["system"].(string)
 
-	if err := globalProducer.PublishMessage(rabbitMessage); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	// Tools are either the client's, whose calls are returned for it to run,
+	// or server tools the proxy runs itself until the model answers
+	clientTools, err := parseTools(requestBody["tools"])
+	if err == nil && len(clientTools) > 0 && requestBody["server_tools"] != nil {
+		err = fmt.Errorf("tools and server_tools cannot be combined")
+	}
+	var serverTools []string
+	if err == nil {
+		serverTools, err = serverToolNames(requestBody["server_tools"])
+	}
+	definitions := clientTools
+	if len(serverTools) > 0 {
+		definitions = globalTools.Definitions(serverTools)
+	}
+	var toolChoice string
+	if err == nil {
+		toolChoice, err = parseToolChoice(requestBody["tool_choice"], definitions)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
 			"message": err.Error(),
 		})
 	}
+	var toolNames []string
+	for _, definition := range definitions {
+		toolNames = append(toolNames, definition.Name)
+	}
 
-	messages, err := globalConsumer.ConsumeMessages()
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Failed to consume messages",
-		})
+	owner = strings.ToLower(owner)
+
+	if err := rateLimited(c, address); err != nil {
+		return err
 	}
 
-	select {
-	case msg := <-messages:
-		// Process the message directly
-		var outerMsg RawMessage
-		if err := json.Unmarshal(msg.Body, &outerMsg); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	// A conversation supplies earlier turns, and its model and system prompt
+	// unless the request sets its own
+	var conv *conversations.Conversation
+	if conversationID, _ := requestBody["conversation_id"].(string); conversationID != "" {
+		// Conversations keep text turns only, so client tool traffic stays out
+		if len(clientTools) > 0 || len(messages) > 0 || message == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"status":  "error",
-				"message": fmt.Sprintf("Failed to unmarshal message: %v", err),
+				"message": "A conversation takes a message, without tools or messages",
 			})
 		}
+		conv, fiberErr = ownedConversation(conversationID, address)
+		if fiberErr != nil {
+			return c.Status(fiberErr.Code).JSON(fiber.Map{
+				"status":  "error",
+				"message": fiberErr.Message,
+			})
+		}
+		if model == "" {
+			model = conv.Model
+		}
+		if system == "" {
+			system = conv.System
+		}
+	}
+	if model == "" {
+		model = defaultModel
+	}
+
+	log := middleware.Logger(c).With("address", address, "model", model)
+
+	// Every outcome below is audited against a hash of the request
+	auditRecord := audit.Record{
+		Address:     address,
+		Action:      audit.ActionCompletion,
+		Model:       model,
+		RequestHash: audit.HashRequest(address, model, message),
+	}
+
+	// Resolve whose key serves this call, checking the grant for delegated use
+	keyOwner, grant, fiberErr := resolveKeyOwner(address, owner, model)
+	if fiberErr != nil {
+		auditRecord.KeyOwner = owner
+		auditRecord.Outcome = audit.OutcomeDenied
+		recordAudit(log, auditRecord)
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	// Fetch the key by name, or the owner's default for the model's provider
+	keyName, _ := requestBody["key_name"].(string)
+
+	auditRecord.KeyOwner = keyOwner
+	auditRecord.KeyName = keyName
+	if grant != nil {
+		auditRecord.GrantID = grant.ID
+	}
+
+	// Policies for the caller and grant decide which models and parameters
+	// the request may use
+	policyRequest := policy.Request{
+		Address:     address,
+		GrantID:     auditRecord.GrantID,
+		Model:       model,
+		MaxTokens:   maxTokens,
+		Temperature: temperature,
+		Tools:       toolNames,
+		System:      system,
+	}
+	limits, err := checkPolicy(policyRequest)
+	if err != nil {
+		var denial *policy.Denial
+		if !errors.As(err, &denial) {
+			denial = &policy.Denial{Reason: err.Error()}
+		}
+		auditRecord.Outcome = audit.OutcomeDenied
+		recordAudit(log, auditRecord)
+		log.Warnw("request denied by policy", "rule", denial.RuleID, "field", denial.Field, "reason", denial.Reason)
+		return policyDenied(c, denial)
+	}
+	if maxTokens == 0 {
+		maxTokens = limits.MaxTokens
+	}
+
+	credentials := routeCredentials(keyOwner, grant, policyRequest)
 
-		apiKey, err := base64.StdEncoding.DecodeString(outerMsg.Body)
+	routes := globalRouter.Routes(model, keyName)
+	ctx := c.UserContext()
+
+	// Earlier turns of a conversation go before the message, as many as fit
+	head := []tokenizer.Message{}
+	if system != "" {
+		head = append(head, tokenizer.Message{Role: "system", Content: system})
+	}
+	next := tokenizer.Message{Role: "user", Content: message}
+	var history []conversations.Turn
+	if conv != nil {
+		summarize := func(ctx context.Context, previous string, turns []conversations.Turn) (string, error) {
+			return summarizeTurns(ctx, log, auditRecord, grant, model, routes, credentials, previous, turns)
+		}
+		head, history, err = conversationHistory(ctx, log, conv, head, next, model, maxTokens, summarize)
 		if err != nil {
+			if middleware.ClientGone(ctx) {
+				return clientGone(c, log, auditRecord)
+			}
+			log.Errorw("failed to load conversation history", "conversation_id", conv.ID, "error", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
-				"message": fmt.Sprintf("Failed to decode API key: %v", err),
+				"message": "Failed to load conversation history",
 			})
 		}
+	}
+	prompt := append(append(head, conversations.Messages(history)...), messages...)
+	if message != "" || len(messages) == 0 {
+		prompt = append(prompt, next)
+	}
 
-		msg.Ack(false)
-
-		// Make the GPT API call using the API key and original user request
-		gptResponse, err := makeGPTCall(string(apiKey), message)
-		if err != nil {
+	// Count the prompt before dispatch so an over-long one never reaches a
+	// provider; policy may ask for truncation instead of rejection
+	overflow := limits.Overflow
+	if overflow == "" {
+		overflow = globalOverflow
+	}
+	fit, err := fitContext(model, prompt, maxTokens, overflow)
+	if err != nil {
+		var contextErr *tokenizer.ContextError
+		if !errors.As(err, &contextErr) {
+			log.Errorw("failed to count prompt tokens", "error", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"status":  "error",
-				"message": fmt.Sprintf("GPT API call failed: %v", err),
+				"message": "Failed to count prompt tokens",
 			})
 		}
+		metrics.ContextOverflows.WithLabelValues("rejected").Inc()
+		auditRecord.Outcome = audit.OutcomeDenied
+		recordAudit(log, auditRecord)
+		log.Warnw("prompt exceeds context window", "prompt_tokens", contextErr.PromptTokens, "budget", contextErr.Budget)
+		return contextTooLong(c, model, contextErr)
+	}
+	if fit.Truncated() {
+		metrics.ContextOverflows.WithLabelValues("truncated").Inc()
+		c.Set(HeaderPromptTruncated, "true")
+		log.Infow("prompt truncated to fit context window", "prompt_tokens", fit.PromptTokens, "dropped", fit.Dropped, "trimmed", fit.Trimmed)
+	}
+	c.Set(HeaderPromptTokens, strconv.Itoa(fit.PromptTokens))
+	systemPrompt, historyMessages, promptMessage := splitPrompt(fit.Messages)
+
+	keys := withContextFit(credentials, model, fit.Messages, maxTokens)
+
+	// Repeats are served from the cache per caller; a hit costs nothing and is
+	// not recorded as usage. Tool calls and results are not cached.
+	var cacheKey string
+	if globalResponseCache != nil && len(definitions) == 0 && len(messages) == 0 && (optInCache || (temperature != nil && *temperature == 0)) {
+		messages := make([]respcache.Message, len(fit.Messages))
+		for i, m := range fit.Messages {
+			messages[i] = respcache.Message{Role: m.Role, Content: m.Content}
+		}
+		cacheKey = respcache.Key(routes[0].Provider, model, messages, respcache.Params{Temperature: temperature, MaxTokens: maxTokens})
+		if entry, ok := globalResponseCache.Get(address, cacheKey); ok {
+			metrics.ResponseCacheLookups.WithLabelValues("hit").Inc()
+			c.Set(HeaderCache, "HIT")
+			c.Set(fiber.HeaderAge, strconv.Itoa(int(time.Since(entry.CreatedAt).Seconds())))
+			c.Set(HeaderRoute, entry.Route)
+
+			auditRecord.Outcome = audit.OutcomeCacheHit
+			recordAudit(log, auditRecord)
+			log.Infow("completion served from cache", "route", entry.Route)
+
+			response := fiber.Map{
+				"status":  "success",
+				"message": entry.Content,
+			}
+			if conv != nil {
+				appendTurns(log, conv, message, entry.Content, entry.Route)
+				response["conversation_id"] = conv.ID
+			}
+			return c.Status(fiber.StatusOK).JSON(response)
+		}
+		metrics.ResponseCacheLookups.WithLabelValues("miss").Inc()
+		c.Set(HeaderCache, "MISS")
+	}
 
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"status":  "success",
-			"message": gptResponse,
+	// Hold what the call can cost against a capped grant until it is recorded
+	calls := 1
+	if len(serverTools) > 0 {
+		calls = globalToolIterations
+	}
+	reservation, fiberErr := reserveGrantSpend(grant, routes, fit.PromptTokens, maxTokens, calls)
+	if fiberErr != nil {
+		auditRecord.Outcome = audit.OutcomeDenied
+		recordAudit(log, auditRecord)
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
 		})
+	}
+	defer reservation.Release()
+
+	request := providers.Request{
+		Model:       model,
+		History:     historyMessages,
+		Prompt:      promptMessage,
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
+		System:      systemPrompt,
+		Tools:       definitions,
+		ToolChoice:  toolChoice,
+	}
+	var result providers.Result
+	if len(serverTools) > 0 {
+		result, err = completeWithTools(ctx, log, address, request, routes, keys)
+	} else {
+		result, err = globalRouter.Complete(ctx, request, routes, keys)
+	}
+	c.Set(HeaderRoute, result.Route.String())
+	c.Set(HeaderAttempts, strconv.Itoa(result.Attempts))
+	if result.KeyName != "" {
+		auditRecord.KeyName = result.KeyName
+	}
+	if err != nil {
+		if middleware.ClientGone(ctx) {
+			return clientGone(c, log, auditRecord)
+		}
+
+		var providerErr *providers.Error
+		if errors.As(err, &providerErr) {
+			auditRecord.Outcome = audit.OutcomeProviderError
+			recordAudit(log, auditRecord)
+			log.Warnw("provider call failed", "key_owner", keyOwner, "route", result.Route.String(), "attempts", result.Attempts, "error", err)
+			return providerError(c, err, result.KeyName)
+		}
 
-	case <-time.After(10 * time.Second):
+		// No route had a usable key
+		log.Warnw("key resolution failed", "key_owner", keyOwner, "key_name", keyName, "error", err)
+		auditRecord.Outcome = audit.OutcomeKeyUnavailable
+		recordAudit(log, auditRecord)
+		if errors.Is(err, keyring.ErrTimeout) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "No API key received within timeout",
+			})
+		}
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"status":  "error",
-			"message": "No API key received within timeout",
+			"message": fmt.Sprintf("No API key available: %v", err),
 		})
 	}
-}
 
-const apiURL = "https://api.openai.com/v1/chat/completions"
+	// Attribute the call to the caller, even when it used a granted key, and
+	// price it by the model that actually served it
+	record := usage.Record{
+		Address:          address,
+		KeyOwner:         keyOwner,
+		KeyName:          result.KeyName,
+		Model:            result.Route.Model,
+		Route:            result.Route.String(),
+		Attempts:         result.Attempts,
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.CompletionTokens,
+	}
+	if !strings.EqualFold(result.Route.Model, model) {
+		record.RequestedModel = model
+	}
+	if grant != nil {
+		record.GrantID = grant.ID
+	}
+	if err := globalUsage.Record(record); err != nil {
+		log.Errorw("failed to record usage", "error", err)
+	}
+
+	if cacheKey != "" {
+		globalResponseCache.Put(address, cacheKey, respcache.Entry{
+			Content:          result.Content,
+			Route:            result.Route.String(),
+			PromptTokens:     result.PromptTokens,
+			CompletionTokens: result.CompletionTokens,
+			CreatedAt:        time.Now(),
+		})
+	}
+
+	auditRecord.PromptTokens = result.PromptTokens
+	auditRecord.CompletionTokens = result.CompletionTokens
+	auditRecord.Outcome = audit.OutcomeSuccess
+	recordAudit(log, auditRecord)
+
+	log.Infow("completion served",
+		"key_owner", keyOwner,
+		"key_name", result.KeyName,
+		"grant_id", record.GrantID,
+		"route", record.Route,
+		"attempts", result.Attempts,
+		"prompt_tokens", result.PromptTokens,
+		"completion_tokens", result.CompletionTokens,
+	)
+
+	response := fiber.Map{
+		"status":  "success",
+		"message": result.Content,
+	}
+	if len(result.ToolCalls) > 0 {
+		response["tool_calls"] = toolCallsJSON(result.ToolCalls)
+	}
+	if conv != nil {
+		appendTurns(log, conv, message, result.Content, record.Route)
+		response["conversation_id"] = conv.ID
+	}
+
+	notification := fiber.Map{
+		"correlation_id":    middleware.CorrelationID(ctx),
+		"model":             model,
+		"route":             record.Route,
+		"prompt_tokens":     result.PromptTokens,
+		"completion_tokens": result.CompletionTokens,
+		"content":           result.Content,
+	}
+	if conv != nil {
+		notification["conversation_id"] = conv.ID
+	}
+	notify(log, address, webhooks.EventCompletionFinished, notification)
 
-type GPTRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	return c.Status(fiber.StatusOK).JSON(response)
 }
 
-type GPTResponse struct {
-	Choices []struct {
-		Message Message `json:"message"`
-	} `json:"choices"`
+// routeCredentials returns the key for each route of the model's chain: the
+// owner's key for the route's provider. A delegated key only serves the
+// models its grant covers, and a failover model must pass the same policies
+// as the one requested.
+func routeCredentials(keyOwner string, grant *grants.Grant, policyRequest policy.Request) providers.KeyFunc {
+	return func(ctx context.Context, route providers.Route) (providers.Credential, error) {
+		if grant != nil && !grant.AllowsModel(route.Model) {
+			return providers.Credential{}, fmt.Errorf("model %s is not allowed by grant", route.Model)
+		}
+		if !strings.EqualFold(route.Model, policyRequest.Model) {
+			routeRequest := policyRequest
+			routeRequest.Model = route.Model
+			if _, err := checkPolicy(routeRequest); err != nil {
+				return providers.Credential{}, err
+			}
+		}
+		entry, err := resolveAPIKey(ctx, keyOwner, route.Key, route.Provider)
+		if err != nil {
+			return providers.Credential{}, err
+		}
+		// entry is a copy of the cached key; the router wipes it after the call
+		return providers.Credential{Key: entry.Key, Name: entry.Name}, nil
+	}
 }
 
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+// withContextFit skips a failover model that cannot fit the prompt in its
+// own window
+func withContextFit(credentials providers.KeyFunc, model string, messages []tokenizer.Message, maxTokens int) providers.KeyFunc {
+	return func(ctx context.Context, route providers.Route) (providers.Credential, error) {
+		if !strings.EqualFold(route.Model, model) {
+			if _, err := fitContext(route.Model, messages, maxTokens, tokenizer.OverflowReject); err != nil {
+				return providers.Credential{}, fmt.Errorf("prompt does not fit %s: %v", route.Model, err)
+			}
+		}
+		return credentials(ctx, route)
+	}
 }
 
-// Helper function to make the GPT API call
-func makeGPTCall(apiKey string, userRequest string) (string, error) {
-	// Prepare the request payload
-	requestBody := GPTRequest{
-		Model: "gpt-3.5-turbo",
-		Messages: []Message{
-			{Role: "user", Content: userRequest},
-		},
+// providerError answers with the status and error object for a provider
+// failure, passing on any Retry-After hint. keyName is the stored key the
+// call used, named when the provider rejected it.
+func providerError(c *fiber.Ctx, err error, keyName string) error {
+	var providerErr *providers.Error
+	if !errors.As(err, &providerErr) {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("GPT API call failed: %v", err),
+		})
 	}
 
-	// Convert the request payload to JSON
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		fmt.Println("Error marshalling request body:", err)
-		return "", err
+	if retryAfter := providerErr.RetryAfterHeader(); retryAfter != "" {
+		c.Set(fiber.HeaderRetryAfter, retryAfter)
 	}
+	return c.Status(providerErr.HTTPStatus()).JSON(fiber.Map{
+		"status":  "error",
+		"message": providerMessage(providerErr, keyName),
+		"error":   providerErr.Body(),
+	})
+}
 
-	// Create a new HTTP POST request
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		fmt.Println("Error creating HTTP request:", err)
-		return "", err
+// providerMessage describes a provider failure for the client. A rejected
+// key is the key owner's to fix, so the message names it rather than reading
+// like the client's own credentials failed.
+func providerMessage(providerErr *providers.Error, keyName string) string {
+	if providerErr.Kind != providers.KindAuth {
+		return fmt.Sprintf("GPT API call failed: %s", providerErr.Message)
+	}
+	if keyName == "" {
+		return fmt.Sprintf("The stored %s API key was rejected by the provider; rotate or replace it", providerErr.Provider)
 	}
+	return fmt.Sprintf("The stored %s API key %q was rejected by the provider; rotate or replace it", providerErr.Provider, keyName)
+}
 
-	// Set required headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+// statusClientClosed is logged for requests the client abandoned; nobody
+// reads the response
+const statusClientClosed = 499
 
-	// Send the HTTP request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Println("Error sending request:", err)
-		return "", err
-	}
-	defer resp.Body.Close()
+// clientGone records a request the client abandoned mid-flight
+func clientGone(c *fiber.Ctx, log *logger.CustomLogger, auditRecord audit.Record) error {
+	log.Infow("client disconnected, request abandoned")
+	auditRecord.Outcome = audit.OutcomeCanceled
+	recordAudit(log, auditRecord)
+	return c.SendStatus(statusClientClosed)
+}
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println("Error reading response:", err)
-		return "", err
-	}
+// Response headers naming the route that served a completion, the provider
+// calls it took and whether it came from the response cache
+const (
+	HeaderRoute    = "X-Upstream-Route"
+	HeaderAttempts = "X-Upstream-Attempts"
+	HeaderCache    = "X-Cache"
+)
 
-	// Check if the response status is OK
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("Error: %s\n", string(body))
-		return "", err
-	}
+const defaultModel = "gpt-3.5-turbo"
 
-	// Parse the response
-	var gptResponse GPTResponse
-	err = json.Unmarshal(body, &gptResponse)
-	if err != nil {
-		fmt.Println("Error unmarshalling response:", err)
-		return "", err
-	}
+var (
+	globalRouter        *providers.Router
+	globalResponseCache respcache.Cache
+)
 
-	// Print the response from GPT
-	if len(gptResponse.Choices) > 0 {
-		fmt.Println("GPT Response:", gptResponse.Choices[0].Message.Content)
-	} else {
-		fmt.Println("No response from GPT")
-	}
+// InitializeRouter sets the router that serves completions
+func InitializeRouter(router *providers.Router) {
+	globalRouter = router
+}
 
-	return gptResponse.Choices[0].Message.Content, nil
+// InitializeResponseCache sets the completion cache; nil disables caching
+func InitializeResponseCache(cache respcache.Cache) {
+	globalResponseCache = cache
 }
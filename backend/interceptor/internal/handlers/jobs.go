@@ -0,0 +1,539 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interceptor/internal/audit"
+	"interceptor/internal/grants"
+	"interceptor/internal/jobs"
+	"interceptor/internal/keyring"
+	"interceptor/internal/middleware"
+	"interceptor/internal/policy"
+	"interceptor/internal/providers"
+	"interceptor/internal/tokenizer"
+	"interceptor/internal/usage"
+	"interceptor/pkg/logger"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	globalJobs        jobs.Store
+	globalJobWorker   *jobs.Worker
+	globalJobMaxItems int
+	globalJobTimeout  time.Duration
+)
+
+// InitializeJobs sets the job store, the worker that queues items, the most
+// items one job may hold and how long one item may take
+func InitializeJobs(store jobs.Store, worker *jobs.Worker, maxItems int, itemTimeout time.Duration) {
+	globalJobs = store
+	globalJobWorker = worker
+	globalJobMaxItems = maxItems
+	globalJobTimeout = itemTimeout
+}
+
+// jobLine is one line of a submitted batch. Fields left out fall back to the
+// job's query parameters.
+type jobLine struct {
+	CustomID    string   `json:"custom_id"`
+	Message     string   `json:"message"`
+	Model       string   `json:"model"`
+	System      string   `json:"system"`
+	KeyName     string   `json:"key_name"`
+	MaxTokens   int      `json:"max_tokens"`
+	Temperature *float64 `json:"temperature"`
+}
+
+// ownedJob returns the job if address submitted it. Someone else's job is
+// reported as missing so IDs cannot be probed.
+func ownedJob(id, address string) (*jobs.Job, *fiber.Error) {
+	if globalJobs == nil {
+		return nil, fiber.NewError(fiber.StatusServiceUnavailable, "Jobs are not available")
+	}
+
+	job, err := globalJobs.Get(id)
+	if err != nil || job.Owner != address {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Job not found")
+	}
+	return job, nil
+}
+
+// parseJobLines reads a JSONL batch into items. Blank lines are skipped; an
+// invalid line fails the whole batch with its line number.
+func parseJobLines(body []byte, defaults jobs.Item) ([]jobs.Item, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+
+	var items []jobs.Item
+	for number := 1; scanner.Scan(); number++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var line jobLine
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&line); err != nil {
+			return nil, fmt.Errorf("line %d: invalid JSON: %v", number, err)
+		}
+		if line.Message == "" {
+			return nil, fmt.Errorf("line %d: message is required", number)
+		}
+		if line.MaxTokens < 0 {
+			return nil, fmt.Errorf("line %d: max_tokens must be a positive integer", number)
+		}
+		if line.Temperature != nil && (*line.Temperature < 0 || *line.Temperature > 2) {
+			return nil, fmt.Errorf("line %d: temperature must be between 0 and 2", number)
+		}
+		if len(items) == globalJobMaxItems {
+			return nil, fmt.Errorf("a job holds at most %d items", globalJobMaxItems)
+		}
+
+		item := defaults
+		item.Index = len(items)
+		item.CustomID = line.CustomID
+		item.Message = line.Message
+		item.System = line.System
+		item.MaxTokens = line.MaxTokens
+		item.Temperature = line.Temperature
+		if line.Model != "" {
+			item.Model = line.Model
+		}
+		if line.KeyName != "" {
+			item.KeyName = line.KeyName
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch: %v", err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("batch has no items")
+	}
+	return items, nil
+}
+
+// CreateJobHandler accepts a JSONL batch of completions from the caller's
+// session and queues its items. The owner, model and key_name query
+// parameters apply to every line that does not set its own.
+func CreateJobHandler(c *fiber.Ctx) error {
+	if globalJobs == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Jobs are not available",
+		})
+	}
+
+	// Items run for the session's address; an address query, if sent, must
+	// be the same
+	address, fiberErr := sessionAddress(c, c.Query("address"))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+	model := c.Query("model")
+	if model == "" {
+		model = defaultModel
+	}
+
+	items, err := parseJobLines(c.Body(), jobs.Item{
+		Address: address,
+		Owner:   strings.ToLower(c.Query("owner")),
+		KeyName: c.Query("key_name"),
+		Model:   model,
+		Attempt: 1,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	// Refuse up front what a worker would refuse anyway; both checks run
+	// again per item, since grants and policies can change meanwhile
+	for _, item := range items {
+		_, grant, fiberErr := resolveKeyOwner(item.Address, item.Owner, item.Model)
+		if fiberErr != nil {
+			return c.Status(fiberErr.Code).JSON(fiber.Map{
+				"status":  "error",
+				"message": fmt.Sprintf("item %d: %s", item.Index, fiberErr.Message),
+			})
+		}
+		if _, err := checkPolicy(jobPolicyRequest(item, grant)); err != nil {
+			var denial *policy.Denial
+			if !errors.As(err, &denial) {
+				denial = &policy.Denial{Reason: err.Error()}
+			}
+			denial.Reason = fmt.Sprintf("item %d: %s", item.Index, denial.Reason)
+			return policyDenied(c, denial)
+		}
+	}
+
+	now := time.Now().UTC()
+	job := &jobs.Job{
+		ID:        jobs.NewID(),
+		Owner:     address,
+		Status:    jobs.StatusQueued,
+		Total:     len(items),
+		Pending:   len(items),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := globalJobs.Create(job); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	log := middleware.Logger(c).With("job_id", job.ID, "address", address)
+
+	for i, item := range items {
+		item.JobID = job.ID
+		if err := globalJobWorker.Enqueue(item); err != nil {
+			// Settle what never reached the queue so the job still completes
+			log.Errorw("failed to enqueue job items", "queued", i, "total", len(items), "error", err)
+			for _, rest := range items[i:] {
+				settled, _ := globalJobs.SetResult(job.ID, jobs.Result{
+					Index:      rest.Index,
+					CustomID:   rest.CustomID,
+					Status:     jobs.ItemFailed,
+					Error:      &jobs.ItemError{Type: "enqueue_failed", Message: err.Error()},
+					FinishedAt: time.Now().UTC(),
+				})
+				globalJobWorker.Finished(settled)
+			}
+			if job, err := globalJobs.Get(job.ID); err == nil {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"status":  "error",
+					"message": "Failed to enqueue job items",
+					"job":     job,
+				})
+			}
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to enqueue job items",
+			})
+		}
+	}
+
+	log.Infow("job queued", "items", len(items))
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"status": "success",
+		"job":    job,
+	})
+}
+
+// ListJobsHandler lists the jobs of the session's address
+func ListJobsHandler(c *fiber.Ctx) error {
+	if globalJobs == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Jobs are not available",
+		})
+	}
+
+	address, fiberErr := sessionAddress(c, c.Query("address"))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	list, err := globalJobs.ListByOwner(address)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"jobs":   list,
+	})
+}
+
+// GetJobHandler returns a job's status and counts
+func GetJobHandler(c *fiber.Ctx) error {
+	address, fiberErr := sessionAddress(c, c.Query("address"))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	job, fiberErr := ownedJob(c.Params("id"), address)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"job":    job,
+	})
+}
+
+// JobResultsHandler returns the settled items of a job as JSONL, in item
+// order. Items still queued are not listed yet.
+func JobResultsHandler(c *fiber.Ctx) error {
+	address, fiberErr := sessionAddress(c, c.Query("address"))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	job, fiberErr := ownedJob(c.Params("id"), address)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	results, err := globalJobs.Results(job.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, result := range results {
+		if err := encoder.Encode(result); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": err.Error(),
+			})
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	return c.Status(fiber.StatusOK).Send(body.Bytes())
+}
+
+// CancelJobHandler cancels a job. Items running on this instance are cut
+// short; the rest are settled as canceled when a worker reaches them.
+func CancelJobHandler(c *fiber.Ctx) error {
+	address, fiberErr := sessionAddress(c, c.Query("address"))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	job, fiberErr := ownedJob(c.Params("id"), address)
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	if job.Status == jobs.StatusCompleted || job.Status == jobs.StatusCanceled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Job is already %s", job.Status),
+		})
+	}
+
+	if err := globalJobs.Cancel(job.ID); err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+	globalJobWorker.CancelJob(job.ID)
+
+	middleware.Logger(c).Infow("job canceled", "job_id", job.ID)
+
+	job, _ = globalJobs.Get(job.ID)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"job":    job,
+	})
+}
+
+// jobPolicyRequest describes an item to the policy engine
+func jobPolicyRequest(item jobs.Item, grant *grants.Grant) policy.Request {
+	req := policy.Request{
+		Address:     item.Address,
+		Model:       item.Model,
+		MaxTokens:   item.MaxTokens,
+		Temperature: item.Temperature,
+		System:      item.System,
+	}
+	if grant != nil {
+		req.GrantID = grant.ID
+	}
+	return req
+}
+
+// ProcessJobItem runs one queued completion under the same rate limit,
+// grant, policy and context checks as the completion endpoint. Failures that
+// may pass on a later attempt are marked retryable.
+func ProcessJobItem(ctx context.Context, item jobs.Item) jobs.Result {
+	ctx, cancel := context.WithTimeout(ctx, globalJobTimeout)
+	defer cancel()
+
+	log := logger.With("job_id", item.JobID, "item", item.Index, "address", item.Address, "model", item.Model)
+
+	auditRecord := audit.Record{
+		Address:     item.Address,
+		Action:      audit.ActionJobItem,
+		Model:       item.Model,
+		RequestHash: audit.HashRequest(item.Address, item.Model, item.Message),
+	}
+
+	// Items share the address's rate limit with its interactive requests
+	if err := waitRateLimit(ctx, item.Address); err != nil {
+		return jobFailure("timeout", "Rate limit wait exceeded the item deadline", true)
+	}
+
+	keyOwner, grant, fiberErr := resolveKeyOwner(item.Address, item.Owner, item.Model)
+	if fiberErr != nil {
+		auditRecord.KeyOwner = item.Owner
+		auditRecord.Outcome = audit.OutcomeDenied
+		recordAudit(log, auditRecord)
+		return jobFailure("grant_denied", fiberErr.Message, false)
+	}
+	auditRecord.KeyOwner = keyOwner
+	auditRecord.KeyName = item.KeyName
+	if grant != nil {
+		auditRecord.GrantID = grant.ID
+	}
+
+	policyRequest := jobPolicyRequest(item, grant)
+	limits, err := checkPolicy(policyRequest)
+	if err != nil {
+		auditRecord.Outcome = audit.OutcomeDenied
+		recordAudit(log, auditRecord)
+		return jobFailure("policy_denied", err.Error(), false)
+	}
+	maxTokens := item.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = limits.MaxTokens
+	}
+
+	prompt := []tokenizer.Message{}
+	if item.System != "" {
+		prompt = append(prompt, tokenizer.Message{Role: "system", Content: item.System})
+	}
+	prompt = append(prompt, tokenizer.Message{Role: "user", Content: item.Message})
+
+	overflow := limits.Overflow
+	if overflow == "" {
+		overflow = globalOverflow
+	}
+	fit, err := fitContext(item.Model, prompt, maxTokens, overflow)
+	if err != nil {
+		var contextErr *tokenizer.ContextError
+		if !errors.As(err, &contextErr) {
+			return jobFailure("internal_error", fmt.Sprintf("Failed to count prompt tokens: %v", err), false)
+		}
+		auditRecord.Outcome = audit.OutcomeDenied
+		recordAudit(log, auditRecord)
+		return jobFailure("context_length_exceeded", contextErr.Error(), false)
+	}
+	systemPrompt, historyMessages, promptMessage := splitPrompt(fit.Messages)
+
+	routes := globalRouter.Routes(item.Model, item.KeyName)
+	reservation, fiberErr := reserveGrantSpend(grant, routes, fit.PromptTokens, maxTokens, 1)
+	if fiberErr != nil {
+		auditRecord.Outcome = audit.OutcomeDenied
+		recordAudit(log, auditRecord)
+		return jobFailure("grant_denied", fiberErr.Message, false)
+	}
+	defer reservation.Release()
+
+	credentials := routeCredentials(keyOwner, grant, policyRequest)
+	result, err := globalRouter.Complete(ctx, providers.Request{
+		Model:       item.Model,
+		History:     historyMessages,
+		Prompt:      promptMessage,
+		Temperature: item.Temperature,
+		MaxTokens:   maxTokens,
+		System:      systemPrompt,
+	}, routes, withContextFit(credentials, item.Model, fit.Messages, maxTokens))
+	if result.KeyName != "" {
+		auditRecord.KeyName = result.KeyName
+	}
+	if err != nil {
+		var providerErr *providers.Error
+		if errors.As(err, &providerErr) {
+			auditRecord.Outcome = audit.OutcomeProviderError
+			recordAudit(log, auditRecord)
+			message := providerErr.Message
+			if providerErr.Kind == providers.KindAuth {
+				message = providerMessage(providerErr, result.KeyName)
+			}
+			return jobFailure("provider_error", message, providerErr.Retryable())
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			auditRecord.Outcome = audit.OutcomeFailed
+			recordAudit(log, auditRecord)
+			return jobFailure("timeout", "Item exceeded its deadline", true)
+		}
+
+		auditRecord.Outcome = audit.OutcomeKeyUnavailable
+		recordAudit(log, auditRecord)
+		return jobFailure("key_unavailable", fmt.Sprintf("No API key available: %v", err), errors.Is(err, keyring.ErrTimeout))
+	}
+
+	record := usage.Record{
+		Address:          item.Address,
+		KeyOwner:         keyOwner,
+		KeyName:          result.KeyName,
+		GrantID:          auditRecord.GrantID,
+		Model:            result.Route.Model,
+		Route:            result.Route.String(),
+		Attempts:         result.Attempts,
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.CompletionTokens,
+	}
+	if !strings.EqualFold(result.Route.Model, item.Model) {
+		record.RequestedModel = item.Model
+	}
+	if err := globalUsage.Record(record); err != nil {
+		log.Errorw("failed to record usage", "error", err)
+	}
+
+	auditRecord.PromptTokens = result.PromptTokens
+	auditRecord.CompletionTokens = result.CompletionTokens
+	auditRecord.Outcome = audit.OutcomeSuccess
+	recordAudit(log, auditRecord)
+
+	return jobs.Result{
+		Content:          result.Content,
+		Route:            record.Route,
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.CompletionTokens,
+	}
+}
+
+// jobFailure is the result of an item that failed
+func jobFailure(kind, message string, retryable bool) jobs.Result {
+	return jobs.Result{Error: &jobs.ItemError{Type: kind, Message: message, Retryable: retryable}}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"interceptor/internal/audit"
+	"interceptor/internal/keycache"
+	"interceptor/internal/keyring"
+	"interceptor/internal/middleware"
+	"interceptor/internal/webhooks"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	globalKeyring  *keyring.Client
+	globalKeyCache *keycache.Cache
+)
+
+// InitializeKeyringHandlers sets the keyring client and the cache of resolved keys
+func InitializeKeyringHandlers(client *keyring.Client, cache *keycache.Cache) {
+	globalKeyring = client
+	globalKeyCache = cache
+}
+
+// KeyCacheStatsHandler reports hit/miss counters for the resolved-key cache
+func KeyCacheStatsHandler(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"stats":  globalKeyCache.Stats(),
+	})
+}
+
+// ListKeysHandler lists the named keys stored for an address. The owner
+// signs "b.env list keys\naddress: <address>\nissued: <issued>\nnonce: <nonce>"
+// and passes address, issued, nonce and signature as query parameters.
+//
+// Every signed key request carries issued, the RFC 3339 time of signing,
+// which must be within a few minutes of the server's clock, and a nonce that
+// may be used once.
+func ListKeysHandler(c *fiber.Ctx) error {
+	address := strings.ToLower(c.Query("address"))
+	if address == "" || c.Query("issued") == "" || c.Query("nonce") == "" || c.Query("signature") == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "address, issued, nonce and signature query parameters are required",
+		})
+	}
+
+	reply, err := globalKeyring.ListKeys(c.UserContext(), address, c.Query("issued"), c.Query("nonce"), c.Query("signature"))
+	if err != nil {
+		return keyringError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"keys":   reply.Keys,
+	})
+}
+
+// DeleteKeyHandler deletes a named key. The owner signs
+// "b.env delete key\naddress: <address>\nname: <name>\nissued: <issued>\nnonce: <nonce>".
+func DeleteKeyHandler(c *fiber.Ctx) error {
+	var requestBody struct {
+		Address   string `json:"address"`
+		Issued    string `json:"issued"`
+		Nonce     string `json:"nonce"`
+		Signature string `json:"signature"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil || requestBody.Address == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Address, issued, nonce and signature are required",
+		})
+	}
+
+	_, err := globalKeyring.DeleteKey(c.UserContext(), strings.ToLower(requestBody.Address), c.Params("name"), requestBody.Issued, requestBody.Nonce, requestBody.Signature)
+	auditKeyChange(c, audit.ActionDeleteKey, requestBody.Address, err)
+	if err != nil {
+		return keyringError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Key deleted",
+	})
+}
+
+// RotateKeyHandler replaces a named key. The owner signs
+// "b.env rotate key\naddress: <address>\nname: <name>\nkey: <fingerprint>\nissued: <issued>\nnonce: <nonce>",
+// where fingerprint is the first 16 bytes of the new key's SHA-256, hex encoded.
+func RotateKeyHandler(c *fiber.Ctx) error {
+	var requestBody struct {
+		Address   string `json:"address"`
+		Key       string `json:"key"`
+		Issued    string `json:"issued"`
+		Nonce     string `json:"nonce"`
+		Signature string `json:"signature"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil || requestBody.Address == "" || requestBody.Key == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Address, key, issued, nonce and signature are required",
+		})
+	}
+
+	address := strings.ToLower(requestBody.Address)
+	reply, err := globalKeyring.RotateKey(c.UserContext(), address, c.Params("name"), requestBody.Key, requestBody.Issued, requestBody.Nonce, requestBody.Signature)
+	auditKeyChange(c, audit.ActionRotateKey, requestBody.Address, err)
+	if err != nil {
+		return keyringError(c, err)
+	}
+
+	notify(middleware.Logger(c), address, webhooks.EventKeyRotated, fiber.Map{
+		"name":        c.Params("name"),
+		"provider":    reply.Provider,
+		"fingerprint": keyring.Fingerprint(requestBody.Key),
+		"rotated_at":  time.Now().UTC(),
+	})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Key rotated",
+	})
+}
+
+// RevokeKeyHandler tombstones a named key. The owner signs
+// "b.env revoke key\naddress: <address>\nname: <name>\nissued: <issued>\nnonce: <nonce>".
+func RevokeKeyHandler(c *fiber.Ctx) error {
+	var requestBody struct {
+		Address   string `json:"address"`
+		Issued    string `json:"issued"`
+		Nonce     string `json:"nonce"`
+		Signature string `json:"signature"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil || requestBody.Address == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Address, issued, nonce and signature are required",
+		})
+	}
+
+	_, err := globalKeyring.RevokeKey(c.UserContext(), strings.ToLower(requestBody.Address), c.Params("name"), requestBody.Issued, requestBody.Nonce, requestBody.Signature)
+	auditKeyChange(c, audit.ActionRevokeKey, requestBody.Address, err)
+	if err != nil {
+		return keyringError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Key revoked",
+	})
+}
+
+// keyringError maps a keyring client error onto an HTTP response
+func keyringError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusBadRequest
+	if errors.Is(err, keyring.ErrTimeout) {
+		status = fiber.StatusGatewayTimeout
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"status":  "error",
+		"message": err.Error(),
+	})
+}
+
+// auditKeyChange records a signed key management request and its outcome
+func auditKeyChange(c *fiber.Ctx, action, address string, err error) {
+	address = strings.ToLower(address)
+	rec := audit.Record{
+		Address:  address,
+		KeyOwner: address,
+		KeyName:  c.Params("name"),
+		Action:   action,
+		Outcome:  audit.OutcomeSuccess,
+	}
+	if err != nil {
+		rec.Outcome = audit.OutcomeFailed
+	}
+	recordAudit(middleware.Logger(c), rec)
+}
+
+// resolveAPIKey returns the key for an owner, serving from the cache when
+// possible and falling back to a keyring round-trip through the broker. The
+// caller wipes the returned entry once it has used the key.
+func resolveAPIKey(ctx context.Context, owner, keyName, provider string) (keycache.Entry, error) {
+	// A lookup that raced a rotation may have cached the old value; the
+	// retired check catches it even after the invalidation has run
+	if entry, ok := globalKeyCache.Get(owner, keyName, provider); ok {
+		if !globalKeyring.IsRetired(string(entry.Key)) {
+			return entry, nil
+		}
+		entry.Wipe()
+		globalKeyCache.InvalidateAddress(owner)
+	}
+
+	reply, err := globalKeyring.ResolveKey(ctx, owner, keyName, provider)
+	if err != nil {
+		return keycache.Entry{}, err
+	}
+
+	entry := keycache.Entry{Key: []byte(reply.Key), Name: reply.Name, Provider: reply.Provider}
+	globalKeyCache.Put(owner, keyName, provider, entry)
+	return entry, nil
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"interceptor/internal/middleware"
+	"interceptor/internal/policy"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var globalPolicies *policy.Engine
+
+// InitializePolicies sets the policy engine checked before every completion
+func InitializePolicies(engine *policy.Engine) {
+	globalPolicies = engine
+}
+
+// checkPolicy evaluates req against the policies; with no engine every request passes
+func checkPolicy(req policy.Request) (policy.Limits, error) {
+	if globalPolicies == nil {
+		return policy.Limits{}, nil
+	}
+	return globalPolicies.Check(req)
+}
+
+// policyDenied answers with 403 and the rule that refused the request
+func policyDenied(c *fiber.Ctx, denial *policy.Denial) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"status":  "error",
+		"message": denial.Reason,
+		"error": fiber.Map{
+			"type":  "policy_denied",
+			"rule":  denial.RuleID,
+			"field": denial.Field,
+		},
+	})
+}
+
+// ListPoliciesHandler lists config and admin rules
+func ListPoliciesHandler(c *fiber.Ctx) error {
+	if globalPolicies == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Policies are not available",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":   "success",
+		"policies": globalPolicies.Rules(),
+	})
+}
+
+// PutPolicyHandler creates or replaces the admin rule named in the path
+func PutPolicyHandler(c *fiber.Ctx) error {
+	if globalPolicies == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Policies are not available",
+		})
+	}
+
+	var rule policy.Rule
+	if err := c.BodyParser(&rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid JSON format",
+		})
+	}
+	rule.ID = c.Params("id")
+
+	if err := globalPolicies.Put(&rule); err != nil {
+		status := fiber.StatusBadRequest
+		if errors.Is(err, policy.ErrConfigRule) {
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	middleware.Logger(c).Infow("policy saved", "policy_id", rule.ID)
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"policy": rule,
+	})
+}
+
+// DeletePolicyHandler removes the admin rule named in the path
+func DeletePolicyHandler(c *fiber.Ctx) error {
+	if globalPolicies == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Policies are not available",
+		})
+	}
+
+	id := c.Params("id")
+	if err := globalPolicies.Delete(id); err != nil {
+		status := fiber.StatusInternalServerError
+		switch {
+		case errors.Is(err, policy.ErrConfigRule):
+			status = fiber.StatusConflict
+		case errors.Is(err, policy.ErrNotFound):
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	middleware.Logger(c).Infow("policy deleted", "policy_id", id)
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Policy deleted",
+	})
+}
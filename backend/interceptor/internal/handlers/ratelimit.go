@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"interceptor/internal/ratelimit"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var globalRateLimiter *ratelimit.Limiter
+
+// InitializeRateLimiter sets the per-address limiter for completion requests
+func InitializeRateLimiter(limiter *ratelimit.Limiter) {
+	globalRateLimiter = limiter
+}
+
+// rateLimited answers with 429 and Retry-After when address has no requests
+// left; it returns nil when the request may proceed
+func rateLimited(c *fiber.Ctx, address string) error {
+	if globalRateLimiter == nil {
+		return nil
+	}
+
+	allowed, wait := globalRateLimiter.Allow(address)
+	if allowed {
+		return nil
+	}
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"status":  "error",
+		"message": "Rate limit exceeded",
+	})
+}
+
+// waitRateLimit blocks until address may make a request, for work that is
+// queued rather than answered; it returns ctx's error if ctx ends first
+func waitRateLimit(ctx context.Context, address string) error {
+	if globalRateLimiter == nil {
+		return nil
+	}
+
+	for {
+		allowed, wait := globalRateLimiter.Allow(address)
+		if allowed {
+			return nil
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"interceptor/internal/middleware"
+	"interceptor/internal/sessions"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var globalSessions *sessions.Issuer
+
+// InitializeSessions sets the issuer of session tokens
+func InitializeSessions(issuer *sessions.Issuer) {
+	globalSessions = issuer
+}
+
+// OpenSessionHandler issues a session token to an address, which signs
+// "b.env open session\naddress: <address>\nissued: <RFC 3339 time>\nnonce: <nonce>"
+// within a few minutes of the server's clock
+func OpenSessionHandler(c *fiber.Ctx) error {
+	if globalSessions == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Sessions are not available",
+		})
+	}
+
+	var requestBody struct {
+		Address   string `json:"address"`
+		Issued    string `json:"issued"`
+		Nonce     string `json:"nonce"`
+		Signature string `json:"signature"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid JSON format",
+		})
+	}
+
+	session, err := globalSessions.Open(requestBody.Address, requestBody.Issued, requestBody.Nonce, requestBody.Signature)
+	if err != nil {
+		status := fiber.StatusBadRequest
+		switch {
+		case errors.Is(err, sessions.ErrSignature):
+			status = fiber.StatusUnauthorized
+		case errors.Is(err, sessions.ErrNonceUsed):
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	middleware.Logger(c).Infow("session opened", "address", session.Address, "expires_at", session.ExpiresAt)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"session": session,
+	})
+}
+
+// sessionAddress authenticates a request by the session token it carries as
+// "Authorization: Bearer <token>" and returns the address the session was
+// opened for. An address the request claims must be that address.
+func sessionAddress(c *fiber.Ctx, claimed string) (string, *fiber.Error) {
+	if globalSessions == nil {
+		return "", fiber.NewError(fiber.StatusServiceUnavailable, "Sessions are not available")
+	}
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || token == "" {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "A session token is required")
+	}
+	session, err := globalSessions.Verify(token)
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusUnauthorized, err.Error())
+	}
+	if claimed != "" && !strings.EqualFold(claimed, session.Address) {
+		return "", fiber.NewError(fiber.StatusForbidden, "Address does not match the session")
+	}
+	return strings.ToLower(session.Address), nil
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"interceptor/internal/tokenizer"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Response headers with the counted prompt tokens and whether the prompt was
+// shortened to fit the context window
+const (
+	HeaderPromptTokens    = "X-Prompt-Tokens"
+	HeaderPromptTruncated = "X-Prompt-Truncated"
+)
+
+var (
+	globalOverflow      = tokenizer.OverflowReject
+	globalReserveTokens int
+)
+
+// InitializeContextWindow sets the default overflow policy and the tokens
+// kept free for completions that set no max_tokens
+func InitializeContextWindow(overflow string, reserveTokens int) {
+	globalOverflow = strings.ToLower(overflow)
+	globalReserveTokens = reserveTokens
+}
+
+// promptBudget returns the tokenizer entry for model and the prompt tokens it
+// admits, or 0 when its context window is unknown
+func promptBudget(model string, maxTokens int) (tokenizer.Model, int) {
+	entry := tokenizer.ForModel(model)
+	if entry.ContextWindow == 0 {
+		return entry, 0
+	}
+
+	reserve := maxTokens
+	if reserve == 0 {
+		reserve = globalReserveTokens
+	}
+	budget := entry.ContextWindow - reserve
+	if budget < 1 {
+		budget = 1
+	}
+	return entry, budget
+}
+
+// fitContext counts the prompt for model and applies the overflow policy
+// when it does not fit; a model with no known window is only counted
+func fitContext(model string, messages []tokenizer.Message, maxTokens int, overflow string) (tokenizer.Fit, error) {
+	entry, budget := promptBudget(model, maxTokens)
+	counter, err := entry.Counter()
+	if err != nil {
+		return tokenizer.Fit{}, err
+	}
+
+	if budget == 0 {
+		return tokenizer.Fit{Messages: messages, PromptTokens: tokenizer.CountMessages(counter, messages)}, nil
+	}
+	return tokenizer.FitMessages(counter, messages, budget, overflow)
+}
+
+// contextTooLong answers with 413 and the counts behind the rejection
+func contextTooLong(c *fiber.Ctx, model string, contextErr *tokenizer.ContextError) error {
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+		"status":  "error",
+		"message": "Prompt exceeds the model's context window",
+		"error": fiber.Map{
+			"type":           "context_length_exceeded",
+			"model":          model,
+			"prompt_tokens":  contextErr.PromptTokens,
+			"budget":         contextErr.Budget,
+			"context_window": tokenizer.ForModel(model).ContextWindow,
+		},
+	})
+}
+
+type tokenizeRequest struct {
+	Model    string              `json:"model"`
+	Text     string              `json:"text"`
+	Messages []tokenizer.Message `json:"messages"`
+	// IDs asks for the token IDs of text; only exact encodings have them
+	IDs bool `json:"ids"`
+}
+
+// TokenizeHandler counts the tokens of text, or of a conversation including
+// the chat format overhead, for a model
+func TokenizeHandler(c *fiber.Ctx) error {
+	var req tokenizeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid JSON format",
+		})
+	}
+	if req.Text == "" && len(req.Messages) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Text or messages is required",
+		})
+	}
+	if req.Model == "" {
+		req.Model = defaultModel
+	}
+
+	entry, budget := promptBudget(req.Model, 0)
+	counter, err := entry.Counter()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	response := fiber.Map{
+		"status":         "success",
+		"model":          req.Model,
+		"encoding":       counter.Name(),
+		"exact":          counter.Exact(),
+		"context_window": entry.ContextWindow,
+	}
+	if len(req.Messages) > 0 {
+		tokens := tokenizer.CountMessages(counter, req.Messages)
+		response["tokens"] = tokens
+		if budget > 0 {
+			response["fits"] = tokens <= budget
+		}
+	} else {
+		response["tokens"] = counter.Count(req.Text)
+		if enc, ok := counter.(*tokenizer.Encoding); ok && req.IDs {
+			response["ids"] = enc.Encode(req.Text)
+		}
+	}
+
+	return c.JSON(response)
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"interceptor/internal/metrics"
+	"interceptor/internal/providers"
+	"interceptor/internal/tokenizer"
+	"interceptor/internal/tools"
+	"interceptor/pkg/logger"
+	"strings"
+)
+
+var (
+	globalTools          *tools.Registry
+	globalToolIterations = 1
+)
+
+// InitializeTools sets the server-side tools and the most completion calls
+// one request may make while running them; a nil registry disables them
+func InitializeTools(registry *tools.Registry, maxIterations int) {
+	globalTools = registry
+	globalToolIterations = maxIterations
+}
+
+// toolCallJSON is a tool call in the chat completions shape, in which calls
+// are taken and returned so clients can pass them straight back
+type toolCallJSON struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// toolCallsJSON renders calls for a response
+func toolCallsJSON(calls []tools.Call) []toolCallJSON {
+	rendered := make([]toolCallJSON, len(calls))
+	for i, call := range calls {
+		rendered[i] = toolCallJSON{ID: call.ID, Type: "function"}
+		rendered[i].Function.Name = call.Name
+		rendered[i].Function.Arguments = call.Arguments
+	}
+	return rendered
+}
+
+// parseTools reads tool definitions in the chat completions shape, or flat
+// with the schema under parameters or input_schema
+func parseTools(value interface{}) ([]tools.Definition, error) {
+	if value == nil {
+		return nil, nil
+	}
+	var items []struct {
+		Type     string `json:"type"`
+		Function *struct {
+			Name        string          `json:"name"`
+			Description string          `json:"description"`
+			Parameters  json.RawMessage `json:"parameters"`
+		} `json:"function"`
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Parameters  json.RawMessage `json:"parameters"`
+		InputSchema json.RawMessage `json:"input_schema"`
+	}
+	if err := remarshal(value, &items); err != nil {
+		return nil, fmt.Errorf("tools must be an array of tool definitions")
+	}
+
+	definitions := make([]tools.Definition, 0, len(items))
+	seen := make(map[string]bool)
+	for _, item := range items {
+		definition := tools.Definition{Name: item.Name, Description: item.Description, Parameters: item.Parameters}
+		if item.Function != nil {
+			definition = tools.Definition{Name: item.Function.Name, Description: item.Function.Description, Parameters: item.Function.Parameters}
+		}
+		if len(definition.Parameters) == 0 {
+			definition.Parameters = item.InputSchema
+		}
+		if string(definition.Parameters) == "null" {
+			definition.Parameters = nil
+		}
+		if definition.Name == "" {
+			return nil, fmt.Errorf("every tool needs a name")
+		}
+		if seen[definition.Name] {
+			return nil, fmt.Errorf("tool %q is defined twice", definition.Name)
+		}
+		seen[definition.Name] = true
+		definitions = append(definitions, definition)
+	}
+	return definitions, nil
+}
+
+// parseToolChoice reads a tool choice: auto, none, required, or the tool the
+// model must call as {"type":"function","function":{"name":...}} or
+// {"type":"tool","name":...}
+func parseToolChoice(value interface{}, definitions []tools.Definition) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	if len(definitions) == 0 {
+		return "", fmt.Errorf("tool_choice needs tools")
+	}
+
+	var choice string
+	switch v := value.(type) {
+	case string:
+		choice = v
+		if choice != tools.ChoiceAuto && choice != tools.ChoiceNone && choice != tools.ChoiceRequired {
+			return "", fmt.Errorf("tool_choice must be auto, none, required or a tool")
+		}
+	case map[string]interface{}:
+		choice, _ = v["name"].(string)
+		if function, ok := v["function"].(map[string]interface{}); ok {
+			choice, _ = function["name"].(string)
+		}
+		named := false
+		for _, definition := range definitions {
+			named = named || definition.Name == choice
+		}
+		if !named {
+			return "", fmt.Errorf("tool_choice names a tool that is not defined")
+		}
+	default:
+		return "", fmt.Errorf("tool_choice must be a string or an object")
+	}
+	return choice, nil
+}
+
+// parseMessages reads earlier messages in the chat completions shape: user
+// and assistant messages, assistant tool calls and the tool messages that
+// answer them
+func parseMessages(value interface{}) ([]tokenizer.Message, error) {
+	if value == nil {
+		return nil, nil
+	}
+	var items []struct {
+		Role       string         `json:"role"`
+		Content    *string        `json:"content"`
+		ToolCalls  []toolCallJSON `json:"tool_calls"`
+		ToolCallID string         `json:"tool_call_id"`
+	}
+	if err := remarshal(value, &items); err != nil {
+		return nil, fmt.Errorf("messages must be an array of messages with string content")
+	}
+
+	messages := make([]tokenizer.Message, 0, len(items))
+	pending := make(map[string]bool)
+	for i, item := range items {
+		// Providers take the results of a call right after it
+		if item.Role != providers.RoleTool && len(pending) > 0 {
+			return nil, fmt.Errorf("messages[%d]: every tool call needs a tool message with its result first", i)
+		}
+		message := tokenizer.Message{Role: item.Role}
+		if item.Content != nil {
+			message.Content = *item.Content
+		}
+		switch item.Role {
+		case "user":
+		case "assistant":
+			for _, call := range item.ToolCalls {
+				if call.ID == "" || call.Function.Name == "" {
+					return nil, fmt.Errorf("messages[%d]: tool calls need an id and a function name", i)
+				}
+				if call.Function.Arguments != "" && !json.Valid([]byte(call.Function.Arguments)) {
+					return nil, fmt.Errorf("messages[%d]: arguments of %s are not valid JSON", i, call.Function.Name)
+				}
+				message.ToolCalls = append(message.ToolCalls, tools.Call{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+				pending[call.ID] = true
+			}
+		case providers.RoleTool:
+			if !pending[item.ToolCallID] {
+				return nil, fmt.Errorf("messages[%d]: tool_call_id must name an earlier tool call", i)
+			}
+			delete(pending, item.ToolCallID)
+			message.ToolCallID = item.ToolCallID
+		default:
+			return nil, fmt.Errorf("messages[%d]: role must be user, assistant or tool; use system for the system prompt", i)
+		}
+		messages = append(messages, message)
+	}
+	if len(pending) > 0 {
+		return nil, fmt.Errorf("every tool call needs a tool message with its result")
+	}
+	return messages, nil
+}
+
+// remarshal decodes a value taken from a generic JSON body into v
+func remarshal(value interface{}, v interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, v)
+}
+
+// serverToolNames reads the names of the server-side tools a request offers
+// the model
+func serverToolNames(value interface{}) ([]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if globalTools == nil {
+		return nil, fmt.Errorf("server tools are not enabled")
+	}
+	var names []string
+	if err := remarshal(value, &names); err != nil {
+		return nil, fmt.Errorf("server_tools must be an array of tool names")
+	}
+	for _, name := range names {
+		if !globalTools.Has(name) {
+			return nil, fmt.Errorf("unknown server tool %q", name)
+		}
+	}
+	return names, nil
+}
+
+// completeWithTools serves req with server-side tools: while the model calls
+// them, each call runs and its result goes back to the model, for at most
+// globalToolIterations completions. The last of them may not call tools, so
+// the model has to answer. Tokens and attempts add up over every call.
+func completeWithTools(ctx context.Context, log *logger.CustomLogger, address string, req providers.Request, routes []providers.Route, keys providers.KeyFunc) (providers.Result, error) {
+	req.History = append([]providers.Message{}, req.History...)
+	if req.Prompt != "" {
+		req.History = append(req.History, providers.Message{Role: "user", Content: req.Prompt})
+		req.Prompt = ""
+	}
+	offered := make(map[string]bool)
+	for _, definition := range req.Tools {
+		offered[definition.Name] = true
+	}
+
+	var total providers.Result
+	for iteration := 1; ; iteration++ {
+		if iteration >= globalToolIterations {
+			req.ToolChoice = tools.ChoiceNone
+		}
+
+		result, err := globalRouter.Complete(ctx, req, routes, keys)
+		total.Route = result.Route
+		total.KeyName = result.KeyName
+		total.Attempts += result.Attempts
+		total.PromptTokens += result.PromptTokens
+		total.CompletionTokens += result.CompletionTokens
+		if err != nil {
+			return total, err
+		}
+
+		if len(result.ToolCalls) == 0 || iteration >= globalToolIterations {
+			if len(result.ToolCalls) > 0 {
+				log.Warnw("model kept calling tools past the iteration limit", "iterations", iteration)
+			}
+			total.Content = result.Content
+			return total, nil
+		}
+
+		req.History = append(req.History, providers.Message{Role: "assistant", Content: result.Content, ToolCalls: result.ToolCalls})
+		for _, call := range result.ToolCalls {
+			output, err := runTool(ctx, address, call, offered)
+			if err != nil {
+				metrics.ToolRuns.WithLabelValues(call.Name, metrics.OutcomeError).Inc()
+				log.Warnw("server tool failed", "tool", call.Name, "iteration", iteration, "error", err)
+			} else {
+				metrics.ToolRuns.WithLabelValues(call.Name, metrics.OutcomeSuccess).Inc()
+				log.Infow("server tool ran", "tool", call.Name, "iteration", iteration)
+			}
+			req.History = append(req.History, providers.Message{Role: providers.RoleTool, Content: output, ToolCallID: call.ID})
+		}
+	}
+}
+
+// runTool runs a call for address, refusing tools the request did not offer
+func runTool(ctx context.Context, address string, call tools.Call, offered map[string]bool) (string, error) {
+	if !offered[call.Name] {
+		return tools.ErrorResult(fmt.Sprintf("tool %q is not available", call.Name)), fmt.Errorf("tool %q was not offered", call.Name)
+	}
+	return globalTools.Run(ctx, strings.ToLower(address), call)
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"interceptor/internal/tools"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decode parses body the way request handlers receive it, as generic JSON
+func decode(t *testing.T, body string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(body), &value); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	return value
+}
+
+func TestParseMessages(t *testing.T) {
+	messages, err := parseMessages(decode(t, `[
+		{"role": "user", "content": "what keys do I have?"},
+		{"role": "assistant", "content": null, "tool_calls": [
+			{"id": "call_1", "type": "function", "function": {"name": "key_status", "arguments": "{\"name\":\"work\"}"}},
+			{"id": "call_2", "type": "function", "function": {"name": "key_status"}}
+		]},
+		{"role": "tool", "tool_call_id": "call_2", "content": "{\"status\":\"active\"}"},
+		{"role": "tool", "tool_call_id": "call_1", "content": "{\"status\":\"retired\"}"},
+		{"role": "assistant", "content": "One is active."}
+	]`))
+	if err != nil {
+		t.Fatalf("parseMessages: %v", err)
+	}
+	if len(messages) != 5 {
+		t.Fatalf("got %d messages, want 5", len(messages))
+	}
+	calls := messages[1].ToolCalls
+	if len(calls) != 2 || calls[0] != (tools.Call{ID: "call_1", Name: "key_status", Arguments: `{"name":"work"}`}) {
+		t.Fatalf("tool calls: got %+v", calls)
+	}
+	if messages[1].Content != "" || messages[2].ToolCallID != "call_2" {
+		t.Fatalf("got %+v", messages)
+	}
+}
+
+func TestParseMessagesRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"not an array", `{"role": "user"}`, "must be an array"},
+		{"numeric content", `[{"role": "user", "content": 5}]`, "string content"},
+		{"system role", `[{"role": "system", "content": "hi"}]`, "use system for the system prompt"},
+		{"call without id", `[{"role": "assistant", "tool_calls": [{"function": {"name": "key_status"}}]}]`, "need an id and a function name"},
+		{"call without name", `[{"role": "assistant", "tool_calls": [{"id": "call_1", "function": {}}]}]`, "need an id and a function name"},
+		{"bad arguments", `[{"role": "assistant", "tool_calls": [{"id": "call_1", "function": {"name": "key_status", "arguments": "{name"}}]}, {"role": "tool", "tool_call_id": "call_1"}]`, "not valid JSON"},
+		{"unanswered call", `[{"role": "assistant", "tool_calls": [{"id": "call_1", "function": {"name": "key_status"}}]}]`, "needs a tool message"},
+		{"answer after user turn", `[{"role": "assistant", "tool_calls": [{"id": "call_1", "function": {"name": "key_status"}}]}, {"role": "user", "content": "hi"}, {"role": "tool", "tool_call_id": "call_1"}]`, "messages[1]"},
+		{"unknown call id", `[{"role": "tool", "tool_call_id": "call_9", "content": "{}"}]`, "must name an earlier tool call"},
+		{"answered twice", `[{"role": "assistant", "tool_calls": [{"id": "call_1", "function": {"name": "key_status"}}]}, {"role": "tool", "tool_call_id": "call_1"}, {"role": "tool", "tool_call_id": "call_1"}]`, "messages[2]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseMessages(decode(t, tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTools(t *testing.T) {
+	definitions, err := parseTools(decode(t, `[
+		{"type": "function", "function": {"name": "weather", "description": "Weather", "parameters": {"type": "object"}}},
+		{"name": "lookup", "input_schema": {"type": "object"}},
+		{"name": "ping"}
+	]`))
+	if err != nil {
+		t.Fatalf("parseTools: %v", err)
+	}
+	if len(definitions) != 3 || definitions[0].Name != "weather" || string(definitions[1].Parameters) != `{"type":"object"}` || definitions[2].Parameters != nil {
+		t.Fatalf("got %+v", definitions)
+	}
+
+	for body, want := range map[string]string{
+		`[{"description": "anonymous"}]`: "needs a name",
+		`[{"name": "a"}, {"name": "a"}]`: "defined twice",
+		`"weather"`:                      "must be an array",
+	} {
+		if _, err := parseTools(decode(t, body)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v, want %q", body, err, want)
+		}
+	}
+}
+
+func TestParseToolChoice(t *testing.T) {
+	definitions := []tools.Definition{{Name: "weather"}}
+
+	tests := []struct {
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{`"auto"`, tools.ChoiceAuto, false},
+		{`"required"`, tools.ChoiceRequired, false},
+		{`{"type": "function", "function": {"name": "weather"}}`, "weather", false},
+		{`{"type": "tool", "name": "weather"}`, "weather", false},
+		{`"always"`, "", true},
+		{`{"type": "tool", "name": "search"}`, "", true},
+		{`3`, "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseToolChoice(decode(t, tt.body), definitions)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: got %q, %v", tt.body, got, err)
+		}
+	}
+	if _, err := parseToolChoice("auto", nil); err == nil {
+		t.Error("tool_choice without tools accepted")
+	}
+}
+
+func TestRunToolValidatesCalls(t *testing.T) {
+	registry := tools.NewRegistry(time.Second)
+	registry.Register(tools.Tool{
+		Definition: tools.Definition{Name: "echo"},
+		Run: func(_ context.Context, caller string, arguments json.RawMessage) (interface{}, error) {
+			return map[string]string{"caller": caller, "arguments": string(arguments)}, nil
+		},
+	})
+	previous := globalTools
+	globalTools = registry
+	t.Cleanup(func() { globalTools = previous })
+
+	offered := map[string]bool{"echo": true}
+
+	output, err := runTool(context.Background(), "0xABC", tools.Call{ID: "1", Name: "echo"}, offered)
+	if err != nil || output != `{"arguments":"{}","caller":"0xabc"}` {
+		t.Fatalf("got %s, %v", output, err)
+	}
+
+	tests := []struct {
+		name string
+		call tools.Call
+		want string
+	}{
+		{"not offered", tools.Call{ID: "2", Name: "key_status"}, "is not available"},
+		{"bad arguments", tools.Call{ID: "3", Name: "echo", Arguments: "{oops"}, "not valid JSON"},
+	}
+	for _, tt := range tests {
+		output, err := runTool(context.Background(), "0xabc", tt.call, offered)
+		if err == nil || !strings.Contains(output, tt.want) {
+			t.Errorf("%s: got %s, %v", tt.name, output, err)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"errors"
+	"interceptor/internal/jobs"
+	"interceptor/internal/middleware"
+	"interceptor/internal/services"
+	"interceptor/internal/usage"
+	"interceptor/internal/wallet"
+	"interceptor/internal/webhooks"
+	"interceptor/pkg/logger"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	globalWebhooks         webhooks.Store
+	globalDispatcher       *webhooks.Dispatcher
+	globalNotifier         *services.MessageProcessor
+	globalWebhookAllowHTTP bool
+	globalBudgetThresholds []int
+)
+
+// InitializeWebhooks sets the webhook store, the dispatcher that sends
+// deliveries and the processor that raises notifications. Budget thresholds
+// are percentages of a grant's spend cap. It hooks into the job worker and
+// usage recorder, so it runs after they are initialized.
+func InitializeWebhooks(store webhooks.Store, dispatcher *webhooks.Dispatcher, notifier *services.MessageProcessor, allowHTTP bool, budgetThresholds []int) {
+	globalWebhooks = store
+	globalDispatcher = dispatcher
+	globalNotifier = notifier
+	globalWebhookAllowHTTP = allowHTTP
+	globalBudgetThresholds = budgetThresholds
+
+	if globalJobWorker != nil {
+		globalJobWorker.OnFinished(notifyJobFinished)
+	}
+	if globalUsage != nil {
+		globalUsage.OnRecord(notifyBudgetThresholds)
+	}
+}
+
+// notify raises event for address; a failure is logged, never returned, so
+// it cannot fail the work it reports on
+func notify(log *logger.CustomLogger, address, event string, data any) {
+	if globalNotifier == nil {
+		return
+	}
+	if err := globalNotifier.Notify(address, event, data); err != nil {
+		log.Errorw("failed to raise notification", "event", event, "error", err)
+	}
+}
+
+// notifyJobFinished tells the job's owner it has settled its last item
+func notifyJobFinished(job *jobs.Job) {
+	notify(logger.With("job_id", job.ID), job.Owner, webhooks.EventJobFinished, job)
+}
+
+// notifyBudgetThresholds tells a grant's owner and grantee when a usage
+// record carries its spend past a threshold of the cap. Each threshold is
+// crossed by exactly one record.
+func notifyBudgetThresholds(rec usage.Record, spent float64) {
+	if rec.GrantID == "" || len(globalBudgetThresholds) == 0 {
+		return
+	}
+	grant, err := globalGrants.Get(rec.GrantID)
+	if err != nil || grant.SpendCap <= 0 {
+		return
+	}
+
+	before := spent - rec.Cost
+	for _, threshold := range globalBudgetThresholds {
+		limit := grant.SpendCap * float64(threshold) / 100
+		if before >= limit || spent < limit {
+			continue
+		}
+
+		data := fiber.Map{
+			"grant_id":  grant.ID,
+			"owner":     grant.Owner,
+			"grantee":   grant.Grantee,
+			"threshold": threshold,
+			"spend_cap": grant.SpendCap,
+			"spent":     spent,
+		}
+		log := logger.With("grant_id", grant.ID, "threshold", threshold)
+		notify(log, grant.Owner, webhooks.EventBudgetThreshold, data)
+		notify(log, grant.Grantee, webhooks.EventBudgetThreshold, data)
+	}
+}
+
+// PutWebhookHandler registers or replaces the webhook of an address, which
+// signs "b.env register webhook\naddress: <address>\nurl: <url>\nevents: <events>\nissued: <issued>\nnonce: <nonce>"
+// with events comma-separated in sorted order, or "*" for all, and issued the
+// RFC 3339 time of signing. Every registration issues a new signing secret,
+// returned only in this response.
+func PutWebhookHandler(c *fiber.Ctx) error {
+	if globalWebhooks == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Webhooks are not available",
+		})
+	}
+
+	var requestBody struct {
+		Address   string   `json:"address"`
+		URL       string   `json:"url"`
+		Events    []string `json:"events"`
+		Issued    string   `json:"issued"`
+		Nonce     string   `json:"nonce"`
+		Signature string   `json:"signature"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid JSON format",
+		})
+	}
+
+	sub := &webhooks.Subscription{
+		Address: requestBody.Address,
+		URL:     requestBody.URL,
+		Events:  requestBody.Events,
+	}
+	sub.Normalize()
+	if err := sub.Validate(globalWebhookAllowHTTP); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+	if requestBody.Issued == "" || requestBody.Nonce == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "issued and nonce are required",
+		})
+	}
+	if err := wallet.CheckIssued(requestBody.Issued, time.Now()); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	if err := wallet.VerifySigner(sub.RegisterMessage(requestBody.Issued, requestBody.Nonce), requestBody.Signature, sub.Address); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	now := time.Now().UTC()
+	sub.Secret = webhooks.NewSecret()
+	sub.CreatedAt = now
+	sub.UpdatedAt = now
+	if existing, err := globalWebhooks.GetSubscription(sub.Address); err == nil {
+		sub.CreatedAt = existing.CreatedAt
+	}
+	logger.RegisterSecret(sub.Secret)
+
+	if err := globalWebhooks.PutSubscription(sub, requestBody.Nonce); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, webhooks.ErrNonceUsed) {
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	middleware.Logger(c).Infow("webhook registered", "address", sub.Address, "events", strings.Join(sub.Events, ","))
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"webhook": sub,
+	})
+}
+
+// GetWebhookHandler returns the webhook of the session's address, without its
+// secret
+func GetWebhookHandler(c *fiber.Ctx) error {
+	if globalWebhooks == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Webhooks are not available",
+		})
+	}
+
+	address, fiberErr := sessionAddress(c, c.Query("address"))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	sub, err := globalWebhooks.GetSubscription(address)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Webhook not found",
+		})
+	}
+	sub.Secret = ""
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"webhook": sub,
+	})
+}
+
+// DeleteWebhookHandler removes the webhook of an address, which signs
+// "b.env delete webhook\naddress: <address>\nissued: <issued>\nnonce: <nonce>"
+func DeleteWebhookHandler(c *fiber.Ctx) error {
+	if globalWebhooks == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Webhooks are not available",
+		})
+	}
+
+	var requestBody struct {
+		Address   string `json:"address"`
+		Issued    string `json:"issued"`
+		Nonce     string `json:"nonce"`
+		Signature string `json:"signature"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil || requestBody.Address == "" || requestBody.Issued == "" || requestBody.Nonce == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Address, issued, nonce and signature are required",
+		})
+	}
+	if err := wallet.CheckIssued(requestBody.Issued, time.Now()); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+	address := strings.ToLower(requestBody.Address)
+
+	if err := wallet.VerifySigner(webhooks.DeleteMessage(address, requestBody.Issued, requestBody.Nonce), requestBody.Signature, address); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	if err := globalWebhooks.DeleteSubscription(address, requestBody.Nonce); err != nil {
+		status := fiber.StatusInternalServerError
+		switch {
+		case errors.Is(err, webhooks.ErrNotFound):
+			status = fiber.StatusNotFound
+		case errors.Is(err, webhooks.ErrNonceUsed):
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	middleware.Logger(c).Infow("webhook deleted", "address", address)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Webhook deleted",
+	})
+}
+
+// ListDeliveriesHandler lists the recent deliveries of the session's address,
+// newest first and without their payloads
+func ListDeliveriesHandler(c *fiber.Ctx) error {
+	if globalWebhooks == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Webhooks are not available",
+		})
+	}
+
+	address, fiberErr := sessionAddress(c, c.Query("address"))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 {
+		limit = 50
+	}
+
+	list, err := globalWebhooks.ListDeliveries(address, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+	for _, delivery := range list {
+		delivery.Payload = nil
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status":     "success",
+		"deliveries": list,
+	})
+}
+
+// RedeliverHandler sends a logged delivery of the session's address again to
+// its current webhook
+func RedeliverHandler(c *fiber.Ctx) error {
+	if globalWebhooks == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Webhooks are not available",
+		})
+	}
+
+	address, fiberErr := sessionAddress(c, c.Query("address"))
+	if fiberErr != nil {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"status":  "error",
+			"message": fiberErr.Message,
+		})
+	}
+
+	original, err := globalWebhooks.GetDelivery(c.Params("id"))
+	if err != nil || original.Address != address {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Delivery not found",
+		})
+	}
+
+	delivery, err := globalDispatcher.Redeliver(original.ID)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, webhooks.ErrNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	middleware.Logger(c).Infow("webhook redelivery queued", "delivery_id", delivery.ID, "redelivery_of", original.ID)
+
+	delivery.Payload = nil
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"status":   "success",
+		"delivery": delivery,
+	})
+}
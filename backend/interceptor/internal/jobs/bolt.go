@@ -0,0 +1,234 @@
+package jobs
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of the job database. Results and the owner index hold one nested
+// bucket per job and per owner.
+var (
+	jobsBucket    = []byte("jobs")
+	resultsBucket = []byte("results")
+	ownersBucket  = []byte("owners")
+)
+
+// BoltStore keeps jobs in an embedded bbolt database
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens or creates the database at path
+func NewBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create jobs directory: %v", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open jobs database: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{jobsBucket, resultsBucket, ownersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize jobs database: %v", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Create stores a new job
+func (s *BoltStore) Create(job *Job) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(jobsBucket).Get([]byte(job.ID)) != nil {
+			return fmt.Errorf("job %s already exists", job.ID)
+		}
+		if _, err := tx.Bucket(resultsBucket).CreateBucket([]byte(job.ID)); err != nil {
+			return fmt.Errorf("failed to create results for %s: %v", job.ID, err)
+		}
+		index, err := tx.Bucket(ownersBucket).CreateBucketIfNotExists([]byte(job.Owner))
+		if err != nil {
+			return err
+		}
+		if err := index.Put([]byte(job.ID), nil); err != nil {
+			return err
+		}
+		return putJob(tx, job)
+	})
+}
+
+// Get returns the job with the given ID
+func (s *BoltStore) Get(id string) (*Job, error) {
+	var job *Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		job, err = getJob(tx, id)
+		return err
+	})
+	return job, err
+}
+
+// ListByOwner returns the owner's jobs, newest first
+func (s *BoltStore) ListByOwner(owner string) ([]*Job, error) {
+	result := make([]*Job, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(ownersBucket).Bucket([]byte(owner))
+		if index == nil {
+			return nil
+		}
+		return index.ForEach(func(id, _ []byte) error {
+			job, err := getJob(tx, string(id))
+			if err != nil {
+				return err
+			}
+			result = append(result, job)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result, nil
+}
+
+// SetResult records an item's outcome. A redelivered item that already has
+// a result keeps the first one, so counts never run past the total.
+func (s *BoltStore) SetResult(jobID string, result Result) (*Job, error) {
+	var updated *Job
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		job, err := getJob(tx, jobID)
+		if err != nil {
+			return err
+		}
+		results := tx.Bucket(resultsBucket).Bucket([]byte(jobID))
+		key := indexKey(result.Index)
+		if results.Get(key) != nil {
+			return nil
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("failed to marshal result: %v", err)
+		}
+		if err := results.Put(key, data); err != nil {
+			return err
+		}
+
+		switch result.Status {
+		case ItemSucceeded:
+			job.Succeeded++
+		case ItemCanceled:
+			job.Canceled++
+		default:
+			job.Failed++
+		}
+		job.Pending--
+
+		now := time.Now().UTC()
+		job.UpdatedAt = now
+		if job.Status == StatusQueued {
+			job.Status = StatusRunning
+		}
+		if job.Pending <= 0 {
+			job.Pending = 0
+			job.CompletedAt = &now
+			if job.Status != StatusCanceled {
+				job.Status = StatusCompleted
+			}
+		}
+		updated = job
+		return putJob(tx, job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Results returns the settled items of a job in index order
+func (s *BoltStore) Results(jobID string) ([]Result, error) {
+	list := make([]Result, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		results := tx.Bucket(resultsBucket).Bucket([]byte(jobID))
+		if results == nil {
+			return ErrNotFound
+		}
+		return results.ForEach(func(_, data []byte) error {
+			var result Result
+			if err := json.Unmarshal(data, &result); err != nil {
+				return fmt.Errorf("failed to parse result: %v", err)
+			}
+			list = append(list, result)
+			return nil
+		})
+	})
+	return list, err
+}
+
+// Cancel marks a job canceled; items still queued are settled as canceled
+// when a worker picks them up
+func (s *BoltStore) Cancel(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		job, err := getJob(tx, id)
+		if err != nil {
+			return err
+		}
+		if job.Status == StatusCompleted || job.Status == StatusCanceled {
+			return fmt.Errorf("job %s is already %s", id, job.Status)
+		}
+		job.Status = StatusCanceled
+		job.UpdatedAt = time.Now().UTC()
+		return putJob(tx, job)
+	})
+}
+
+// Close closes the database
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func getJob(tx *bolt.Tx, id string) (*Job, error) {
+	data := tx.Bucket(jobsBucket).Get([]byte(id))
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to parse job %s: %v", id, err)
+	}
+	return &job, nil
+}
+
+func putJob(tx *bolt.Tx, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %v", err)
+	}
+	return tx.Bucket(jobsBucket).Put([]byte(job.ID), data)
+}
+
+// indexKey orders results by item index
+func indexKey(index int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(index))
+	return key
+}
@@ -0,0 +1,103 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Job statuses. A canceled job stays canceled while its queued items drain.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusCanceled  = "canceled"
+)
+
+// Item outcomes
+const (
+	ItemSucceeded = "succeeded"
+	ItemFailed    = "failed"
+	ItemCanceled  = "canceled"
+)
+
+// Job is a batch of completions submitted by one address
+type Job struct {
+	ID      string `json:"id"`
+	Owner   string `json:"owner"`
+	Status  string `json:"status"`
+	Total   int    `json:"total"`
+	Pending int    `json:"pending"`
+	// Succeeded, Failed and Canceled count settled items
+	Succeeded   int        `json:"succeeded"`
+	Failed      int        `json:"failed"`
+	Canceled    int        `json:"canceled"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Item is one completion of a job, as queued for the workers
+type Item struct {
+	JobID    string `json:"job_id"`
+	Index    int    `json:"index"`
+	CustomID string `json:"custom_id,omitempty"`
+	Address  string `json:"address"`
+	// Owner and KeyName pick the key as on the completion endpoint
+	Owner       string   `json:"owner,omitempty"`
+	KeyName     string   `json:"key_name,omitempty"`
+	Model       string   `json:"model"`
+	Message     string   `json:"message"`
+	System      string   `json:"system,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	// Attempt counts deliveries of this item, from 1
+	Attempt int `json:"attempt"`
+}
+
+// Result is the settled outcome of an item
+type Result struct {
+	Index            int        `json:"index"`
+	CustomID         string     `json:"custom_id,omitempty"`
+	Status           string     `json:"status"`
+	Content          string     `json:"content,omitempty"`
+	Route            string     `json:"route,omitempty"`
+	PromptTokens     int        `json:"prompt_tokens,omitempty"`
+	CompletionTokens int        `json:"completion_tokens,omitempty"`
+	Attempts         int        `json:"attempts"`
+	Error            *ItemError `json:"error,omitempty"`
+	FinishedAt       time.Time  `json:"finished_at"`
+}
+
+// ItemError explains a failed item. Retryable failures are queued again
+// until the item runs out of attempts.
+type ItemError struct {
+	Type      string `json:"type"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"-"`
+}
+
+// Store persists jobs and their item results
+type Store interface {
+	Create(job *Job) error
+	Get(id string) (*Job, error)
+	ListByOwner(owner string) ([]*Job, error)
+	// SetResult records an item's outcome and returns the job with its
+	// counts updated, or nil if the item already had a result
+	SetResult(jobID string, result Result) (*Job, error)
+	// Results returns the settled items of a job in index order
+	Results(jobID string) ([]Result, error)
+	Cancel(id string) error
+	Close() error
+}
+
+// ErrNotFound is returned when a job ID is unknown
+var ErrNotFound = fmt.Errorf("job not found")
+
+// NewID returns a random job ID
+func NewID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
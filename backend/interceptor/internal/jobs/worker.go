@@ -0,0 +1,290 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interceptor/internal/metrics"
+	"interceptor/internal/rabbitmq"
+	"interceptor/pkg/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// maxRetryDelay caps the backoff between attempts of an item
+const maxRetryDelay = 10 * time.Minute
+
+var (
+	// errWorkerStopped cancels items that are running when the worker stops
+	errWorkerStopped = errors.New("job worker stopped")
+	// errJobCanceled cancels the running items of a canceled job
+	errJobCanceled = errors.New("job canceled")
+)
+
+// ProcessFunc runs one item and returns its outcome. A result whose error is
+// retryable is queued again while the item has attempts left.
+type ProcessFunc func(ctx context.Context, item Item) Result
+
+// Worker consumes job items from the work queue, several at a time
+type Worker struct {
+	store       Store
+	producer    *rabbitmq.Producer
+	consumer    *rabbitmq.Consumer
+	process     ProcessFunc
+	maxAttempts int
+	retryDelay  time.Duration
+
+	mu    sync.Mutex
+	hooks []func(*Job)
+	// running holds the cancel func of each item being processed, by job
+	// and item index
+	running map[string]map[int]context.CancelCauseFunc
+
+	// ctx is canceled with errWorkerStopped on Stop
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	// Set when the delivery channel closes; the worker never restarts
+	stopped atomic.Bool
+	workers sync.WaitGroup
+}
+
+// NewWorker starts concurrency goroutines consuming items. The producer
+// publishes to the same queue and is used to retry items.
+func NewWorker(store Store, producer *rabbitmq.Producer, consumer *rabbitmq.Consumer, process ProcessFunc, concurrency, maxAttempts int, retryDelay time.Duration) (*Worker, error) {
+	deliveries, err := consumer.ConsumeMessages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume job items: %v", err)
+	}
+
+	w := &Worker{
+		store:       store,
+		producer:    producer,
+		consumer:    consumer,
+		process:     process,
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+		running:     make(map[string]map[int]context.CancelCauseFunc),
+	}
+	w.ctx, w.cancel = context.WithCancelCause(context.Background())
+	for i := 0; i < concurrency; i++ {
+		w.workers.Add(1)
+		go w.run(deliveries)
+	}
+	return w, nil
+}
+
+// OnFinished registers a hook that runs once for each job, when its last
+// item settles
+func (w *Worker) OnFinished(hook func(*Job)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.hooks = append(w.hooks, hook)
+}
+
+// Finished runs the OnFinished hooks if job has just settled its last item
+func (w *Worker) Finished(job *Job) {
+	if job == nil || job.CompletedAt == nil {
+		return
+	}
+
+	w.mu.Lock()
+	hooks := append([]func(*Job){}, w.hooks...)
+	w.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(job)
+	}
+}
+
+// CancelJob cancels the items of a job this worker is processing. Items on
+// other instances see the job canceled when they next load it.
+func (w *Worker) CancelJob(jobID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, cancel := range w.running[jobID] {
+		cancel(errJobCanceled)
+	}
+}
+
+// track registers a running item so CancelJob can reach it
+func (w *Worker) track(item Item, cancel context.CancelCauseFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running[item.JobID] == nil {
+		w.running[item.JobID] = make(map[int]context.CancelCauseFunc)
+	}
+	w.running[item.JobID][item.Index] = cancel
+}
+
+func (w *Worker) untrack(item Item) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.running[item.JobID], item.Index)
+	if len(w.running[item.JobID]) == 0 {
+		delete(w.running, item.JobID)
+	}
+}
+
+// Enqueue publishes an item for the workers
+func (w *Worker) Enqueue(item Item) error {
+	return w.producer.PublishMessage(item)
+}
+
+func (w *Worker) run(deliveries <-chan amqp.Delivery) {
+	defer w.workers.Done()
+	defer w.stopped.Store(true)
+
+	for msg := range deliveries {
+		w.handle(msg)
+	}
+}
+
+// handle settles one delivery. Items are acked once their result is stored
+// or their retry is queued, so a crash redelivers them instead of losing them.
+func (w *Worker) handle(msg amqp.Delivery) {
+	var item Item
+	if err := json.Unmarshal(msg.Body, &item); err != nil {
+		logger.Error("Failed to unmarshal job item: %v", err)
+		msg.Ack(false)
+		return
+	}
+	if item.Attempt < 1 {
+		item.Attempt = 1
+	}
+	log := logger.With("job_id", item.JobID, "item", item.Index, "attempt", item.Attempt)
+
+	// Tracked before the job is loaded so a cancel cannot slip in between
+	ctx, cancel := context.WithCancelCause(w.ctx)
+	w.track(item, cancel)
+	defer w.untrack(item)
+	defer cancel(nil)
+
+	job, err := w.store.Get(item.JobID)
+	if err == ErrNotFound {
+		log.Warnw("dropping item of unknown job")
+		msg.Ack(false)
+		return
+	}
+	if err != nil {
+		log.Errorw("failed to load job", "error", err)
+		msg.Nack(false, true)
+		return
+	}
+
+	if job.Status == StatusCanceled {
+		w.settle(msg, log, item, Result{Status: ItemCanceled})
+		return
+	}
+
+	result := w.process(ctx, item)
+	switch context.Cause(ctx) {
+	case errJobCanceled:
+		w.settle(msg, log, item, Result{Status: ItemCanceled})
+		return
+	case errWorkerStopped:
+		// Another worker runs the item again from the start
+		log.Infow("requeuing job item cut short by shutdown")
+		msg.Nack(false, true)
+		return
+	}
+	if result.Error != nil && result.Error.Retryable && item.Attempt < w.maxAttempts {
+		w.retry(msg, log, item, result)
+		return
+	}
+	w.settle(msg, log, item, result)
+}
+
+// retry waits out the backoff, then queues the item again at the back of the
+// queue. On shutdown the delivery is requeued as it is instead.
+func (w *Worker) retry(msg amqp.Delivery, log *logger.CustomLogger, item Item, result Result) {
+	delay := w.backoff(item.Attempt)
+	log.Warnw("job item failed, retrying", "error", result.Error.Message, "delay", delay.String())
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-w.ctx.Done():
+		msg.Nack(false, true)
+		return
+	}
+
+	next := item
+	next.Attempt++
+	if err := w.Enqueue(next); err != nil {
+		log.Errorw("failed to requeue job item", "error", err)
+		w.settle(msg, log, item, result)
+		return
+	}
+	metrics.JobItems.WithLabelValues("retried").Inc()
+	msg.Ack(false)
+}
+
+// backoff doubles the retry delay with each attempt, up to maxRetryDelay
+func (w *Worker) backoff(attempt int) time.Duration {
+	delay := w.retryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// settle stores the item's final result
+func (w *Worker) settle(msg amqp.Delivery, log *logger.CustomLogger, item Item, result Result) {
+	result.Index = item.Index
+	result.CustomID = item.CustomID
+	result.Attempts = item.Attempt
+	result.FinishedAt = time.Now().UTC()
+	if result.Status == "" {
+		result.Status = ItemSucceeded
+		if result.Error != nil {
+			result.Status = ItemFailed
+		}
+	}
+
+	job, err := w.store.SetResult(item.JobID, result)
+	if err != nil {
+		log.Errorw("failed to store job item result", "error", err)
+		msg.Nack(false, true)
+		return
+	}
+	metrics.JobItems.WithLabelValues(result.Status).Inc()
+	msg.Ack(false)
+	w.Finished(job)
+}
+
+// Stop cancels the consumer, cuts short any retry backoff and cancels the
+// items being processed, which are requeued; Wait blocks until they are.
+func (w *Worker) Stop() error {
+	w.cancel(errWorkerStopped)
+	return w.consumer.Cancel()
+}
+
+// Check reports whether the item consumer is still running
+func (w *Worker) Check(ctx context.Context) error {
+	if w.stopped.Load() {
+		return fmt.Errorf("job consumer stopped")
+	}
+	return nil
+}
+
+// Wait blocks until every worker has settled its last delivery, or until ctx
+// is done
+func (w *Worker) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		w.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("job workers still running: %v", ctx.Err())
+	}
+}
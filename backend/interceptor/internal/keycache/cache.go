@@ -0,0 +1,233 @@
+package keycache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Entry is a resolved key as returned to callers. Key is the caller's own
+// copy, which it overwrites with Wipe once it has used the key.
+type Entry struct {
+	Key      []byte
+	Name     string
+	Provider string
+}
+
+// Wipe zeroes the key bytes
+func (e Entry) Wipe() {
+	wipe(e.Key)
+}
+
+// Stats reports cache effectiveness so TTL and size can be tuned
+type Stats struct {
+	Size          int     `json:"size"`
+	MaxEntries    int     `json:"max_entries"`
+	TTLSeconds    float64 `json:"ttl_seconds"`
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	HitRatio      float64 `json:"hit_ratio"`
+	Evictions     uint64  `json:"evictions"`
+	Expirations   uint64  `json:"expirations"`
+	Invalidations uint64  `json:"invalidations"`
+}
+
+type item struct {
+	lookup    string
+	address   string
+	key       []byte
+	name      string
+	provider  string
+	expiresAt time.Time
+}
+
+// Cache is a size-bounded LRU of resolved keys with a TTL. Key bytes are
+// overwritten whenever an entry leaves the cache.
+type Cache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	order      *list.List
+	items      map[string]*list.Element
+
+	hits          uint64
+	misses        uint64
+	evictions     uint64
+	expirations   uint64
+	invalidations uint64
+
+	stop chan struct{}
+}
+
+// New creates a cache and starts a janitor that purges expired entries
+func New(ttl time.Duration, maxEntries int) *Cache {
+	c := &Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+		stop:       make(chan struct{}),
+	}
+
+	if ttl > 0 {
+		go c.janitor()
+	}
+
+	return c
+}
+
+// Enabled reports whether the cache stores anything
+func (c *Cache) Enabled() bool {
+	return c.ttl > 0 && c.maxEntries > 0
+}
+
+func lookupKey(address, name, provider string) string {
+	return address + "\x00" + name + "\x00" + provider
+}
+
+// Get returns a copy of the cached key for an address, key name and
+// provider; the caller wipes it when done
+func (c *Cache) Get(address, name, provider string) (Entry, bool) {
+	if !c.Enabled() {
+		return Entry{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[lookupKey(address, name, provider)]
+	if !ok {
+		c.misses++
+		return Entry{}, false
+	}
+
+	it := el.Value.(*item)
+	if time.Now().After(it.expiresAt) {
+		c.remove(el)
+		c.expirations++
+		c.misses++
+		return Entry{}, false
+	}
+
+	c.order.MoveToFront(el)
+	c.hits++
+	return Entry{Key: append([]byte(nil), it.key...), Name: it.name, Provider: it.provider}, true
+}
+
+// Put caches a copy of a resolved key, evicting the least recently used entry
+// when full; the caller still owns and wipes entry.Key
+func (c *Cache) Put(address, name, provider string, entry Entry) {
+	if !c.Enabled() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lookup := lookupKey(address, name, provider)
+	if el, ok := c.items[lookup]; ok {
+		c.remove(el)
+	}
+
+	el := c.order.PushFront(&item{
+		lookup:    lookup,
+		address:   address,
+		key:       append([]byte(nil), entry.Key...),
+		name:      entry.Name,
+		provider:  entry.Provider,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+	c.items[lookup] = el
+
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+// InvalidateAddress drops every cached key for an address
+func (c *Cache) InvalidateAddress(address string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*item).address == address {
+			c.remove(el)
+			c.invalidations++
+		}
+		el = next
+	}
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := Stats{
+		Size:          c.order.Len(),
+		MaxEntries:    c.maxEntries,
+		TTLSeconds:    c.ttl.Seconds(),
+		Hits:          c.hits,
+		Misses:        c.misses,
+		Evictions:     c.evictions,
+		Expirations:   c.expirations,
+		Invalidations: c.invalidations,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRatio = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+// Close stops the janitor and wipes every entry
+func (c *Cache) Close() {
+	close(c.stop)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove unlinks an entry and zeroes its key bytes; callers must hold the lock
+func (c *Cache) remove(el *list.Element) {
+	it := el.Value.(*item)
+	wipe(it.key)
+	c.order.Remove(el)
+	delete(c.items, it.lookup)
+}
+
+// janitor purges expired entries so their bytes are wiped without waiting for a lookup
+func (c *Cache) janitor() {
+	ticker := time.NewTicker(c.ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			c.mu.Lock()
+			for el := c.order.Front(); el != nil; {
+				next := el.Next()
+				if now.After(el.Value.(*item).expiresAt) {
+					c.remove(el)
+					c.expirations++
+				}
+				el = next
+			}
+			c.mu.Unlock()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// wipe overwrites key bytes with zeroes
+func wipe(key []byte) {
+	for i := range key {
+		key[i] = 0
+	}
+}
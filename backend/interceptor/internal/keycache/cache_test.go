@@ -0,0 +1,69 @@
+package keycache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetReturnsACopyTheCallerWipes(t *testing.T) {
+	c := New(time.Minute, 10)
+	defer c.Close()
+
+	stored := []byte("sk-secret")
+	c.Put("0xabc", "work", "openai", Entry{Key: stored, Name: "work", Provider: "openai"})
+	// The cache keeps its own copy, so the caller may wipe what it put
+	Entry{Key: stored}.Wipe()
+
+	first, ok := c.Get("0xabc", "work", "openai")
+	if !ok || string(first.Key) != "sk-secret" {
+		t.Fatalf("first get: got %q, %v", first.Key, ok)
+	}
+	first.Wipe()
+	for _, b := range first.Key {
+		if b != 0 {
+			t.Fatalf("wiped key still holds %q", first.Key)
+		}
+	}
+
+	second, ok := c.Get("0xabc", "work", "openai")
+	if !ok || string(second.Key) != "sk-secret" {
+		t.Fatalf("wiping a returned copy changed the cached key: got %q", second.Key)
+	}
+}
+
+func TestRemovedEntriesAreZeroed(t *testing.T) {
+	c := New(time.Minute, 1)
+	defer c.Close()
+
+	c.Put("0xabc", "work", "openai", Entry{Key: []byte("sk-first")})
+	cached := c.items[lookupKey("0xabc", "work", "openai")].Value.(*item).key
+
+	// A second entry evicts the first from a one-entry cache
+	c.Put("0xdef", "work", "openai", Entry{Key: []byte("sk-second")})
+	for _, b := range cached {
+		if b != 0 {
+			t.Fatalf("evicted key still holds %q", cached)
+		}
+	}
+	if _, ok := c.Get("0xabc", "work", "openai"); ok {
+		t.Fatal("evicted entry is still served")
+	}
+	if stats := c.Stats(); stats.Evictions != 1 {
+		t.Fatalf("evictions: got %d, want 1", stats.Evictions)
+	}
+}
+
+func TestExpiredEntriesAreNotServed(t *testing.T) {
+	c := New(time.Minute, 10)
+	defer c.Close()
+
+	c.Put("0xabc", "", "openai", Entry{Key: []byte("sk-old")})
+	c.items[lookupKey("0xabc", "", "openai")].Value.(*item).expiresAt = time.Now().Add(-time.Second)
+
+	if _, ok := c.Get("0xabc", "", "openai"); ok {
+		t.Fatal("expired entry was served")
+	}
+	if stats := c.Stats(); stats.Expirations != 1 || stats.Misses != 1 {
+		t.Fatalf("stats: got %+v", stats)
+	}
+}
@@ -0,0 +1,329 @@
+package keyring
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interceptor/internal/metrics"
+	"interceptor/internal/middleware"
+	"interceptor/internal/rabbitmq"
+	"interceptor/pkg/logger"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Keyring actions understood by the solidity service
+const (
+	ActionGetKey    = "get_key"
+	ActionListKeys  = "list_keys"
+	ActionDeleteKey = "delete_key"
+	ActionRotateKey = "rotate_key"
+	ActionRevokeKey = "revoke_key"
+)
+
+// Request is the broker payload sent to the solidity service
+type Request struct {
+	ID       string `json:"id"`
+	Action   string `json:"action"`
+	Address  string `json:"address"`
+	Name     string `json:"name,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Key      string `json:"key,omitempty"`
+	// Issued is the RFC 3339 time an owner-signed request was signed
+	Issued    string `json:"issued,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// CorrelationID ties the solidity service's logs to the HTTP request
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// Entry is the metadata of one named key
+type Entry struct {
+	Name      string     `json:"name"`
+	Provider  string     `json:"provider"`
+	Default   bool       `json:"default"`
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Reply is the solidity service's answer to a Request
+type Reply struct {
+	ID       string  `json:"id"`
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Name     string  `json:"name,omitempty"`
+	Provider string  `json:"provider,omitempty"`
+	Key      string  `json:"key,omitempty"`
+	Keys     []Entry `json:"keys,omitempty"`
+}
+
+// ErrTimeout is returned when no reply arrives in time
+var ErrTimeout = fmt.Errorf("no reply from keyring within timeout")
+
+// envelope matches the JSON wrapping the producers put around every body
+type envelope struct {
+	Body string `json:"Body"`
+}
+
+// Client performs request/reply calls to the solidity keyring over the broker.
+// Replies are matched to callers by request ID, so concurrent calls are safe.
+type Client struct {
+	producer *rabbitmq.Producer
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	pending map[string]chan Reply
+	// retired maps fingerprints of retired keys to when they stop being
+	// remembered
+	retired    map[string]time.Time
+	retiredTTL time.Duration
+	hooks      []func(Event)
+
+	// Set when a consumer's delivery channel closes; neither restarts
+	repliesStopped atomic.Bool
+	eventsStopped  atomic.Bool
+	consumers      sync.WaitGroup
+}
+
+// NewClient starts consuming replies and returns a ready client. Retired key
+// fingerprints are remembered for retiredTTL, long enough for stale chain
+// reads and cached copies of the old values to have gone.
+func NewClient(producer *rabbitmq.Producer, consumer *rabbitmq.Consumer, timeout, retiredTTL time.Duration) (*Client, error) {
+	deliveries, err := consumer.ConsumeMessages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume keyring replies: %v", err)
+	}
+
+	c := &Client{
+		producer:   producer,
+		timeout:    timeout,
+		pending:    make(map[string]chan Reply),
+		retired:    make(map[string]time.Time),
+		retiredTTL: retiredTTL,
+	}
+	c.consumers.Add(1)
+	go c.dispatch(deliveries)
+
+	return c, nil
+}
+
+// ResolveKey fetches the key for address by name, or the provider default when name is empty
+func (c *Client) ResolveKey(ctx context.Context, address, name, provider string) (*Reply, error) {
+	reply, err := c.Do(ctx, Request{
+		Action:   ActionGetKey,
+		Address:  address,
+		Name:     name,
+		Provider: provider,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.IsRetired(reply.Key) {
+		return nil, ErrKeyRetired
+	}
+	return reply, nil
+}
+
+// RotateKey replaces a named key; the owner signs the rotate message,
+// which binds the new key by its fingerprint
+func (c *Client) RotateKey(ctx context.Context, address, name, key, issued, nonce, signature string) (*Reply, error) {
+	logger.RegisterSecret(key)
+	return c.Do(ctx, Request{
+		Action:    ActionRotateKey,
+		Address:   address,
+		Name:      name,
+		Key:       key,
+		Issued:    issued,
+		Nonce:     nonce,
+		Signature: signature,
+	})
+}
+
+// RevokeKey tombstones a named key; the owner must sign the revoke message
+func (c *Client) RevokeKey(ctx context.Context, address, name, issued, nonce, signature string) (*Reply, error) {
+	return c.Do(ctx, Request{
+		Action:    ActionRevokeKey,
+		Address:   address,
+		Name:      name,
+		Issued:    issued,
+		Nonce:     nonce,
+		Signature: signature,
+	})
+}
+
+// ListKeys returns the key metadata stored for address; the owner must sign
+// the list message
+func (c *Client) ListKeys(ctx context.Context, address, issued, nonce, signature string) (*Reply, error) {
+	return c.Do(ctx, Request{
+		Action:    ActionListKeys,
+		Address:   address,
+		Issued:    issued,
+		Nonce:     nonce,
+		Signature: signature,
+	})
+}
+
+// DeleteKey removes a named key; the owner must sign the delete message
+func (c *Client) DeleteKey(ctx context.Context, address, name, issued, nonce, signature string) (*Reply, error) {
+	return c.Do(ctx, Request{
+		Action:    ActionDeleteKey,
+		Address:   address,
+		Name:      name,
+		Issued:    issued,
+		Nonce:     nonce,
+		Signature: signature,
+	})
+}
+
+// Do publishes req and waits for the matching reply, for at most the client
+// timeout and never past ctx. A reply that arrives after ctx is done is dropped.
+func (c *Client) Do(ctx context.Context, req Request) (*Reply, error) {
+	req.ID = newRequestID()
+	req.CorrelationID = middleware.CorrelationID(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal keyring request: %v", err)
+	}
+
+	replyCh := make(chan Reply, 1)
+	c.mu.Lock()
+	c.pending[req.ID] = replyCh
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, req.ID)
+		c.mu.Unlock()
+	}()
+
+	if err := c.producer.PublishMessage(amqp.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to publish keyring request: %v", err)
+	}
+
+	start := time.Now()
+	select {
+	case reply := <-replyCh:
+		if reply.Status != "success" {
+			metrics.KeyLookupDuration.WithLabelValues(req.Action, metrics.OutcomeError).Observe(metrics.Since(start))
+			return &reply, fmt.Errorf("%s", reply.Error)
+		}
+		metrics.KeyLookupDuration.WithLabelValues(req.Action, metrics.OutcomeSuccess).Observe(metrics.Since(start))
+		return &reply, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			metrics.KeyLookupDuration.WithLabelValues(req.Action, metrics.OutcomeTimeout).Observe(metrics.Since(start))
+			return nil, ErrTimeout
+		}
+		metrics.KeyLookupDuration.WithLabelValues(req.Action, metrics.OutcomeCanceled).Observe(metrics.Since(start))
+		return nil, fmt.Errorf("keyring request abandoned: %w", context.Cause(ctx))
+	}
+}
+
+// dispatch routes each reply to the caller waiting on its ID
+func (c *Client) dispatch(deliveries <-chan amqp.Delivery) {
+	defer c.consumers.Done()
+	defer c.repliesStopped.Store(true)
+
+	for msg := range deliveries {
+		body, err := unwrap(msg.Body)
+		if err != nil {
+			logger.Error("Failed to decode keyring reply: %v", err)
+			msg.Ack(false)
+			continue
+		}
+
+		var reply Reply
+		if err := json.Unmarshal(body, &reply); err != nil {
+			logger.Error("Failed to unmarshal keyring reply: %v", err)
+			msg.Ack(false)
+			continue
+		}
+		msg.Ack(false)
+
+		// Mask the key in any log line from here on
+		if reply.Key != "" {
+			logger.RegisterSecret(reply.Key)
+		}
+
+		c.mu.Lock()
+		replyCh, ok := c.pending[reply.ID]
+		c.mu.Unlock()
+
+		if !ok {
+			logger.Warn("Dropping keyring reply %s with no waiting request", reply.ID)
+			continue
+		}
+		replyCh <- reply
+	}
+}
+
+// Check reports whether the reply and key event consumers are still running
+func (c *Client) Check(ctx context.Context) error {
+	if c.repliesStopped.Load() {
+		return fmt.Errorf("keyring reply consumer stopped")
+	}
+	if c.eventsStopped.Load() {
+		return fmt.Errorf("key event consumer stopped")
+	}
+	return nil
+}
+
+// Wait blocks until both consumers have handled their last delivery, which
+// happens once they are cancelled, or until ctx is done
+func (c *Client) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.consumers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("keyring consumers still running: %v", ctx.Err())
+	}
+}
+
+// unwrap peels the producer envelopes off a reply: the outer AMQP publishing
+// (base64 body) and the solidity service's RawMessage (plain body)
+func unwrap(body []byte) ([]byte, error) {
+	var outer envelope
+	if err := json.Unmarshal(body, &outer); err != nil {
+		return nil, err
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(outer.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var inner envelope
+	if err := json.Unmarshal(decoded, &inner); err == nil && strings.HasPrefix(strings.TrimSpace(inner.Body), "{") {
+		return []byte(inner.Body), nil
+	}
+	return decoded, nil
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,111 @@
+package keyring
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"interceptor/internal/rabbitmq"
+	"interceptor/pkg/logger"
+	"time"
+)
+
+// Key event types broadcast by the solidity service
+const (
+	EventKeyRotated = "key_rotated"
+	EventKeyRevoked = "key_revoked"
+	// EventKeyDefaultChanged names the key that became its provider's default
+	EventKeyDefaultChanged = "key_default_changed"
+)
+
+// Event reports that a stored key changed and copies of the old value must be dropped
+type Event struct {
+	Type        string    `json:"type"`
+	Address     string    `json:"address"`
+	Name        string    `json:"name"`
+	Provider    string    `json:"provider,omitempty"`
+	Version     int       `json:"version"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// ErrKeyRetired is returned when a resolved key was rotated out or revoked
+var ErrKeyRetired = fmt.Errorf("key has been rotated or revoked")
+
+// Fingerprint identifies a key value without revealing it
+func Fingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// OnEvent registers a hook that runs for every key event
+func (c *Client) OnEvent(hook func(Event)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, hook)
+}
+
+// WatchEvents consumes key events so retired keys stop being served at once,
+// even if a stale chain read still returns them
+func (c *Client) WatchEvents(consumer *rabbitmq.Consumer) error {
+	deliveries, err := consumer.ConsumeMessages()
+	if err != nil {
+		return fmt.Errorf("failed to consume key events: %v", err)
+	}
+
+	c.consumers.Add(1)
+	go func() {
+		defer c.consumers.Done()
+		defer c.eventsStopped.Store(true)
+
+		for msg := range deliveries {
+			msg.Ack(false)
+
+			body, err := unwrap(msg.Body)
+			if err != nil {
+				logger.Error("Failed to decode key event: %v", err)
+				continue
+			}
+
+			var event Event
+			if err := json.Unmarshal(body, &event); err != nil {
+				logger.Error("Failed to parse key event: %v", err)
+				continue
+			}
+
+			c.handleEvent(event)
+		}
+	}()
+
+	return nil
+}
+
+func (c *Client) handleEvent(event Event) {
+	logger.Info("Key event %s for %s/%s (version %d)", event.Type, event.Address, event.Name, event.Version)
+
+	now := time.Now()
+	c.mu.Lock()
+	for fingerprint, until := range c.retired {
+		if now.After(until) {
+			delete(c.retired, fingerprint)
+		}
+	}
+	if event.Fingerprint != "" {
+		c.retired[event.Fingerprint] = now.Add(c.retiredTTL)
+	}
+	hooks := append([]func(Event){}, c.hooks...)
+	c.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(event)
+	}
+}
+
+// IsRetired reports whether a key value was named in a rotation or
+// revocation within the retired TTL
+func (c *Client) IsRetired(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	until, ok := c.retired[Fingerprint(key)]
+	return ok && time.Now().Before(until)
+}
@@ -0,0 +1,32 @@
+package keyring
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetiredKeysExpire(t *testing.T) {
+	c := &Client{retired: make(map[string]time.Time), retiredTTL: time.Hour}
+
+	c.handleEvent(Event{Type: EventKeyRotated, Fingerprint: Fingerprint("sk-old")})
+	if !c.IsRetired("sk-old") {
+		t.Fatal("rotated key is not retired")
+	}
+	if c.IsRetired("sk-new") {
+		t.Fatal("unrelated key is retired")
+	}
+
+	// Past the TTL the fingerprint is no longer refused, and the next event
+	// drops it
+	c.retired[Fingerprint("sk-old")] = time.Now().Add(-time.Second)
+	if c.IsRetired("sk-old") {
+		t.Fatal("key still retired past the TTL")
+	}
+	c.handleEvent(Event{Type: EventKeyRevoked, Fingerprint: Fingerprint("sk-other")})
+	if _, ok := c.retired[Fingerprint("sk-old")]; ok {
+		t.Fatal("expired fingerprint was not dropped")
+	}
+	if len(c.retired) != 1 {
+		t.Fatalf("remembered %d fingerprints, want 1", len(c.retired))
+	}
+}
@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "interceptor"
+
+// Outcome label values
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+	OutcomeTimeout = "timeout"
+	// OutcomeCanceled marks calls abandoned because the client went away
+	OutcomeCanceled = "canceled"
+)
+
+// Settlement label values for consumed messages
+const (
+	SettleAck     = "ack"
+	SettleNack    = "nack"
+	SettleRequeue = "requeue"
+)
+
+var (
+	// HTTPRequests counts finished requests by route pattern, not raw path,
+	// so path parameters do not create new series
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	BrokerPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_published_total",
+		Help:      "Messages published by exchange and outcome.",
+	}, []string{"exchange", "outcome"})
+
+	BrokerConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_consumed_total",
+		Help:      "Messages delivered by queue.",
+	}, []string{"queue"})
+
+	BrokerSettled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_settled_total",
+		Help:      "Consumed messages by queue and settlement: ack, nack or requeue.",
+	}, []string{"queue", "result"})
+
+	BrokerQueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "broker_queue_wait_seconds",
+		Help:      "Time between publish and delivery, for messages carrying a timestamp.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60},
+	}, []string{"queue"})
+
+	KeyLookupDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "keyring_request_duration_seconds",
+		Help:      "Keyring round trips over the broker by action and outcome.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"action", "outcome"})
+
+	ProviderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_request_duration_seconds",
+		Help:      "LLM provider call latency by provider, model and outcome.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+	}, []string{"provider", "model", "outcome"})
+
+	ProviderTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_tokens_total",
+		Help:      "Tokens reported by providers by provider, model and kind: prompt or completion.",
+	}, []string{"provider", "model", "kind"})
+
+	ProviderRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_retries_total",
+		Help:      "Provider calls repeated after a retryable failure, by provider and failure kind.",
+	}, []string{"provider", "kind"})
+
+	RouteFailovers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "route_failovers_total",
+		Help:      "Requests moved to the next route of their chain, by the provider left and failure kind.",
+	}, []string{"provider", "kind"})
+
+	ResponseCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "response_cache_lookups_total",
+		Help:      "Completion cache lookups by result: hit or miss.",
+	}, []string{"result"})
+
+	ContextOverflows = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "context_overflows_total",
+		Help:      "Prompts over their model's context window by action: rejected or truncated.",
+	}, []string{"action"})
+
+	JobItems = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_items_total",
+		Help:      "Batch job items processed by outcome: succeeded, failed, canceled or retried.",
+	}, []string{"outcome"})
+
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts by event and outcome: delivered, retried or failed.",
+	}, []string{"event", "outcome"})
+
+	ChatConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "chat_connections",
+		Help:      "Open chat WebSocket connections.",
+	})
+
+	ChatTurns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chat_turns_total",
+		Help:      "Chat turns over WebSocket by outcome: done, canceled or error.",
+	}, []string{"outcome"})
+
+	ToolRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_runs_total",
+		Help:      "Server-side tool runs by tool and outcome.",
+	}, []string{"tool", "outcome"})
+)
+
+// Since returns the seconds elapsed since start, for Observe
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// Handler serves the default registry in the Prometheus text format
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package middleware
+
+import "net"
+
+// connClosed cannot tell without consuming data on this platform; requests
+// still end at their deadline
+func connClosed(conn net.Conn) bool {
+	return false
+}
@@ -0,0 +1,132 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrConfigRule is returned when the admin API tries to change a rule that
+// comes from the config file
+var ErrConfigRule = fmt.Errorf("policy is defined in the config file")
+
+// Limits are the effective caps for a request that passed every rule
+type Limits struct {
+	// MaxTokens is the tightest max_tokens cap, or 0 when none applies
+	MaxTokens int
+	// Overflow is reject if any rule says so, else truncate if one does, else empty
+	Overflow string
+}
+
+// Engine evaluates requests against config rules and rules edited through
+// the admin API. Config rules win on ID clashes.
+type Engine struct {
+	mu     sync.RWMutex
+	config map[string]*Rule
+	store  *FileStore
+}
+
+// NewEngine creates an engine over the stored rules and the config rules
+func NewEngine(store *FileStore, configRules []Rule) (*Engine, error) {
+	e := &Engine{store: store}
+	if err := e.SetConfigRules(configRules); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetConfigRules replaces the config rules, e.g. after a config reload
+func (e *Engine) SetConfigRules(rules []Rule) error {
+	config := make(map[string]*Rule, len(rules))
+	now := time.Now().UTC()
+	for i := range rules {
+		r := rules[i]
+		r.Normalize()
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("invalid policy %q: %v", r.ID, err)
+		}
+		if _, exists := config[r.ID]; exists {
+			return fmt.Errorf("duplicate policy %q", r.ID)
+		}
+		r.Source = SourceConfig
+		r.UpdatedAt = now
+		config[r.ID] = &r
+	}
+
+	e.mu.Lock()
+	e.config = config
+	e.mu.Unlock()
+	return nil
+}
+
+// Rules returns every rule, config rules first, each ordered by ID
+func (e *Engine) Rules() []*Rule {
+	e.mu.RLock()
+	result := make([]*Rule, 0, len(e.config))
+	for _, r := range e.config {
+		copied := *r
+		result = append(result, &copied)
+	}
+	e.mu.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	for _, r := range e.store.List() {
+		if !e.isConfigRule(r.ID) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// Put validates and stores a rule from the admin API
+func (e *Engine) Put(rule *Rule) error {
+	rule.Normalize()
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	if e.isConfigRule(rule.ID) {
+		return ErrConfigRule
+	}
+	rule.Source = SourceAPI
+	rule.UpdatedAt = time.Now().UTC()
+	return e.store.Put(rule)
+}
+
+// Delete removes a rule created through the admin API
+func (e *Engine) Delete(id string) error {
+	if e.isConfigRule(id) {
+		return ErrConfigRule
+	}
+	return e.store.Delete(id)
+}
+
+// Check evaluates req against every rule that applies to it and returns a
+// *Denial for the first violation
+func (e *Engine) Check(req Request) (Limits, error) {
+	var limits Limits
+	for _, rule := range e.Rules() {
+		if !rule.Applies(req) {
+			continue
+		}
+		if denial := rule.Evaluate(req); denial != nil {
+			return Limits{}, denial
+		}
+		if rule.MaxTokens > 0 && (limits.MaxTokens == 0 || rule.MaxTokens < limits.MaxTokens) {
+			limits.MaxTokens = rule.MaxTokens
+		}
+		if rule.Overflow == OverflowReject || (rule.Overflow != "" && limits.Overflow == "") {
+			limits.Overflow = rule.Overflow
+		}
+	}
+	return limits, nil
+}
+
+func (e *Engine) isConfigRule(id string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, ok := e.config[id]
+	return ok
+}
@@ -0,0 +1,180 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Sources of a rule. Config rules are reloaded with the config file and
+// cannot be edited through the admin API.
+const (
+	SourceConfig = "config"
+	SourceAPI    = "api"
+)
+
+// Overflow settings for prompts over the context window
+const (
+	OverflowReject   = "reject"
+	OverflowTruncate = "truncate"
+)
+
+// Rule restricts completion requests. A rule scoped to neither an address nor
+// a grant applies to every request; every rule that applies must pass.
+type Rule struct {
+	ID      string `json:"id"`
+	Address string `json:"address,omitempty"`
+	GrantID string `json:"grant_id,omitempty"`
+	// Models allowed; empty allows any, "*" is a wildcard
+	Models []string `json:"models,omitempty"`
+	// MaxTokens caps completion tokens; requests without max_tokens get the cap
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// MinTemperature and MaxTemperature bound temperature, which must then be set
+	MinTemperature *float64 `json:"min_temperature,omitempty"`
+	MaxTemperature *float64 `json:"max_temperature,omitempty"`
+	BannedTools    []string `json:"banned_tools,omitempty"`
+	// SystemPrefixes requires the system prompt to start with one of them
+	SystemPrefixes []string `json:"system_prefixes,omitempty"`
+	// Overflow is reject or truncate for prompts over the context window;
+	// empty keeps the service default
+	Overflow  string    `json:"overflow,omitempty"`
+	Source    string    `json:"source"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Request is what a rule sees of a completion request
+type Request struct {
+	Address     string
+	GrantID     string
+	Model       string
+	MaxTokens   int
+	Temperature *float64
+	Tools       []string
+	System      string
+}
+
+// Denial explains which rule refused a request and why
+type Denial struct {
+	RuleID string `json:"rule"`
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+func (d *Denial) Error() string {
+	return fmt.Sprintf("denied by policy %s: %s", d.RuleID, d.Reason)
+}
+
+// Normalize lowercases addresses, models and tool names so matching is case-insensitive
+func (r *Rule) Normalize() {
+	r.ID = strings.TrimSpace(r.ID)
+	r.Address = strings.ToLower(strings.TrimSpace(r.Address))
+	r.GrantID = strings.TrimSpace(r.GrantID)
+	r.Overflow = strings.ToLower(strings.TrimSpace(r.Overflow))
+	for i, model := range r.Models {
+		r.Models[i] = strings.ToLower(strings.TrimSpace(model))
+	}
+	for i, tool := range r.BannedTools {
+		r.BannedTools[i] = strings.ToLower(strings.TrimSpace(tool))
+	}
+}
+
+// Validate reports a rule that could never be satisfied or is ambiguous
+func (r *Rule) Validate() error {
+	if r.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if r.Address != "" && r.GrantID != "" {
+		return fmt.Errorf("a rule is scoped to an address or a grant, not both")
+	}
+	if r.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens must not be negative")
+	}
+	if r.MinTemperature != nil && r.MaxTemperature != nil && *r.MinTemperature > *r.MaxTemperature {
+		return fmt.Errorf("min_temperature must not exceed max_temperature")
+	}
+	if r.Overflow != "" && r.Overflow != OverflowReject && r.Overflow != OverflowTruncate {
+		return fmt.Errorf("overflow must be %s or %s", OverflowReject, OverflowTruncate)
+	}
+	return nil
+}
+
+// Applies reports whether the rule covers req
+func (r *Rule) Applies(req Request) bool {
+	switch {
+	case r.Address != "":
+		return r.Address == req.Address
+	case r.GrantID != "":
+		return r.GrantID == req.GrantID
+	default:
+		return true
+	}
+}
+
+// Evaluate checks req against the rule, returning the first violation
+func (r *Rule) Evaluate(req Request) *Denial {
+	deny := func(field, format string, args ...interface{}) *Denial {
+		return &Denial{RuleID: r.ID, Field: field, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if len(r.Models) > 0 && !r.allowsModel(req.Model) {
+		return deny("model", "model %s is not allowed; allowed models: %s", req.Model, strings.Join(r.Models, ", "))
+	}
+
+	if r.MaxTokens > 0 && req.MaxTokens > r.MaxTokens {
+		return deny("max_tokens", "max_tokens %d exceeds the limit of %d", req.MaxTokens, r.MaxTokens)
+	}
+
+	if r.MinTemperature != nil || r.MaxTemperature != nil {
+		if req.Temperature == nil {
+			return deny("temperature", "temperature must be set between %s", r.temperatureRange())
+		}
+		t := *req.Temperature
+		if (r.MinTemperature != nil && t < *r.MinTemperature) || (r.MaxTemperature != nil && t > *r.MaxTemperature) {
+			return deny("temperature", "temperature %g is outside %s", t, r.temperatureRange())
+		}
+	}
+
+	for _, tool := range req.Tools {
+		for _, banned := range r.BannedTools {
+			if strings.EqualFold(tool, banned) {
+				return deny("tools", "tool %s is not allowed", tool)
+			}
+		}
+	}
+
+	if len(r.SystemPrefixes) > 0 {
+		matched := false
+		for _, prefix := range r.SystemPrefixes {
+			if strings.HasPrefix(req.System, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return deny("system", "system prompt must start with one of the approved prefixes")
+		}
+	}
+
+	return nil
+}
+
+func (r *Rule) allowsModel(model string) bool {
+	model = strings.ToLower(model)
+	for _, allowed := range r.Models {
+		if allowed == "*" || allowed == model {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) temperatureRange() string {
+	low, high := "0", "2"
+	if r.MinTemperature != nil {
+		low = fmt.Sprintf("%g", *r.MinTemperature)
+	}
+	if r.MaxTemperature != nil {
+		high = fmt.Sprintf("%g", *r.MaxTemperature)
+	}
+	return low + " and " + high
+}
@@ -0,0 +1,113 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ErrNotFound is returned when a rule ID is unknown
+var ErrNotFound = fmt.Errorf("policy not found")
+
+// FileStore keeps rules edited through the admin API in a JSON file
+type FileStore struct {
+	mu    sync.RWMutex
+	path  string
+	rules map[string]*Rule
+}
+
+// NewFileStore loads rules from path, creating the file on first write
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path:  path,
+		rules: make(map[string]*Rule),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read policies file: %v", err)
+	}
+
+	var list []*Rule
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse policies file: %v", err)
+	}
+	for _, r := range list {
+		s.rules[r.ID] = r
+	}
+
+	return s, nil
+}
+
+// Put creates or replaces a rule
+func (s *FileStore) Put(rule *Rule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *rule
+	s.rules[rule.ID] = &copied
+
+	return s.save()
+}
+
+// Delete removes a rule
+func (s *FileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.rules, id)
+
+	return s.save()
+}
+
+// List returns every stored rule ordered by ID
+func (s *FileStore) List() []*Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*Rule, 0, len(s.rules))
+	for _, r := range s.rules {
+		copied := *r
+		result = append(result, &copied)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// save writes all rules to disk; callers must hold the write lock
+func (s *FileStore) save() error {
+	list := make([]*Rule, 0, len(s.rules))
+	for _, r := range s.rules {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal policies: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create policies directory: %v", err)
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated store
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write policies file: %v", err)
+	}
+	return os.Rename(tmp, s.path)
+}
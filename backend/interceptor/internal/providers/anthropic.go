@@ -0,0 +1,344 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interceptor/internal/tools"
+	"interceptor/pkg/logger"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// anthropicVersion is the Messages API version requests are written against
+const anthropicVersion = "2023-06-01"
+
+// Anthropic serves completions from the Messages API
+type Anthropic struct {
+	baseURL   string
+	maxTokens int
+}
+
+// NewAnthropic creates the Anthropic provider against baseURL (e.g.
+// https://api.anthropic.com). The API requires a cap on completion tokens.
+func NewAnthropic(baseURL string, maxTokens int) *Anthropic {
+	return &Anthropic{baseURL: strings.TrimRight(baseURL, "/"), maxTokens: maxTokens}
+}
+
+// Name returns the provider name used in routes and metrics
+func (a *Anthropic) Name() string {
+	return "anthropic"
+}
+
+// NeedsKey reports whether calls need a stored key
+func (a *Anthropic) NeedsKey() bool {
+	return true
+}
+
+// anthropicMessage holds plain text, or content blocks when it carries
+// tool calls or results
+type anthropicMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+// anthropicBlock is a content block: text, a tool_use call or the
+// tool_result answering one
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type anthropicRequest struct {
+	Model       string               `json:"model"`
+	MaxTokens   int                  `json:"max_tokens"`
+	System      string               `json:"system,omitempty"`
+	Messages    []anthropicMessage   `json:"messages"`
+	Temperature *float64             `json:"temperature,omitempty"`
+	Tools       []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Stream      bool                 `json:"stream,omitempty"`
+}
+
+// emptySchema stands in for a tool that takes no parameters; the API
+// requires a schema
+var emptySchema = json.RawMessage(`{"type":"object","properties":{}}`)
+
+type anthropicResponse struct {
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// anthropicEvent is one event of a streamed reply: message_start carries the
+// input tokens, content_block_start opens a tool call, content_block_delta
+// carries text or call arguments and message_delta the output tokens and stop
+// reason
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+	Index        int            `json:"index"`
+	ContentBlock anthropicBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Type string `json:"type"`
+	} `json:"error"`
+}
+
+// Complete sends the prompt as a user message after any history. The
+// request's max_tokens replaces the provider cap when set. Tool calls go as
+// tool_use blocks of the assistant and tool results as tool_result blocks of
+// a user message.
+func (a *Anthropic) Complete(ctx context.Context, key []byte, req Request) (Completion, error) {
+	maxTokens := a.maxTokens
+	if req.MaxTokens > 0 {
+		maxTokens = req.MaxTokens
+	}
+
+	messages := anthropicMessages(req.History)
+	if req.Prompt != "" || len(req.History) == 0 {
+		messages = append(messages, anthropicMessage{Role: "user", Content: req.Prompt})
+	}
+
+	payload := anthropicRequest{
+		Model:       req.Model,
+		MaxTokens:   maxTokens,
+		System:      req.System,
+		Messages:    messages,
+		Temperature: req.Temperature,
+		Stream:      req.OnDelta != nil,
+	}
+	for _, definition := range req.Tools {
+		schema := definition.Parameters
+		if len(schema) == 0 {
+			schema = emptySchema
+		}
+		payload.Tools = append(payload.Tools, anthropicTool{Name: definition.Name, Description: definition.Description, InputSchema: schema})
+	}
+	if len(req.Tools) > 0 {
+		payload.ToolChoice = anthropicChoice(req.ToolChoice)
+	}
+	jsonBody, err := json.Marshal(payload)
+	if err != nil {
+		return Completion{}, fmt.Errorf("failed to marshal anthropic request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/v1/messages", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return Completion{}, fmt.Errorf("failed to create anthropic request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Api-Key", string(key))
+	httpReq.Header.Set("Anthropic-Version", anthropicVersion)
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return Completion{}, TransportError(a.Name(), ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if req.OnDelta != nil && resp.StatusCode == http.StatusOK {
+		return a.stream(ctx, resp, req.OnDelta)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Completion{}, TransportError(a.Name(), ctx, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error("anthropic request failed with status %d: %s", resp.StatusCode, string(body))
+		return Completion{}, AnthropicError(resp.StatusCode, resp.Header, body)
+	}
+
+	var parsed anthropicResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return Completion{}, &Error{Provider: a.Name(), Kind: KindServer, Status: resp.StatusCode, Message: "malformed response body"}
+	}
+
+	var completion Completion
+	var text strings.Builder
+	for _, block := range parsed.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			completion.ToolCalls = append(completion.ToolCalls, tools.Call{ID: block.ID, Name: block.Name, Arguments: string(block.Input)})
+		}
+	}
+	if text.Len() == 0 && parsed.StopReason == "refusal" {
+		return Completion{}, &Error{Provider: a.Name(), Kind: KindContentFilter, Status: resp.StatusCode, Code: "refusal", Message: "completion was refused"}
+	}
+
+	completion.Content = text.String()
+	completion.PromptTokens = parsed.Usage.InputTokens
+	completion.CompletionTokens = parsed.Usage.OutputTokens
+	return completion, nil
+}
+
+// stream reads a streamed reply, passing each piece of text to onDelta
+func (a *Anthropic) stream(ctx context.Context, resp *http.Response, onDelta func(string)) (Completion, error) {
+	var completion Completion
+	var text strings.Builder
+	var stopReason string
+	// Tool calls by content block index; their input arrives as JSON pieces
+	var calls []tools.Call
+	callAt := make(map[int]int)
+
+	err := readEvents(resp.Body, func(_, data string) error {
+		var event anthropicEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return &Error{Provider: a.Name(), Kind: KindServer, Status: resp.StatusCode, Message: "malformed stream event"}
+		}
+		switch event.Type {
+		case "message_start":
+			completion.PromptTokens = event.Message.Usage.InputTokens
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				callAt[event.Index] = len(calls)
+				calls = append(calls, tools.Call{ID: event.ContentBlock.ID, Name: event.ContentBlock.Name})
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				if event.Delta.Text != "" {
+					text.WriteString(event.Delta.Text)
+					onDelta(event.Delta.Text)
+				}
+			case "input_json_delta":
+				if i, ok := callAt[event.Index]; ok {
+					calls[i].Arguments += event.Delta.PartialJSON
+				}
+			}
+		case "message_delta":
+			completion.CompletionTokens = event.Usage.OutputTokens
+			stopReason = event.Delta.StopReason
+		case "message_stop":
+			return errStreamDone
+		case "error":
+			// The error event has the shape of an error response body
+			return AnthropicError(streamErrorStatus(event.Error.Type), http.Header{}, []byte(data))
+		}
+		return nil
+	})
+	if err != nil && err != errStreamDone {
+		var providerErr *Error
+		if errors.As(err, &providerErr) {
+			return Completion{}, err
+		}
+		return Completion{}, TransportError(a.Name(), ctx, err)
+	}
+
+	if text.Len() == 0 && stopReason == "refusal" {
+		return Completion{}, &Error{Provider: a.Name(), Kind: KindContentFilter, Status: resp.StatusCode, Code: "refusal", Message: "completion was refused"}
+	}
+	for i := range calls {
+		// A call without parameters streams no input at all
+		if calls[i].Arguments == "" {
+			calls[i].Arguments = "{}"
+		}
+	}
+	completion.Content = text.String()
+	completion.ToolCalls = calls
+	return completion, nil
+}
+
+// anthropicMessages converts history into messages, turning tool calls into
+// tool_use blocks and each run of tool results into one user message of
+// tool_result blocks, as the API expects
+func anthropicMessages(history []Message) []anthropicMessage {
+	messages := make([]anthropicMessage, 0, len(history)+1)
+	for _, m := range history {
+		switch {
+		case m.Role == RoleTool:
+			result := anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content}
+			if last := len(messages) - 1; last >= 0 {
+				if blocks, ok := messages[last].Content.([]anthropicBlock); ok && messages[last].Role == "user" && blocks[0].Type == "tool_result" {
+					messages[last].Content = append(blocks, result)
+					continue
+				}
+			}
+			messages = append(messages, anthropicMessage{Role: "user", Content: []anthropicBlock{result}})
+		case len(m.ToolCalls) > 0:
+			blocks := make([]anthropicBlock, 0, len(m.ToolCalls)+1)
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, call := range m.ToolCalls {
+				input := json.RawMessage(call.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Name, Input: input})
+			}
+			messages = append(messages, anthropicMessage{Role: m.Role, Content: blocks})
+		default:
+			messages = append(messages, anthropicMessage{Role: m.Role, Content: m.Content})
+		}
+	}
+	return messages
+}
+
+// anthropicChoice maps a tool choice onto the API's: required is any, and a
+// tool name is that tool
+func anthropicChoice(choice string) *anthropicToolChoice {
+	switch choice {
+	case "":
+		return nil
+	case tools.ChoiceAuto, tools.ChoiceNone:
+		return &anthropicToolChoice{Type: choice}
+	case tools.ChoiceRequired:
+		return &anthropicToolChoice{Type: "any"}
+	default:
+		return &anthropicToolChoice{Type: "tool", Name: choice}
+	}
+}
+
+// streamErrorStatus maps the type of an error sent mid-stream onto the status
+// the same error has as a response
+func streamErrorStatus(errorType string) int {
+	switch errorType {
+	case "overloaded_error":
+		return 529
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,247 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind classifies a provider failure independently of the provider
+type Kind string
+
+// Failure kinds, stable for clients to switch on
+const (
+	KindAuth          Kind = "auth"
+	KindRateLimit     Kind = "rate_limit"
+	KindQuota         Kind = "quota_exceeded"
+	KindContextLength Kind = "context_length"
+	KindContentFilter Kind = "content_filter"
+	KindBadRequest    Kind = "bad_request"
+	KindServer        Kind = "server_error"
+	KindTimeout       Kind = "timeout"
+)
+
+// Error is a classified failure from an LLM provider
+type Error struct {
+	Provider string
+	Kind     Kind
+	// Status is the provider's HTTP status, or 0 when no response arrived
+	Status int
+	// Code is the provider's own error code, when it sent one
+	Code    string
+	Message string
+	// RetryAfter is the provider's hint for when to try again, or 0
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Status != 0 {
+		return fmt.Sprintf("%s %s (status %d): %s", e.Provider, e.Kind, e.Status, e.Message)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Provider, e.Kind, e.Message)
+}
+
+// HTTPStatus is the status to answer the client with. The provider's status
+// is not passed through: a 401 from the provider means the stored key is bad,
+// not the client's credentials, and a 500 there is a bad gateway here.
+func (e *Error) HTTPStatus() int {
+	switch e.Kind {
+	case KindAuth:
+		return http.StatusFailedDependency
+	case KindRateLimit:
+		return http.StatusTooManyRequests
+	case KindQuota:
+		return http.StatusPaymentRequired
+	case KindContextLength:
+		return http.StatusRequestEntityTooLarge
+	case KindContentFilter:
+		return http.StatusUnprocessableEntity
+	case KindBadRequest:
+		return http.StatusBadRequest
+	case KindTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// Retryable reports whether the same call may succeed if repeated
+func (e *Error) Retryable() bool {
+	return e.Kind == KindRateLimit || e.Kind == KindServer || e.Kind == KindTimeout
+}
+
+// Failover reports whether another key, model or provider may succeed where
+// this one failed. Requests the provider judged bad fail the same way anywhere.
+func (e *Error) Failover() bool {
+	return e.Kind != KindBadRequest && e.Kind != KindContentFilter
+}
+
+// Body is the stable JSON error object returned to clients
+type Body struct {
+	Type           Kind   `json:"type"`
+	Provider       string `json:"provider"`
+	Code           string `json:"code,omitempty"`
+	UpstreamStatus int    `json:"upstream_status,omitempty"`
+	// RetryAfter is in whole seconds, rounded up
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// Body returns the client-facing description of e
+func (e *Error) Body() Body {
+	return Body{
+		Type:           e.Kind,
+		Provider:       e.Provider,
+		Code:           e.Code,
+		UpstreamStatus: e.Status,
+		RetryAfter:     retryAfterSeconds(e.RetryAfter),
+	}
+}
+
+// RetryAfterHeader is the Retry-After value to send, or "" for none
+func (e *Error) RetryAfterHeader() string {
+	if e.RetryAfter <= 0 {
+		return ""
+	}
+	return strconv.Itoa(retryAfterSeconds(e.RetryAfter))
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// openAIError is the error body OpenAI sends with non-200 responses
+type openAIError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    any    `json:"code"`
+	} `json:"error"`
+}
+
+// OpenAIError classifies a non-200 OpenAI response
+func OpenAIError(status int, header http.Header, body []byte) *Error {
+	e := &Error{
+		Provider:   "openai",
+		Status:     status,
+		Message:    http.StatusText(status),
+		RetryAfter: ParseRetryAfter(header, time.Now()),
+	}
+
+	var parsed openAIError
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Error.Message != "" {
+		e.Message = parsed.Error.Message
+		// The code is a string, but has been seen as a number or null
+		if parsed.Error.Code != nil {
+			e.Code = fmt.Sprint(parsed.Error.Code)
+		}
+		if e.Code == "" {
+			e.Code = parsed.Error.Type
+		}
+	}
+
+	code := strings.ToLower(e.Code + " " + parsed.Error.Type)
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		e.Kind = KindAuth
+	case strings.Contains(code, "insufficient_quota"):
+		e.Kind = KindQuota
+	case status == http.StatusTooManyRequests:
+		e.Kind = KindRateLimit
+	case strings.Contains(code, "context_length"):
+		e.Kind = KindContextLength
+	case strings.Contains(code, "content_filter") || strings.Contains(code, "content_policy"):
+		e.Kind = KindContentFilter
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		e.Kind = KindTimeout
+	case status >= http.StatusInternalServerError:
+		e.Kind = KindServer
+	default:
+		e.Kind = KindBadRequest
+	}
+	return e
+}
+
+// anthropicError is the error body the Anthropic API sends
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// AnthropicError classifies a non-200 Anthropic response
+func AnthropicError(status int, header http.Header, body []byte) *Error {
+	e := &Error{
+		Provider:   "anthropic",
+		Status:     status,
+		Message:    http.StatusText(status),
+		RetryAfter: ParseRetryAfter(header, time.Now()),
+	}
+
+	var parsed anthropicError
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Error.Type != "" {
+		e.Code = parsed.Error.Type
+		e.Message = parsed.Error.Message
+	}
+
+	// Quota and context length share invalid_request_error with plain bad
+	// requests; only the message tells them apart
+	message := strings.ToLower(e.Message)
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		e.Kind = KindAuth
+	case status == http.StatusTooManyRequests:
+		e.Kind = KindRateLimit
+	case strings.Contains(message, "credit balance"):
+		e.Kind = KindQuota
+	case status == http.StatusRequestEntityTooLarge || strings.Contains(message, "prompt is too long"):
+		e.Kind = KindContextLength
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		e.Kind = KindTimeout
+	case status >= http.StatusInternalServerError:
+		// Including 529, overloaded
+		e.Kind = KindServer
+	default:
+		e.Kind = KindBadRequest
+	}
+	return e
+}
+
+// TransportError classifies a request that got no response. A cancelled
+// context is returned as is, since nobody is left to answer.
+func TransportError(provider string, ctx context.Context, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return &Error{Provider: provider, Kind: KindTimeout, Message: "no response before the deadline"}
+	case ctx.Err() != nil:
+		return context.Cause(ctx)
+	}
+	return &Error{Provider: provider, Kind: KindServer, Message: err.Error()}
+}
+
+// ParseRetryAfter reads a Retry-After header in seconds or as an HTTP date,
+// falling back to OpenAI's retry-after-ms. It returns 0 when there is no hint.
+func ParseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if at, err := http.ParseTime(value); err == nil && at.After(now) {
+			return at.Sub(now)
+		}
+	}
+	if value := header.Get("Retry-After-Ms"); value != "" {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,41 @@
+package providers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestErrorClassificationAndStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        *Error
+		wantKind   Kind
+		wantStatus int
+	}{
+		{"openai bad key", OpenAIError(http.StatusUnauthorized, http.Header{}, []byte(`{"error":{"message":"Incorrect API key","code":"invalid_api_key"}}`)), KindAuth, http.StatusFailedDependency},
+		{"anthropic forbidden", AnthropicError(http.StatusForbidden, http.Header{}, []byte(`{"error":{"type":"permission_error","message":"no access"}}`)), KindAuth, http.StatusFailedDependency},
+		{"openai quota", OpenAIError(http.StatusTooManyRequests, http.Header{}, []byte(`{"error":{"message":"quota","code":"insufficient_quota"}}`)), KindQuota, http.StatusPaymentRequired},
+		{"openai rate limit", OpenAIError(http.StatusTooManyRequests, http.Header{}, []byte(`{"error":{"message":"slow down","code":"rate_limit_exceeded"}}`)), KindRateLimit, http.StatusTooManyRequests},
+		{"anthropic credit", AnthropicError(http.StatusBadRequest, http.Header{}, []byte(`{"error":{"type":"invalid_request_error","message":"Your credit balance is too low"}}`)), KindQuota, http.StatusPaymentRequired},
+		{"anthropic overloaded", AnthropicError(529, http.Header{}, []byte(`{"error":{"type":"overloaded_error","message":"Overloaded"}}`)), KindServer, http.StatusBadGateway},
+		{"openai context", OpenAIError(http.StatusBadRequest, http.Header{}, []byte(`{"error":{"message":"too long","code":"context_length_exceeded"}}`)), KindContextLength, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err.Kind != tt.wantKind {
+				t.Fatalf("kind: got %s, want %s", tt.err.Kind, tt.wantKind)
+			}
+			if got := tt.err.HTTPStatus(); got != tt.wantStatus {
+				t.Fatalf("status: got %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// A rejected stored key must not read as the client's own credentials failing
+func TestAuthFailureIsNotUnauthorized(t *testing.T) {
+	err := &Error{Provider: "openai", Kind: KindAuth, Status: http.StatusUnauthorized}
+	if status := err.HTTPStatus(); status == http.StatusUnauthorized || status == http.StatusForbidden {
+		t.Fatalf("auth failure answered with %d", status)
+	}
+}
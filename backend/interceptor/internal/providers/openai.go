@@ -0,0 +1,306 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interceptor/internal/tools"
+	"interceptor/pkg/logger"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAI serves completions from the chat completions API, or from any
+// server that speaks it, such as a self-hosted model
+type OpenAI struct {
+	name    string
+	baseURL string
+	keyless bool
+}
+
+// NewOpenAI creates the OpenAI provider against baseURL (e.g. https://api.openai.com/v1)
+func NewOpenAI(baseURL string) *OpenAI {
+	return &OpenAI{name: "openai", baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// NewLocal creates a keyless provider for an OpenAI-compatible server at
+// baseURL (e.g. http://localhost:11434/v1)
+func NewLocal(baseURL string) *OpenAI {
+	return &OpenAI{name: "local", baseURL: strings.TrimRight(baseURL, "/"), keyless: true}
+}
+
+// Name returns the provider name used in routes and metrics
+func (o *OpenAI) Name() string {
+	return o.name
+}
+
+// NeedsKey reports whether calls need a stored key
+func (o *OpenAI) NeedsKey() bool {
+	return !o.keyless
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	// Index orders the calls of a streamed reply, whose pieces arrive apart
+	Index    int    `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+type openAIRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+	Tools       []openAITool    `json:"tools,omitempty"`
+	// ToolChoice is a choice string or the function the model must call
+	ToolChoice interface{} `json:"tool_choice,omitempty"`
+	// Stream asks for the reply as server-sent events, with usage in the last
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// openAIChunk is one event of a streamed reply. Usage arrives in a final
+// event with no choices.
+type openAIChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string           `json:"content"`
+			ToolCalls []openAIToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Complete sends the prompt as a user message after the system prompt and
+// history, if any
+func (o *OpenAI) Complete(ctx context.Context, key []byte, req Request) (Completion, error) {
+	messages := make([]openAIMessage, 0, len(req.History)+2)
+	if req.System != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.History {
+		message := openAIMessage{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, call := range m.ToolCalls {
+			message.ToolCalls = append(message.ToolCalls, openAICall(call))
+		}
+		messages = append(messages, message)
+	}
+	if req.Prompt != "" || len(req.History) == 0 {
+		messages = append(messages, openAIMessage{Role: "user", Content: req.Prompt})
+	}
+
+	payload := openAIRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+	}
+	for _, definition := range req.Tools {
+		tool := openAITool{Type: "function"}
+		tool.Function.Name = definition.Name
+		tool.Function.Description = definition.Description
+		tool.Function.Parameters = definition.Parameters
+		payload.Tools = append(payload.Tools, tool)
+	}
+	if len(req.Tools) > 0 {
+		payload.ToolChoice = openAIToolChoice(req.ToolChoice)
+	}
+	if req.OnDelta != nil {
+		payload.Stream = true
+		payload.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	jsonBody, err := json.Marshal(payload)
+	if err != nil {
+		return Completion{}, fmt.Errorf("failed to marshal %s request: %v", o.name, err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/chat/completions", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return Completion{}, fmt.Errorf("failed to create %s request: %v", o.name, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if len(key) > 0 {
+		httpReq.Header.Set("Authorization", "Bearer "+string(key))
+	}
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return Completion{}, TransportError(o.name, ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if req.OnDelta != nil && resp.StatusCode == http.StatusOK {
+		return o.stream(ctx, resp, req.OnDelta)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Completion{}, TransportError(o.name, ctx, err)
+	}
+
+	// Classify anything but a 200 so the caller can retry or fail over
+	if resp.StatusCode != http.StatusOK {
+		logger.Error("%s request failed with status %d: %s", o.name, resp.StatusCode, string(body))
+		providerErr := OpenAIError(resp.StatusCode, resp.Header, body)
+		providerErr.Provider = o.name
+		return Completion{}, providerErr
+	}
+
+	var parsed openAIResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return Completion{}, &Error{Provider: o.name, Kind: KindServer, Status: resp.StatusCode, Message: "malformed response body"}
+	}
+	if len(parsed.Choices) == 0 {
+		return Completion{}, &Error{Provider: o.name, Kind: KindServer, Status: resp.StatusCode, Message: "response has no choices"}
+	}
+
+	choice := parsed.Choices[0]
+	if choice.FinishReason == "content_filter" && choice.Message.Content == "" {
+		return Completion{}, &Error{Provider: o.name, Kind: KindContentFilter, Status: resp.StatusCode, Code: "content_filter", Message: "completion was withheld by the content filter"}
+	}
+
+	completion := Completion{
+		Content:          choice.Message.Content,
+		PromptTokens:     parsed.Usage.PromptTokens,
+		CompletionTokens: parsed.Usage.CompletionTokens,
+	}
+	for _, call := range choice.Message.ToolCalls {
+		completion.ToolCalls = append(completion.ToolCalls, tools.Call{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+	}
+	return completion, nil
+}
+
+// stream reads a streamed reply, passing each piece of content to onDelta.
+// Servers that ignore include_usage leave the token counts at 0.
+func (o *OpenAI) stream(ctx context.Context, resp *http.Response, onDelta func(string)) (Completion, error) {
+	var completion Completion
+	var content strings.Builder
+	var finishReason string
+	// Calls arrive in pieces keyed by index: the ID and name first, then
+	// the arguments a fragment at a time
+	var calls []tools.Call
+
+	err := readEvents(resp.Body, func(_, data string) error {
+		if data == "[DONE]" {
+			return errStreamDone
+		}
+		var chunk openAIChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return &Error{Provider: o.name, Kind: KindServer, Status: resp.StatusCode, Message: "malformed stream event"}
+		}
+		if chunk.Error != nil {
+			return &Error{Provider: o.name, Kind: KindServer, Status: resp.StatusCode, Message: chunk.Error.Message}
+		}
+		if chunk.Usage != nil {
+			completion.PromptTokens = chunk.Usage.PromptTokens
+			completion.CompletionTokens = chunk.Usage.CompletionTokens
+		}
+		if len(chunk.Choices) > 0 {
+			choice := chunk.Choices[0]
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				onDelta(choice.Delta.Content)
+			}
+			for _, piece := range choice.Delta.ToolCalls {
+				for len(calls) <= piece.Index {
+					calls = append(calls, tools.Call{})
+				}
+				call := &calls[piece.Index]
+				if piece.ID != "" {
+					call.ID = piece.ID
+				}
+				if piece.Function.Name != "" {
+					call.Name = piece.Function.Name
+				}
+				call.Arguments += piece.Function.Arguments
+			}
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errStreamDone {
+		var providerErr *Error
+		if errors.As(err, &providerErr) {
+			return Completion{}, err
+		}
+		return Completion{}, TransportError(o.name, ctx, err)
+	}
+
+	if finishReason == "content_filter" && content.Len() == 0 {
+		return Completion{}, &Error{Provider: o.name, Kind: KindContentFilter, Status: resp.StatusCode, Code: "content_filter", Message: "completion was withheld by the content filter"}
+	}
+	completion.Content = content.String()
+	completion.ToolCalls = calls
+	return completion, nil
+}
+
+// openAICall renders a tool call in the chat completions shape
+func openAICall(call tools.Call) openAIToolCall {
+	rendered := openAIToolCall{ID: call.ID, Type: "function"}
+	rendered.Function.Name = call.Name
+	rendered.Function.Arguments = call.Arguments
+	if rendered.Function.Arguments == "" {
+		rendered.Function.Arguments = "{}"
+	}
+	return rendered
+}
+
+// openAIToolChoice renders a tool choice: the choices are sent as they are,
+// a tool name as the function the model must call
+func openAIToolChoice(choice string) interface{} {
+	switch choice {
+	case "":
+		return nil
+	case tools.ChoiceAuto, tools.ChoiceNone, tools.ChoiceRequired:
+		return choice
+	default:
+		return map[string]interface{}{"type": "function", "function": map[string]string{"name": choice}}
+	}
+}
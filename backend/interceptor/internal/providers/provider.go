@@ -0,0 +1,66 @@
+package providers
+
+import (
+	"context"
+	"interceptor/internal/tools"
+	"net/http"
+)
+
+// RoleTool is the role of a message carrying a tool's result
+const RoleTool = "tool"
+
+// Message is one earlier turn of a conversation
+type Message struct {
+	Role    string
+	Content string
+	// ToolCalls are the calls an assistant message made
+	ToolCalls []tools.Call
+	// ToolCallID names the call a tool message answers
+	ToolCallID string
+}
+
+// Request is one completion call, independent of the provider serving it
+type Request struct {
+	Model string
+	// History holds earlier turns, oldest first, sent before Prompt
+	History []Message
+	// Prompt is sent as a user message; it may be empty when History ends
+	// with tool results
+	Prompt string
+	// Temperature is left to the provider's default when nil
+	Temperature *float64
+	// MaxTokens caps the completion; 0 leaves the provider's default
+	MaxTokens int
+	// System is sent as the system prompt when set
+	System string
+	// Tools the model may call, and ToolChoice one of the tools choices or
+	// a tool name; empty leaves the choice to the model
+	Tools      []tools.Definition
+	ToolChoice string
+	// OnDelta, when set, streams the reply: it is called with each piece of
+	// text as the provider sends it, and the whole reply is still returned
+	OnDelta func(delta string)
+}
+
+// Completion is a provider's answer with the tokens it billed
+type Completion struct {
+	Content string
+	// ToolCalls are set when the model asks for tools to run
+	ToolCalls        []tools.Call
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Provider serves completions for one LLM vendor. Failures with a response
+// are returned as *Error so they can be retried or failed over.
+type Provider interface {
+	Name() string
+	// NeedsKey is false for self-hosted models that take no stored key
+	NeedsKey() bool
+	// Complete must not keep key past the call; the router wipes it after
+	Complete(ctx context.Context, key []byte, req Request) (Completion, error)
+}
+
+// httpClient is shared so connections to providers are reused; each call is
+// bounded by its context rather than a client timeout
+var httpClient = &http.Client{}
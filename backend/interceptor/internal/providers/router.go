@@ -0,0 +1,270 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"interceptor/internal/metrics"
+	"interceptor/internal/middleware"
+	"interceptor/internal/usage"
+	"interceptor/pkg/logger"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// Route is one step of a failover chain
+type Route struct {
+	Provider string
+	Model    string
+	// Key names the owner's key to use; empty means the provider default
+	Key string
+}
+
+// String renders the route as provider/model, as sent in response headers
+func (r Route) String() string {
+	return r.Provider + "/" + r.Model
+}
+
+// Credential is the stored key resolved for a route. Key is the router's to
+// wipe once the route's calls are done.
+type Credential struct {
+	Key  []byte
+	Name string
+}
+
+// Wipe zeroes the key bytes
+func (c Credential) Wipe() {
+	for i := range c.Key {
+		c.Key[i] = 0
+	}
+}
+
+// KeyFunc resolves the key a route should use. An error skips the route,
+// so an owner without a key for a fallback provider just has a shorter chain.
+type KeyFunc func(ctx context.Context, route Route) (Credential, error)
+
+// RetryPolicy bounds retries of one route before failing over to the next
+type RetryPolicy struct {
+	// MaxAttempts per route, including the first
+	MaxAttempts int
+	// BaseDelay doubles each retry up to MaxDelay; the wait is a random
+	// fraction of it so clients that failed together do not retry together
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxRetryAfter is the longest provider Retry-After hint worth waiting
+	// for; a longer one fails over straight away
+	MaxRetryAfter time.Duration
+	// AttemptTimeout bounds each call to a provider
+	AttemptTimeout time.Duration
+}
+
+// Result is a completion with the route that served it
+type Result struct {
+	Completion
+	Route   Route
+	KeyName string
+	// Attempts counts provider calls across the whole chain
+	Attempts int
+}
+
+// Router retries completion calls and fails over along per-model chains.
+// Completions have no side effects beyond their cost, so repeating one that
+// failed is safe.
+type Router struct {
+	providers map[string]Provider
+	chains    map[string][]Route
+	policy    RetryPolicy
+}
+
+// NewRouter creates a router over the given providers. chains maps a
+// requested model to the routes tried in order; models without a chain are
+// served by their own provider alone.
+func NewRouter(policy RetryPolicy, chains map[string][]Route, providers ...Provider) *Router {
+	r := &Router{
+		providers: make(map[string]Provider),
+		chains:    make(map[string][]Route),
+		policy:    policy,
+	}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	for model, routes := range chains {
+		r.chains[strings.ToLower(model)] = routes
+	}
+	return r
+}
+
+// ForModel maps a model name onto the provider that serves it by default
+func ForModel(model string) string {
+	model = strings.ToLower(model)
+	switch {
+	case strings.HasPrefix(model, "claude"):
+		return "anthropic"
+	default:
+		return "openai"
+	}
+}
+
+// Routes returns the chain for model. keyName, when set, picks the key for
+// the first route; later routes use their own.
+func (r *Router) Routes(model, keyName string) []Route {
+	routes, ok := r.chains[strings.ToLower(model)]
+	if !ok {
+		routes = []Route{{Provider: ForModel(model), Model: model}}
+	}
+
+	routes = append([]Route{}, routes...)
+	if keyName != "" {
+		routes[0].Key = keyName
+	}
+	return routes
+}
+
+// Complete serves req along routes. On failure it returns the last error
+// with the route and attempt count reached so far.
+func (r *Router) Complete(ctx context.Context, req Request, routes []Route, keys KeyFunc) (Result, error) {
+	log := logger.With("correlation_id", middleware.CorrelationID(ctx), "model", req.Model)
+
+	// A streamed reply that has sent text cannot be repeated without the
+	// caller seeing that text twice, so it is neither retried nor failed over
+	streamed := false
+	if onDelta := req.OnDelta; onDelta != nil {
+		req.OnDelta = func(delta string) {
+			streamed = true
+			onDelta(delta)
+		}
+	}
+
+	result := Result{}
+	var lastErr error
+	for i, route := range routes {
+		result.Route = route
+
+		provider, ok := r.providers[route.Provider]
+		if !ok {
+			lastErr = fmt.Errorf("provider %s is not configured", route.Provider)
+			log.Warnw("skipping route", "route", route.String(), "error", lastErr)
+			continue
+		}
+
+		var cred Credential
+		if provider.NeedsKey() {
+			var err error
+			cred, err = keys(ctx, route)
+			if err != nil {
+				if ctx.Err() != nil {
+					return result, err
+				}
+				lastErr = err
+				log.Warnw("skipping route without a usable key", "route", route.String(), "error", err)
+				continue
+			}
+		}
+		result.KeyName = cred.Name
+
+		completion, err := r.retry(ctx, log, provider, cred.Key, route, req, &result.Attempts, &streamed)
+		cred.Wipe()
+		if err == nil {
+			result.Completion = completion
+			return result, nil
+		}
+		lastErr = err
+
+		var providerErr *Error
+		if !errors.As(err, &providerErr) || !providerErr.Failover() || ctx.Err() != nil || streamed {
+			return result, err
+		}
+		if i < len(routes)-1 {
+			metrics.RouteFailovers.WithLabelValues(route.Provider, string(providerErr.Kind)).Inc()
+			log.Warnw("failing over", "from", route.String(), "to", routes[i+1].String(), "error", err)
+		}
+	}
+	return result, lastErr
+}
+
+// retry calls one route until it succeeds, fails for good, runs out of
+// attempts or has streamed part of a reply
+func (r *Router) retry(ctx context.Context, log *logger.CustomLogger, provider Provider, key []byte, route Route, req Request, attempts *int, streamed *bool) (Completion, error) {
+	req.Model = route.Model
+	for try := 1; ; try++ {
+		*attempts++
+		completion, err := r.attempt(ctx, provider, key, req)
+		if err == nil {
+			return completion, nil
+		}
+
+		var providerErr *Error
+		if !errors.As(err, &providerErr) || !providerErr.Retryable() || try >= r.policy.MaxAttempts || ctx.Err() != nil || *streamed {
+			return Completion{}, err
+		}
+
+		delay := r.backoff(try, providerErr.RetryAfter)
+		if delay > r.policy.MaxRetryAfter {
+			return Completion{}, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return Completion{}, err
+		}
+
+		metrics.ProviderRetries.WithLabelValues(provider.Name(), string(providerErr.Kind)).Inc()
+		log.Infow("retrying provider call", "route", route.String(), "attempt", try, "delay_ms", delay.Milliseconds(), "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return Completion{}, context.Cause(ctx)
+		}
+	}
+}
+
+// attempt makes one timed provider call
+func (r *Router) attempt(ctx context.Context, provider Provider, key []byte, req Request) (Completion, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.policy.AttemptTimeout)
+	defer cancel()
+
+	// Unpriced models share one series so callers cannot create new ones at will
+	modelLabel := req.Model
+	if !usage.KnownModel(req.Model) {
+		modelLabel = "other"
+	}
+
+	start := time.Now()
+	completion, err := provider.Complete(ctx, key, req)
+
+	outcome := metrics.OutcomeSuccess
+	var providerErr *Error
+	switch {
+	case err == nil:
+		metrics.ProviderTokens.WithLabelValues(provider.Name(), modelLabel, "prompt").Add(float64(completion.PromptTokens))
+		metrics.ProviderTokens.WithLabelValues(provider.Name(), modelLabel, "completion").Add(float64(completion.CompletionTokens))
+	case errors.As(err, &providerErr) && providerErr.Kind == KindTimeout:
+		outcome = metrics.OutcomeTimeout
+	case ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded):
+		outcome = metrics.OutcomeCanceled
+	default:
+		outcome = metrics.OutcomeError
+	}
+	metrics.ProviderDuration.WithLabelValues(provider.Name(), modelLabel, outcome).Observe(metrics.Since(start))
+	return completion, err
+}
+
+// backoff returns the wait before retry number try: a random fraction of the
+// doubled base delay, or the provider's hint when that is longer
+func (r *Router) backoff(try int, retryAfter time.Duration) time.Duration {
+	ceiling := r.policy.BaseDelay << (try - 1)
+	if ceiling > r.policy.MaxDelay || ceiling <= 0 {
+		ceiling = r.policy.MaxDelay
+	}
+
+	var delay time.Duration
+	if ceiling > 0 {
+		delay = time.Duration(rand.Int64N(int64(ceiling) + 1))
+	}
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
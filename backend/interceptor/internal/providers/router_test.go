@@ -0,0 +1,198 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// scriptedProvider answers each call with the next of its results, repeating
+// the last one, and keeps the keys and models it was called with
+type scriptedProvider struct {
+	name    string
+	results []error
+	deltas  []string
+	calls   int
+	keys    []string
+	models  []string
+}
+
+func (p *scriptedProvider) Name() string   { return p.name }
+func (p *scriptedProvider) NeedsKey() bool { return true }
+
+func (p *scriptedProvider) Complete(_ context.Context, key []byte, req Request) (Completion, error) {
+	p.keys = append(p.keys, string(key))
+	p.models = append(p.models, req.Model)
+
+	err := p.results[len(p.results)-1]
+	if p.calls < len(p.results) {
+		err = p.results[p.calls]
+	}
+	p.calls++
+
+	for _, delta := range p.deltas {
+		if req.OnDelta != nil {
+			req.OnDelta(delta)
+		}
+	}
+	if err != nil {
+		return Completion{}, err
+	}
+	return Completion{Content: p.name + " reply", PromptTokens: 3, CompletionTokens: 2}, nil
+}
+
+var (
+	errServer    = &Error{Provider: "test", Kind: KindServer, Status: 500}
+	errRateLimit = &Error{Provider: "test", Kind: KindRateLimit, Status: 429}
+	errAuth      = &Error{Provider: "test", Kind: KindAuth, Status: 401}
+	errBad       = &Error{Provider: "test", Kind: KindBadRequest, Status: 400}
+)
+
+var testPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	BaseDelay:      time.Millisecond,
+	MaxDelay:       2 * time.Millisecond,
+	MaxRetryAfter:  50 * time.Millisecond,
+	AttemptTimeout: time.Second,
+}
+
+var testRoutes = []Route{
+	{Provider: "primary", Model: "model-a"},
+	{Provider: "backup", Model: "model-b"},
+}
+
+// keysByProvider hands every route a key named after its provider
+func keysByProvider(_ context.Context, route Route) (Credential, error) {
+	return Credential{Key: []byte(route.Provider + "-key"), Name: route.Provider + "-name"}, nil
+}
+
+func TestRouterRetriesTransientFailures(t *testing.T) {
+	primary := &scriptedProvider{name: "primary", results: []error{errServer, errRateLimit, nil}}
+	backup := &scriptedProvider{name: "backup", results: []error{nil}}
+	router := NewRouter(testPolicy, nil, primary, backup)
+
+	result, err := router.Complete(context.Background(), Request{}, testRoutes, keysByProvider)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if result.Route.Provider != "primary" || result.Attempts != 3 || backup.calls != 0 {
+		t.Fatalf("got route %s after %d attempts and %d backup calls, want primary after 3 and none", result.Route, result.Attempts, backup.calls)
+	}
+	if result.KeyName != "primary-name" || primary.models[0] != "model-a" {
+		t.Fatalf("got key %q and model %q", result.KeyName, primary.models[0])
+	}
+}
+
+func TestRouterFailsOverAfterRetries(t *testing.T) {
+	primary := &scriptedProvider{name: "primary", results: []error{errServer}}
+	backup := &scriptedProvider{name: "backup", results: []error{nil}}
+	router := NewRouter(testPolicy, nil, primary, backup)
+
+	result, err := router.Complete(context.Background(), Request{}, testRoutes, keysByProvider)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if primary.calls != testPolicy.MaxAttempts {
+		t.Fatalf("primary called %d times, want %d", primary.calls, testPolicy.MaxAttempts)
+	}
+	if result.Route.Provider != "backup" || result.Attempts != 4 || result.Content != "backup reply" {
+		t.Fatalf("got %+v", result)
+	}
+	if backup.keys[0] != "backup-key" || backup.models[0] != "model-b" {
+		t.Fatalf("backup called with key %q and model %q", backup.keys[0], backup.models[0])
+	}
+}
+
+func TestRouterFailsOverWithoutRetryingAuth(t *testing.T) {
+	primary := &scriptedProvider{name: "primary", results: []error{errAuth}}
+	backup := &scriptedProvider{name: "backup", results: []error{nil}}
+	router := NewRouter(testPolicy, nil, primary, backup)
+
+	result, err := router.Complete(context.Background(), Request{}, testRoutes, keysByProvider)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if primary.calls != 1 || result.Route.Provider != "backup" {
+		t.Fatalf("primary called %d times, served by %s", primary.calls, result.Route)
+	}
+}
+
+func TestRouterStopsOnBadRequest(t *testing.T) {
+	primary := &scriptedProvider{name: "primary", results: []error{errBad}}
+	backup := &scriptedProvider{name: "backup", results: []error{nil}}
+	router := NewRouter(testPolicy, nil, primary, backup)
+
+	_, err := router.Complete(context.Background(), Request{}, testRoutes, keysByProvider)
+	if !errors.Is(err, errBad) || primary.calls != 1 || backup.calls != 0 {
+		t.Fatalf("got %v with %d primary and %d backup calls", err, primary.calls, backup.calls)
+	}
+}
+
+func TestRouterSkipsRoutesWithoutKeys(t *testing.T) {
+	primary := &scriptedProvider{name: "primary", results: []error{nil}}
+	backup := &scriptedProvider{name: "backup", results: []error{nil}}
+	router := NewRouter(testPolicy, nil, primary, backup)
+
+	keys := func(ctx context.Context, route Route) (Credential, error) {
+		if route.Provider == "primary" {
+			return Credential{}, errors.New("no key stored")
+		}
+		return keysByProvider(ctx, route)
+	}
+	result, err := router.Complete(context.Background(), Request{}, testRoutes, keys)
+	if err != nil || result.Route.Provider != "backup" || primary.calls != 0 {
+		t.Fatalf("got %v via %s with %d primary calls", err, result.Route, primary.calls)
+	}
+}
+
+func TestRouterReturnsLastError(t *testing.T) {
+	primary := &scriptedProvider{name: "primary", results: []error{errServer}}
+	router := NewRouter(testPolicy, nil, primary)
+
+	routes := append([]Route{{Provider: "unconfigured", Model: "x"}}, testRoutes[0])
+	result, err := router.Complete(context.Background(), Request{}, routes, keysByProvider)
+	if !errors.Is(err, errServer) || result.Attempts != testPolicy.MaxAttempts {
+		t.Fatalf("got %v after %d attempts", err, result.Attempts)
+	}
+}
+
+func TestRouterDoesNotRepeatStreamedText(t *testing.T) {
+	primary := &scriptedProvider{name: "primary", results: []error{errServer}, deltas: []string{"partial"}}
+	backup := &scriptedProvider{name: "backup", results: []error{nil}}
+	router := NewRouter(testPolicy, nil, primary, backup)
+
+	var streamed []string
+	req := Request{OnDelta: func(delta string) { streamed = append(streamed, delta) }}
+	_, err := router.Complete(context.Background(), req, testRoutes, keysByProvider)
+	if err == nil || primary.calls != 1 || backup.calls != 0 || len(streamed) != 1 {
+		t.Fatalf("got %v with %d primary calls, %d backup calls and deltas %v", err, primary.calls, backup.calls, streamed)
+	}
+}
+
+func TestRouterFailsOverOnLongRetryAfter(t *testing.T) {
+	slow := &Error{Provider: "test", Kind: KindRateLimit, Status: 429, RetryAfter: time.Minute}
+	primary := &scriptedProvider{name: "primary", results: []error{slow}}
+	backup := &scriptedProvider{name: "backup", results: []error{nil}}
+	router := NewRouter(testPolicy, nil, primary, backup)
+
+	result, err := router.Complete(context.Background(), Request{}, testRoutes, keysByProvider)
+	if err != nil || primary.calls != 1 || result.Route.Provider != "backup" {
+		t.Fatalf("got %v via %s with %d primary calls", err, result.Route, primary.calls)
+	}
+}
+
+func TestRoutesUsesChainsAndKeyName(t *testing.T) {
+	router := NewRouter(testPolicy, map[string][]Route{"GPT-4o": testRoutes})
+
+	routes := router.Routes("gpt-4o", "work")
+	if len(routes) != 2 || routes[0].Key != "work" || routes[1].Key != "" {
+		t.Fatalf("got %+v", routes)
+	}
+	if testRoutes[0].Key != "" {
+		t.Fatal("Routes modified the configured chain")
+	}
+	if routes := router.Routes("claude-3-5-sonnet", ""); len(routes) != 1 || routes[0].Provider != "anthropic" {
+		t.Fatalf("unchained model: got %+v", routes)
+	}
+}
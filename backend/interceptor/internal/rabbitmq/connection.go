@@ -1,9 +1,11 @@
 package rabbitmq
 
 import (
+	"context"
 	"fmt"
 	"interceptor/config"
 	"interceptor/pkg/logger"
+	"sync"
 
 	"github.com/streadway/amqp"
 )
@@ -11,6 +13,9 @@ import (
 type RabbitMQ struct {
 	Connection *amqp.Connection
 	Channel    *amqp.Channel
+
+	mu         sync.Mutex
+	channelErr error // set once the channel closes
 }
 
 // ConnectRabbitMQ establishes a connection to RabbitMQ
@@ -32,6 +37,7 @@ func ConnectRabbitMQ(url string) (*RabbitMQ, error) {
 		Connection: conn,
 		Channel:    ch,
 	}
+	rmq.watchChannel()
 
 	// Setup queues and exchanges
 	if err := rmq.SetupQueuesAndExchanges(); err != nil {
@@ -73,11 +79,53 @@ func (r *RabbitMQ) SetupQueuesAndExchanges() error {
 	return nil
 }
 
+// watchChannel records the channel closing, which the library otherwise
+// only reports to later calls on it
+func (r *RabbitMQ) watchChannel() {
+	closed := r.Channel.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		reason := <-closed
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if reason != nil {
+			r.channelErr = fmt.Errorf("channel closed: %v", reason)
+		} else {
+			r.channelErr = fmt.Errorf("channel closed")
+		}
+	}()
+}
+
+// Check reports whether the connection and channel are both still open
+func (r *RabbitMQ) Check(ctx context.Context) error {
+	if r.Connection == nil || r.Connection.IsClosed() {
+		return fmt.Errorf("connection closed")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.channelErr
+}
+
 // GetChannel returns the channel for use by producer/consumer
 func (r *RabbitMQ) GetChannel() *amqp.Channel {
 	return r.Channel
 }
 
+// OpenChannel opens a further channel on the connection that holds at most
+// prefetch unacknowledged deliveries, for consumers that work in parallel
+func (r *RabbitMQ) OpenChannel(prefetch int) (*amqp.Channel, error) {
+	ch, err := r.Connection.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open channel: %v", err)
+	}
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to set channel prefetch: %v", err)
+	}
+	return ch, nil
+}
+
 // Close gracefully closes the RabbitMQ connection and channel
 func (r *RabbitMQ) Close() {
 	if r.Channel != nil {
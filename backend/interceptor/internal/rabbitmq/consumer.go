@@ -1,7 +1,13 @@
 package rabbitmq
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"interceptor/internal/metrics"
+	"interceptor/pkg/logger"
 	"log"
+	"sync"
 
 	"github.com/streadway/amqp"
 )
@@ -11,6 +17,9 @@ type Consumer struct {
 	queueName    string
 	exchangeName string
 	routingKey   string
+
+	mu   sync.Mutex
+	tags []string // consumer tags of active deliveries, for Cancel
 }
 
 func NewConsumer(channel *amqp.Channel, queueName, exchangeName, routingKey string) (*Consumer, error) {
@@ -61,16 +70,145 @@ func NewConsumer(channel *amqp.Channel, queueName, exchangeName, routingKey stri
 	}, nil
 }
 
+// NewBroadcastConsumer binds a private, server-named queue to a fanout exchange
+// so that every instance receives its own copy of each message
+func NewBroadcastConsumer(channel *amqp.Channel, exchangeName string) (*Consumer, error) {
+	err := channel.ExchangeDeclare(
+		exchangeName, // name
+		"fanout",     // type
+		true,         // durable
+		false,        // auto-deleted
+		false,        // internal
+		false,        // no-wait
+		nil,          // arguments
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	queue, err := channel.QueueDeclare(
+		"",    // name
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = channel.QueueBind(
+		queue.Name,   // queue name
+		"",           // routing key
+		exchangeName, // exchange
+		false,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Consumer{
+		channel:      channel,
+		queueName:    queue.Name,
+		exchangeName: exchangeName,
+	}, nil
+}
+
+// ConsumeMessages starts delivery from the queue. Every delivery is counted,
+// and its ack, nack or requeue is counted when the handler settles it.
 func (c *Consumer) ConsumeMessages() (<-chan amqp.Delivery, error) {
-	return c.channel.Consume(
+	tag := c.newTag()
+	deliveries, err := c.channel.Consume(
 		c.queueName, // queue name
-		"",          // consumer
+		tag,         // consumer
 		false,       // auto-ack
 		false,       // exclusive
 		false,       // no local
 		false,       // no wait
 		nil,         // arguments
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Server-named queues get a new name per connection; label them by exchange
+	queue := c.queueName
+	if c.routingKey == "" {
+		queue = c.exchangeName
+	}
+
+	instrumented := make(chan amqp.Delivery)
+	go func() {
+		defer close(instrumented)
+		for msg := range deliveries {
+			metrics.BrokerConsumed.WithLabelValues(queue).Inc()
+			if !msg.Timestamp.IsZero() {
+				metrics.BrokerQueueWait.WithLabelValues(queue).Observe(metrics.Since(msg.Timestamp))
+			}
+			msg.Acknowledger = countingAcknowledger{Acknowledger: msg.Acknowledger, queue: queue}
+			instrumented <- msg
+		}
+	}()
+	return instrumented, nil
+}
+
+// countingAcknowledger counts settlements before passing them to the channel
+type countingAcknowledger struct {
+	amqp.Acknowledger
+	queue string
+}
+
+func (a countingAcknowledger) Ack(tag uint64, multiple bool) error {
+	metrics.BrokerSettled.WithLabelValues(a.queue, metrics.SettleAck).Inc()
+	return a.Acknowledger.Ack(tag, multiple)
+}
+
+func (a countingAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	metrics.BrokerSettled.WithLabelValues(a.queue, settlement(requeue)).Inc()
+	return a.Acknowledger.Nack(tag, multiple, requeue)
+}
+
+func (a countingAcknowledger) Reject(tag uint64, requeue bool) error {
+	metrics.BrokerSettled.WithLabelValues(a.queue, settlement(requeue)).Inc()
+	return a.Acknowledger.Reject(tag, requeue)
+}
+
+func settlement(requeue bool) string {
+	if requeue {
+		return metrics.SettleRequeue
+	}
+	return metrics.SettleNack
+}
+
+// newTag returns a unique consumer tag and remembers it for Cancel
+func (c *Consumer) newTag() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	tag := c.queueName + "-" + hex.EncodeToString(buf)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tags = append(c.tags, tag)
+	return tag
+}
+
+// Cancel stops the broker delivering to this consumer. Deliveries already
+// received stay valid and can still be acked; the delivery channels close
+// once they are drained.
+func (c *Consumer) Cancel() error {
+	c.mu.Lock()
+	tags := c.tags
+	c.tags = nil
+	c.mu.Unlock()
+
+	for _, tag := range tags {
+		if err := c.channel.Cancel(tag, false); err != nil {
+			return fmt.Errorf("failed to cancel consumer %s: %v", tag, err)
+		}
+	}
+	return nil
 }
 
 func (c *Consumer) Consume(handler func([]byte) error) error {
@@ -84,9 +222,7 @@ func (c *Consumer) Consume(handler func([]byte) error) error {
 	go func() {
 		for msg := range messages {
 			if err := handler(msg.Body); err != nil {
-				// Handle error (log it, retry, etc.)
-				// For now, just print it
-				println("Error processing message:", err.Error())
+				logger.Error("Error processing message: %v", err)
 			}
 		}
 	}()
@@ -119,7 +255,7 @@ func ConsumeMessages(channelRabbitMQ *amqp.Channel) {
 	go func() {
 		for message := range messages {
 			// Process each message
-			log.Printf(" > Received message: %s\n", message.Body)
+			log.Printf(" > Received message: %d bytes\n", len(message.Body))
 
 			// Acknowledge if auto-ack is false (for manual acknowledgment)
 			// message.Ack(false)
@@ -2,6 +2,8 @@ package rabbitmq
 
 import (
 	"encoding/json"
+	"interceptor/internal/metrics"
+	"time"
 
 	"github.com/streadway/amqp"
 )
@@ -68,15 +70,23 @@ func (p *Producer) PublishMessage(message interface{}) error {
 		return err
 	}
 
-	// Publish the message
-	return p.channel.Publish(
+	// Publish the message; the timestamp lets consumers measure queue wait
+	err = p.channel.Publish(
 		p.exchangeName, // exchange
 		p.routingKey,   // routing key
 		false,          // mandatory
 		false,          // immediate
 		amqp.Publishing{
 			ContentType: "application/json",
+			Timestamp:   time.Now(),
 			Body:        body,
 		},
 	)
+
+	outcome := metrics.OutcomeSuccess
+	if err != nil {
+		outcome = metrics.OutcomeError
+	}
+	metrics.BrokerPublished.WithLabelValues(p.exchangeName, outcome).Inc()
+	return err
 }
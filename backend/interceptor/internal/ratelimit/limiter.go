@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// idleAfter is how long an untouched bucket is kept before it is dropped
+const idleAfter = 10 * time.Minute
+
+// bucket is a token bucket for one key
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a per-key token bucket limiter whose rate can change at runtime.
+// A rate of zero disables it.
+type Limiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// New returns a limiter allowing requestsPerMinute per key with the given burst
+func New(requestsPerMinute, burst int) *Limiter {
+	l := &Limiter{buckets: make(map[string]*bucket)}
+	l.SetLimit(requestsPerMinute, burst)
+	return l
+}
+
+// SetLimit changes the rate and burst. A burst below one request is raised to one.
+func (l *Limiter) SetLimit(requestsPerMinute, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = float64(requestsPerMinute) / 60
+	l.burst = float64(burst)
+	if l.burst < 1 {
+		l.burst = 1
+	}
+}
+
+// Allow takes a token for key. When none is left it returns false and how
+// long until the next one is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops idle buckets so the map does not grow with every address seen
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < idleAfter {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idleAfter {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package respcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Entry is a cached completion
+type Entry struct {
+	Content string `json:"content"`
+	// Route is the provider/model that produced the completion
+	Route            string    `json:"route"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Cache stores completions per address. Implementations keep each address's
+// entries apart, so content cached for one wallet is never served to another
+// even if two keys were to collide.
+type Cache interface {
+	Get(address, key string) (Entry, bool)
+	Put(address, key string, entry Entry)
+	Close() error
+}
+
+// Message is one chat message as it enters the cache key
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Params are the sampling parameters that change a completion
+type Params struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+}
+
+// Key hashes everything that determines a completion. Message content is
+// normalized first, so trailing whitespace or line endings do not miss.
+func Key(provider, model string, messages []Message, params Params) string {
+	normalized := make([]Message, len(messages))
+	for i, m := range messages {
+		normalized[i] = Message{
+			Role:    strings.ToLower(strings.TrimSpace(m.Role)),
+			Content: strings.TrimSpace(strings.ReplaceAll(m.Content, "\r\n", "\n")),
+		}
+	}
+
+	data, _ := json.Marshal(struct {
+		Provider string    `json:"provider"`
+		Model    string    `json:"model"`
+		Messages []Message `json:"messages"`
+		Params   Params    `json:"params"`
+	}{strings.ToLower(provider), strings.ToLower(model), normalized, params})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// addressDir names an address's partition without putting the address itself on disk
+func addressDir(address string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(address)))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,153 @@
+package respcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"interceptor/pkg/logger"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type diskItem struct {
+	Entry     Entry     `json:"entry"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Disk keeps completions as one file each under a directory per address, so
+// the cache survives restarts. Files are readable by the service user only.
+type Disk struct {
+	dir string
+	ttl time.Duration
+
+	stop chan struct{}
+}
+
+// NewDisk opens a disk cache under dir and starts a janitor that deletes
+// expired files
+func NewDisk(dir string, ttl time.Duration) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create response cache directory: %v", err)
+	}
+
+	d := &Disk{dir: dir, ttl: ttl, stop: make(chan struct{})}
+	go d.janitor()
+	return d, nil
+}
+
+func (d *Disk) path(address, key string) string {
+	return filepath.Join(d.dir, addressDir(address), key+".json")
+}
+
+// Get returns the completion cached for address under key
+func (d *Disk) Get(address, key string) (Entry, bool) {
+	path := d.path(address, key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Entry{}, false
+	}
+
+	var it diskItem
+	if err := json.Unmarshal(data, &it); err != nil || time.Now().After(it.ExpiresAt) {
+		os.Remove(path)
+		return Entry{}, false
+	}
+	return it.Entry, true
+}
+
+// Put writes a completion, replacing the file atomically so readers never
+// see a partial entry
+func (d *Disk) Put(address, key string, entry Entry) {
+	path := d.path(address, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		logger.Error("Failed to create response cache directory: %v", err)
+		return
+	}
+
+	data, err := json.Marshal(diskItem{Entry: entry, ExpiresAt: time.Now().Add(d.ttl)})
+	if err != nil {
+		logger.Error("Failed to marshal response cache entry: %v", err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		logger.Error("Failed to write response cache entry: %v", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		logger.Error("Failed to write response cache entry: %v", err)
+	}
+}
+
+// Close stops the janitor; entries stay on disk until they expire
+func (d *Disk) Close() error {
+	close(d.stop)
+	return nil
+}
+
+func (d *Disk) janitor() {
+	ticker := time.NewTicker(d.ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.sweep()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// sweep deletes expired entries and the address directories they leave empty
+func (d *Disk) sweep() {
+	now := time.Now()
+	partitions, err := os.ReadDir(d.dir)
+	if err != nil {
+		logger.Error("Failed to sweep response cache: %v", err)
+		return
+	}
+
+	for _, partition := range partitions {
+		if !partition.IsDir() {
+			continue
+		}
+		partitionDir := filepath.Join(d.dir, partition.Name())
+		files, err := os.ReadDir(partitionDir)
+		if err != nil {
+			continue
+		}
+
+		for _, file := range files {
+			path := filepath.Join(partitionDir, file.Name())
+			if strings.HasPrefix(file.Name(), ".tmp-") {
+				// Mid-write unless left behind by a crash
+				if info, err := file.Info(); err == nil && now.Sub(info.ModTime()) > d.ttl {
+					os.Remove(path)
+				}
+				continue
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			var it diskItem
+			if json.Unmarshal(data, &it) != nil || now.After(it.ExpiresAt) {
+				os.Remove(path)
+			}
+		}
+
+		// Fails while the directory still holds entries
+		os.Remove(partitionDir)
+	}
+}
@@ -0,0 +1,124 @@
+package respcache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type memoryItem struct {
+	lookup    string
+	entry     Entry
+	expiresAt time.Time
+}
+
+// Memory is a size-bounded LRU of completions with a TTL
+type Memory struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	order      *list.List
+	items      map[string]*list.Element
+
+	stop chan struct{}
+}
+
+// NewMemory creates an in-memory cache and starts a janitor that purges
+// expired entries
+func NewMemory(ttl time.Duration, maxEntries int) *Memory {
+	m := &Memory{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+		stop:       make(chan struct{}),
+	}
+	go m.janitor()
+	return m
+}
+
+// The address leads the lookup, so entries are partitioned by it
+func memoryLookup(address, key string) string {
+	return address + "\x00" + key
+}
+
+// Get returns the completion cached for address under key
+func (m *Memory) Get(address, key string) (Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[memoryLookup(address, key)]
+	if !ok {
+		return Entry{}, false
+	}
+
+	it := el.Value.(*memoryItem)
+	if time.Now().After(it.expiresAt) {
+		m.remove(el)
+		return Entry{}, false
+	}
+
+	m.order.MoveToFront(el)
+	return it.entry, true
+}
+
+// Put caches a completion, evicting the least recently used entry when full
+func (m *Memory) Put(address, key string, entry Entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lookup := memoryLookup(address, key)
+	if el, ok := m.items[lookup]; ok {
+		m.remove(el)
+	}
+
+	m.items[lookup] = m.order.PushFront(&memoryItem{
+		lookup:    lookup,
+		entry:     entry,
+		expiresAt: time.Now().Add(m.ttl),
+	})
+
+	for m.order.Len() > m.maxEntries {
+		m.remove(m.order.Back())
+	}
+}
+
+// Close stops the janitor and drops every entry
+func (m *Memory) Close() error {
+	close(m.stop)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.order.Init()
+	m.items = make(map[string]*list.Element)
+	return nil
+}
+
+// remove unlinks an entry; callers must hold the lock
+func (m *Memory) remove(el *list.Element) {
+	m.order.Remove(el)
+	delete(m.items, el.Value.(*memoryItem).lookup)
+}
+
+func (m *Memory) janitor() {
+	ticker := time.NewTicker(m.ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			m.mu.Lock()
+			for el := m.order.Front(); el != nil; {
+				next := el.Next()
+				if now.After(el.Value.(*memoryItem).expiresAt) {
+					m.remove(el)
+				}
+				el = next
+			}
+			m.mu.Unlock()
+		case <-m.stop:
+			return
+		}
+	}
+}
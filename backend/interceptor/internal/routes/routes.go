@@ -1,8 +1,12 @@
 package routes
 
 import (
+	"interceptor/config"
 	"interceptor/internal/handlers"
+	"interceptor/internal/metrics"
+	"interceptor/internal/middleware"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -13,10 +17,59 @@ func RegisterRoutes(app *fiber.App) {
 	// Public routes
 	app.Get("/", handlers.HomeHandler)
 	app.Get("/health", handlers.HealthCheckHandler)
+	app.Get("/livez", handlers.LivezHandler)
+	app.Get("/readyz", handlers.ReadyzHandler)
+	app.Get("/metrics", metrics.Handler())
 
 	// API endpoints
 	api.Post("/publish", handlers.PublishHandler)
 
 	// RabbitMQ endpoints
 	api.Post("/publishbroker", handlers.PublishMessageThroughBroker)
+
+	// Conversations with server-side history
+	api.Post("/conversations", handlers.CreateConversationHandler)
+	api.Get("/conversations", handlers.ListConversationsHandler)
+	api.Get("/conversations/:id", handlers.GetConversationHandler)
+	api.Post("/conversations/:id/fork", handlers.ForkConversationHandler)
+	api.Delete("/conversations/:id", handlers.DeleteConversationHandler)
+
+	// Batch completions, worked off from a queue
+	api.Post("/jobs", handlers.CreateJobHandler)
+	api.Get("/jobs", handlers.ListJobsHandler)
+	api.Get("/jobs/:id", handlers.GetJobHandler)
+	api.Get("/jobs/:id/results", handlers.JobResultsHandler)
+	api.Post("/jobs/:id/cancel", handlers.CancelJobHandler)
+
+	// Session tokens, and chat over a WebSocket authenticated with one
+	api.Post("/sessions", handlers.OpenSessionHandler)
+	api.Get("/chat/ws", handlers.ChatUpgradeHandler, websocket.New(handlers.ChatSocketHandler))
+
+	// Signed webhook callbacks and their delivery log
+	api.Put("/webhooks", handlers.PutWebhookHandler)
+	api.Get("/webhooks", handlers.GetWebhookHandler)
+	api.Delete("/webhooks", handlers.DeleteWebhookHandler)
+	api.Get("/webhooks/deliveries", handlers.ListDeliveriesHandler)
+	api.Post("/webhooks/deliveries/:id/redeliver", handlers.RedeliverHandler)
+
+	// Token counts for a model, as the pre-flight check sees them
+	api.Post("/tokenize", handlers.TokenizeHandler)
+
+	// Named keys
+	api.Get("/keycache/stats", handlers.KeyCacheStatsHandler)
+	api.Get("/keys", handlers.ListKeysHandler)
+	api.Delete("/keys/:name", handlers.DeleteKeyHandler)
+	api.Post("/keys/:name/rotate", handlers.RotateKeyHandler)
+	api.Post("/keys/:name/revoke", handlers.RevokeKeyHandler)
+
+	// Delegated access grants
+	api.Post("/grants", handlers.CreateGrantHandler)
+	api.Get("/grants", handlers.ListGrantsHandler)
+	api.Post("/grants/:id/revoke", handlers.RevokeGrantHandler)
+
+	// Admin API, behind the admin bearer token
+	admin := api.Group("/admin", middleware.AdminAuth(config.AppConfig.Admin.Token))
+	admin.Get("/policies", handlers.ListPoliciesHandler)
+	admin.Put("/policies/:id", handlers.PutPolicyHandler)
+	admin.Delete("/policies/:id", handlers.DeletePolicyHandler)
 }
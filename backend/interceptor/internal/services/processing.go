@@ -3,13 +3,16 @@ package services
 import (
 	"encoding/json"
 	"fmt"
+	"interceptor/internal/webhooks"
 	"interceptor/pkg/logger"
+	"strings"
 	"time"
 )
 
 // MessageProcessor handles the processing of messages
 type MessageProcessor struct {
-	// Add any dependencies here (e.g., database, external services)
+	// webhooks delivers notifications to the addresses they concern
+	webhooks *webhooks.Dispatcher
 }
 
 // Message represents the structure of messages we expect to process
@@ -21,8 +24,19 @@ type Message struct {
 }
 
 // NewMessageProcessor creates a new instance of MessageProcessor
-func NewMessageProcessor() *MessageProcessor {
-	return &MessageProcessor{}
+func NewMessageProcessor(dispatcher *webhooks.Dispatcher) *MessageProcessor {
+	return &MessageProcessor{webhooks: dispatcher}
+}
+
+// Notify raises an event for address from inside the interceptor. It takes
+// the same path as a notification message from the broker.
+func (p *MessageProcessor) Notify(address, event string, data any) error {
+	return p.processNotification(Message{
+		ID:        webhooks.NewID(),
+		Type:      "notification",
+		Data:      map[string]any{"address": address, "event": event, "data": data},
+		Timestamp: time.Now().UTC(),
+	})
 }
 
 // ProcessMessage handles the processing of a single message
@@ -68,24 +82,40 @@ func (p *MessageProcessor) processTask(message Message) error {
 	return nil
 }
 
-// processNotification handles notification-type messages
+// processNotification sends a notification to the webhook of the address
+// it names. The message ID doubles as the delivery ID, so a redelivered
+// message is not sent twice.
 func (p *MessageProcessor) processNotification(message Message) error {
-	// Extract notification data
-	notifData, ok := message.Data.(map[string]interface{})
-	if !ok {
+	// Data arrives as a decoded map from the broker; a round trip through
+	// JSON gives it the notification's shape
+	raw, err := json.Marshal(message.Data)
+	if err != nil {
+		return fmt.Errorf("invalid notification data format")
+	}
+	var notification webhooks.Notification
+	if err := json.Unmarshal(raw, &notification); err != nil {
 		return fmt.Errorf("invalid notification data format")
 	}
 
-	// Log notification processing
-	logger.Info("Processing notification: %v", notifData)
+	notification.Address = strings.ToLower(notification.Address)
+	if notification.Address == "" || notification.Event == "" {
+		return fmt.Errorf("notification address and event are required")
+	}
+	if notification.ID == "" {
+		notification.ID = message.ID
+	}
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = message.Timestamp
+	}
 
-	// TODO: Implement notification processing logic
-	// This could include:
-	// - Sending emails
-	// - Pushing to websockets
-	// - Triggering alerts
-	// - Updating notification status
+	logger.Debugw("processing notification", "id", notification.ID, "address", notification.Address, "event", notification.Event)
 
+	if p.webhooks == nil {
+		return nil
+	}
+	if err := p.webhooks.Dispatch(notification); err != nil {
+		return fmt.Errorf("failed to dispatch notification: %v", err)
+	}
 	return nil
 }
 
@@ -0,0 +1,154 @@
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"interceptor/internal/wallet"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SignWindow is how far the signing time of an open request may be from the
+// server's clock
+const SignWindow = 5 * time.Minute
+
+var (
+	// ErrInvalid is returned for a token that was not issued here
+	ErrInvalid = errors.New("invalid session token")
+	// ErrExpired is returned for a token past its expiry
+	ErrExpired = errors.New("session has expired")
+	// ErrNonceUsed is returned when an open request is replayed
+	ErrNonceUsed = errors.New("nonce has already been used")
+	// ErrSignature is returned when an open request is not signed by its address
+	ErrSignature = errors.New("invalid signature")
+)
+
+// Session is an address signed in until ExpiresAt. The token stands in for
+// a signature on requests made within the session.
+type Session struct {
+	Address   string    `json:"address"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// OpenMessage is the text a wallet signs to open a session; issued is the
+// RFC 3339 time of signing
+func OpenMessage(address, issued, nonce string) string {
+	return fmt.Sprintf("b.env open session\naddress: %s\nissued: %s\nnonce: %s", address, issued, nonce)
+}
+
+// Issuer opens sessions for signed requests and verifies their tokens.
+// Tokens carry their address and expiry under an HMAC, so every instance
+// sharing the secret accepts them without shared state. Nonces are only
+// remembered by the instance that saw them, for the signing window.
+type Issuer struct {
+	secret []byte
+	ttl    time.Duration
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// NewIssuer creates an issuer whose sessions last ttl. An empty secret is
+// replaced by a random one, so tokens stop working when the process exits.
+func NewIssuer(secret string, ttl time.Duration) *Issuer {
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &Issuer{
+		secret: key,
+		ttl:    ttl,
+		nonces: make(map[string]time.Time),
+	}
+}
+
+// Open checks a signed request to open a session for address and issues one
+func (i *Issuer) Open(address, issued, nonce, signature string) (Session, error) {
+	address = strings.ToLower(address)
+	if !wallet.IsAddress(address) {
+		return Session{}, fmt.Errorf("address is not a valid address")
+	}
+	if nonce == "" {
+		return Session{}, fmt.Errorf("nonce is required")
+	}
+	signedAt, err := time.Parse(time.RFC3339, issued)
+	if err != nil {
+		return Session{}, fmt.Errorf("issued must be an RFC 3339 time")
+	}
+	now := time.Now()
+	if signedAt.Before(now.Add(-SignWindow)) || signedAt.After(now.Add(SignWindow)) {
+		return Session{}, fmt.Errorf("issued must be within %s of the server time", SignWindow)
+	}
+
+	if err := wallet.VerifySigner(OpenMessage(address, issued, nonce), signature, address); err != nil {
+		return Session{}, fmt.Errorf("%w: %v", ErrSignature, err)
+	}
+	if !i.useNonce(address, nonce, now) {
+		return Session{}, ErrNonceUsed
+	}
+
+	expiresAt := now.Add(i.ttl).UTC().Truncate(time.Second)
+	return Session{
+		Address:   address,
+		Token:     i.token(address, expiresAt),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Verify returns the session a token stands for
+func (i *Issuer) Verify(token string) (Session, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Session{}, ErrInvalid
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return Session{}, ErrInvalid
+	}
+	expiresAt := time.Unix(expiry, 0).UTC()
+	if subtle.ConstantTimeCompare([]byte(i.token(parts[0], expiresAt)), []byte(token)) != 1 {
+		return Session{}, ErrInvalid
+	}
+	if time.Now().After(expiresAt) {
+		return Session{}, ErrExpired
+	}
+	return Session{Address: parts[0], Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// token is "<address>.<expiry>.<mac>", the MAC covering the first two parts
+func (i *Issuer) token(address string, expiresAt time.Time) string {
+	claims := address + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte(claims))
+	return claims + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// useNonce records a nonce for address, reporting false if it was already
+// used. A nonce outside the signing window is rejected before it gets here,
+// so entries older than the window are dropped.
+func (i *Issuer) useNonce(address, nonce string, now time.Time) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for key, seen := range i.nonces {
+		if now.Sub(seen) > 2*SignWindow {
+			delete(i.nonces, key)
+		}
+	}
+
+	key := address + "\n" + nonce
+	if _, used := i.nonces[key]; used {
+		return false
+	}
+	i.nonces[key] = now
+	return true
+}
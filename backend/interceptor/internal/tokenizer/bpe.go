@@ -0,0 +1,151 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Encoding is a byte-level BPE vocabulary with the pattern that splits text
+// into pieces before merging, as used by OpenAI models
+type Encoding struct {
+	name    string
+	ranks   map[string]int
+	pattern *regexp.Regexp
+}
+
+// newEncoding parses a .tiktoken rank file: one base64 token and its rank per line
+func newEncoding(name string, data []byte, pattern *regexp.Regexp) (*Encoding, error) {
+	ranks := make(map[string]int, bytes.Count(data, []byte("\n")))
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		token, rank, ok := bytes.Cut(line, []byte(" "))
+		if !ok {
+			return nil, fmt.Errorf("failed to parse %s ranks: malformed line %q", name, line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(token))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s ranks: %v", name, err)
+		}
+		value, err := strconv.Atoi(string(rank))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s ranks: %v", name, err)
+		}
+		ranks[string(decoded)] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s ranks: %v", name, err)
+	}
+
+	return &Encoding{name: name, ranks: ranks, pattern: pattern}, nil
+}
+
+// Name returns the encoding name, e.g. cl100k_base
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// Exact is true: counts match what OpenAI bills
+func (e *Encoding) Exact() bool {
+	return true
+}
+
+// Encode returns the token IDs of text. Special tokens such as <|endoftext|>
+// are encoded as plain text.
+func (e *Encoding) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range e.split(text) {
+		if rank, ok := e.ranks[piece]; ok {
+			tokens = append(tokens, rank)
+			continue
+		}
+		tokens = append(tokens, e.merge([]byte(piece))...)
+	}
+	return tokens
+}
+
+// Count returns the number of tokens in text
+func (e *Encoding) Count(text string) int {
+	count := 0
+	for _, piece := range e.split(text) {
+		if _, ok := e.ranks[piece]; ok {
+			count++
+			continue
+		}
+		count += len(e.merge([]byte(piece)))
+	}
+	return count
+}
+
+// split cuts text into the pieces BPE runs on. The upstream patterns end in
+// `\s+(?!\S)|\s+`, which RE2 cannot express, so the last group matches `\s+`
+// and hands its final character to the next piece when one follows: a run of
+// spaces before a word leaves one space to lead that word.
+func (e *Encoding) split(text string) []string {
+	var pieces []string
+	for len(text) > 0 {
+		match := e.pattern.FindStringSubmatchIndex(text)
+		if match == nil || match[1] == 0 {
+			// Every character matches some alternative; guard against looping
+			_, size := utf8.DecodeRuneInString(text)
+			pieces = append(pieces, text[:size])
+			text = text[size:]
+			continue
+		}
+
+		end := match[1]
+		last := len(match) - 2
+		if match[last] >= 0 && end < len(text) {
+			_, size := utf8.DecodeLastRuneInString(text[:end])
+			if end-size > 0 {
+				end -= size
+			}
+		}
+
+		pieces = append(pieces, text[:end])
+		text = text[end:]
+	}
+	return pieces
+}
+
+// merge applies the lowest-ranked merge until none is left and returns the
+// ranks of the remaining parts
+func (e *Encoding) merge(piece []byte) []int {
+	if len(piece) == 1 {
+		return []int{e.ranks[string(piece)]}
+	}
+
+	// bounds[i] is where part i starts; the last entry closes the final part
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+
+	for len(bounds) > 2 {
+		best, at := math.MaxInt, -1
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := e.ranks[string(piece[bounds[i]:bounds[i+2]])]; ok && rank < best {
+				best, at = rank, i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		bounds = append(bounds[:at+1], bounds[at+2:]...)
+	}
+
+	tokens := make([]int, 0, len(bounds)-1)
+	for i := 0; i+1 < len(bounds); i++ {
+		tokens = append(tokens, e.ranks[string(piece[bounds[i]:bounds[i+1]])])
+	}
+	return tokens
+}
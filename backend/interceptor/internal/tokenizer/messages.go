@@ -0,0 +1,133 @@
+package tokenizer
+
+import (
+	"fmt"
+	"interceptor/internal/tools"
+	"sort"
+)
+
+// Chat format overhead: each message is framed by a few tokens, and the
+// reply is primed with more
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// Overflow policies for prompts that do not fit the context window
+const (
+	OverflowReject   = "reject"
+	OverflowTruncate = "truncate"
+)
+
+// Message is one chat message. An assistant message may carry tool calls,
+// and a tool message names the call it answers.
+type Message struct {
+	Role       string       `json:"role"`
+	Content    string       `json:"content"`
+	ToolCalls  []tools.Call `json:"tool_calls,omitempty"`
+	ToolCallID string       `json:"tool_call_id,omitempty"`
+}
+
+// CountMessages returns the prompt tokens of a conversation, including the
+// chat format overhead
+func CountMessages(counter Counter, messages []Message) int {
+	total := tokensPerReply
+	for _, m := range messages {
+		total += CountMessage(counter, m)
+	}
+	return total
+}
+
+// CountMessage returns the tokens one message adds to a conversation
+func CountMessage(counter Counter, m Message) int {
+	total := tokensPerMessage + counter.Count(m.Role) + counter.Count(m.Content)
+	for _, call := range m.ToolCalls {
+		total += counter.Count(call.Name) + counter.Count(call.Arguments)
+	}
+	if m.ToolCallID != "" {
+		total += counter.Count(m.ToolCallID)
+	}
+	return total
+}
+
+// ContextError reports a prompt that does not fit its budget
+type ContextError struct {
+	PromptTokens int
+	Budget       int
+}
+
+func (e *ContextError) Error() string {
+	return fmt.Sprintf("prompt is %d tokens, over the budget of %d", e.PromptTokens, e.Budget)
+}
+
+// Fit is the outcome of fitting a conversation to a budget
+type Fit struct {
+	Messages     []Message
+	PromptTokens int
+	// Dropped counts whole messages removed; Trimmed is set when the last
+	// message lost its beginning
+	Dropped int
+	Trimmed bool
+}
+
+// Truncated reports whether the conversation was shortened
+func (f Fit) Truncated() bool {
+	return f.Dropped > 0 || f.Trimmed
+}
+
+// FitMessages checks the conversation against budget. Under OverflowReject
+// an over-long conversation is a *ContextError. Under OverflowTruncate the
+// oldest messages after any system prompt are dropped, then the start of the
+// last message is cut; only a system prompt that alone is over budget fails.
+// Tool results are dropped with the call they answer.
+func FitMessages(counter Counter, messages []Message, budget int, overflow string) (Fit, error) {
+	tokens := CountMessages(counter, messages)
+	if tokens <= budget {
+		return Fit{Messages: messages, PromptTokens: tokens}, nil
+	}
+	if overflow != OverflowTruncate || len(messages) == 0 {
+		return Fit{}, &ContextError{PromptTokens: tokens, Budget: budget}
+	}
+
+	kept := append([]Message{}, messages...)
+	fit := Fit{}
+
+	// Keep leading system messages and the last message; drop the oldest in between
+	first := 0
+	for first < len(kept)-1 && kept[first].Role == "system" {
+		first++
+	}
+	for first < len(kept)-1 && tokens > budget {
+		kept = append(kept[:first], kept[first+1:]...)
+		fit.Dropped++
+		for first < len(kept)-1 && kept[first].Role == "tool" {
+			kept = append(kept[:first], kept[first+1:]...)
+			fit.Dropped++
+		}
+		tokens = CountMessages(counter, kept)
+	}
+	// A tool result cannot be sent once the call it answers is gone
+	if fit.Dropped > 0 && first == len(kept)-1 && kept[first].Role == "tool" {
+		return Fit{}, &ContextError{PromptTokens: CountMessages(counter, messages), Budget: budget}
+	}
+
+	if tokens > budget {
+		last := len(kept) - 1
+		content := []rune(kept[last].Content)
+		// Find the smallest cut that fits; more runes cut never costs tokens
+		cut := sort.Search(len(content)+1, func(n int) bool {
+			kept[last].Content = string(content[n:])
+			return CountMessages(counter, kept) <= budget
+		})
+		if cut > len(content) {
+			return Fit{}, &ContextError{PromptTokens: CountMessages(counter, messages), Budget: budget}
+		}
+		kept[last].Content = string(content[cut:])
+		fit.Trimmed = true
+		tokens = CountMessages(counter, kept)
+	}
+
+	fit.Messages = kept
+	fit.PromptTokens = tokens
+	return fit, nil
+}
@@ -0,0 +1,119 @@
+package tokenizer
+
+import (
+	"math"
+	"strings"
+	"sync"
+)
+
+// Approximate names the counter used for models without a public tokenizer
+const Approximate = "approximate"
+
+// ApproximationMargin scales cl100k_base counts for other vendors' models.
+// Their tokenizers split English into somewhat more pieces, so the estimate
+// errs high and a prompt admitted here is rarely rejected upstream.
+const ApproximationMargin = 1.2
+
+// Counter counts the tokens of text for a model
+type Counter interface {
+	Name() string
+	// Exact is false when the count is an estimate
+	Exact() bool
+	Count(text string) int
+}
+
+// Model is what the tokenizer knows of a model: how to count its tokens and
+// how many fit in its context window, 0 when unknown
+type Model struct {
+	Encoding      string
+	ContextWindow int
+}
+
+// Models lists the built-in models. Dated or suffixed names, such as
+// gpt-4o-2024-08-06, use their longest listed prefix.
+var Models = map[string]Model{
+	"gpt-3.5-turbo": {Encoding: Cl100kBase, ContextWindow: 16385},
+	"gpt-4":         {Encoding: Cl100kBase, ContextWindow: 8192},
+	"gpt-4-turbo":   {Encoding: Cl100kBase, ContextWindow: 128000},
+	"gpt-4o":        {Encoding: O200kBase, ContextWindow: 128000},
+	"gpt-4o-mini":   {Encoding: O200kBase, ContextWindow: 128000},
+	"claude":        {Encoding: Approximate, ContextWindow: 200000},
+}
+
+var (
+	modelsMu  sync.RWMutex
+	overrides map[string]Model
+)
+
+// SetModels replaces the configured models, which override or extend Models.
+// A configured model without an encoding keeps the built-in one.
+func SetModels(configured map[string]Model) {
+	table := make(map[string]Model, len(configured))
+	for name, model := range configured {
+		table[strings.ToLower(name)] = model
+	}
+
+	modelsMu.Lock()
+	overrides = table
+	modelsMu.Unlock()
+}
+
+// ForModel returns the configured or built-in entry for model. Unknown
+// models are counted approximately and have no context window.
+func ForModel(model string) Model {
+	model = strings.ToLower(model)
+
+	builtin, ok := Models[model]
+	if !ok {
+		builtin = Model{Encoding: Approximate}
+		longest := 0
+		for name, m := range Models {
+			if len(name) > longest && strings.HasPrefix(model, name) {
+				builtin, longest = m, len(name)
+			}
+		}
+	}
+
+	modelsMu.RLock()
+	configured, ok := overrides[model]
+	modelsMu.RUnlock()
+	if !ok {
+		return builtin
+	}
+	if configured.Encoding == "" {
+		configured.Encoding = builtin.Encoding
+	}
+	if configured.ContextWindow == 0 {
+		configured.ContextWindow = builtin.ContextWindow
+	}
+	return configured
+}
+
+// Counter returns the counter for the model's encoding
+func (m Model) Counter() (Counter, error) {
+	if m.Encoding == Approximate || m.Encoding == "" {
+		base, err := GetEncoding(Cl100kBase)
+		if err != nil {
+			return nil, err
+		}
+		return approximation{base: base}, nil
+	}
+	return GetEncoding(m.Encoding)
+}
+
+// approximation estimates counts from cl100k_base with a margin
+type approximation struct {
+	base *Encoding
+}
+
+func (a approximation) Name() string {
+	return Approximate
+}
+
+func (a approximation) Exact() bool {
+	return false
+}
+
+func (a approximation) Count(text string) int {
+	return int(math.Ceil(float64(a.base.Count(text)) * ApproximationMargin))
+}
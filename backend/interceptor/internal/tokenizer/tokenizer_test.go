@@ -0,0 +1,151 @@
+package tokenizer
+
+import (
+	"errors"
+	"interceptor/internal/tools"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// Token IDs published with OpenAI's tiktoken for the same inputs
+func TestEncodeMatchesTiktoken(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		want     []int
+	}{
+		{Cl100kBase, "hello world", []int{15339, 1917}},
+		{Cl100kBase, "tiktoken is great!", []int{83, 1609, 5963, 374, 2294, 0}},
+		{Cl100kBase, "hello  world", []int{15339, 220, 1917}},
+		{O200kBase, "hello world", []int{24912, 2375}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding+"/"+tt.text, func(t *testing.T) {
+			enc, err := GetEncoding(tt.encoding)
+			if err != nil {
+				t.Fatalf("GetEncoding: %v", err)
+			}
+			if got := enc.Encode(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if got := enc.Count(tt.text); got != len(tt.want) {
+				t.Fatalf("count: got %d, want %d", got, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestUnknownEncoding(t *testing.T) {
+	if _, err := GetEncoding("p50k_base"); err == nil {
+		t.Fatal("unknown encoding loaded")
+	}
+}
+
+func TestForModel(t *testing.T) {
+	t.Cleanup(func() { SetModels(nil) })
+
+	tests := []struct {
+		model    string
+		encoding string
+		window   int
+	}{
+		{"gpt-4o", O200kBase, 128000},
+		{"GPT-4o-2024-08-06", O200kBase, 128000},
+		{"gpt-4-0613", Cl100kBase, 8192},
+		{"claude-3-5-sonnet-latest", Approximate, 200000},
+		{"llama-3", Approximate, 0},
+	}
+	for _, tt := range tests {
+		if got := ForModel(tt.model); got.Encoding != tt.encoding || got.ContextWindow != tt.window {
+			t.Errorf("%s: got %+v, want %s/%d", tt.model, got, tt.encoding, tt.window)
+		}
+	}
+
+	SetModels(map[string]Model{"GPT-4o": {ContextWindow: 64000}, "llama-3": {Encoding: Cl100kBase, ContextWindow: 8192}})
+	if got := ForModel("gpt-4o"); got.Encoding != O200kBase || got.ContextWindow != 64000 {
+		t.Errorf("override keeps the built-in encoding: got %+v", got)
+	}
+	if got := ForModel("llama-3"); got.Encoding != Cl100kBase || got.ContextWindow != 8192 {
+		t.Errorf("configured model: got %+v", got)
+	}
+}
+
+func TestApproximationErrsHigh(t *testing.T) {
+	counter, err := ForModel("claude-3-opus").Counter()
+	if err != nil {
+		t.Fatalf("Counter: %v", err)
+	}
+	base, _ := GetEncoding(Cl100kBase)
+
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 20)
+	if counter.Exact() || counter.Count(text) <= base.Count(text) {
+		t.Fatalf("approximation counted %d against %d exact", counter.Count(text), base.Count(text))
+	}
+}
+
+// runeCounter counts one token per rune so budgets are easy to reason about
+type runeCounter struct{}
+
+func (runeCounter) Name() string          { return "runes" }
+func (runeCounter) Exact() bool           { return true }
+func (runeCounter) Count(text string) int { return utf8.RuneCountInString(text) }
+
+func TestFitMessages(t *testing.T) {
+	system := Message{Role: "system", Content: "be brief"}
+	old := Message{Role: "user", Content: strings.Repeat("a", 40)}
+	reply := Message{Role: "assistant", Content: strings.Repeat("b", 40)}
+	last := Message{Role: "user", Content: "what now?"}
+	messages := []Message{system, old, reply, last}
+	total := CountMessages(runeCounter{}, messages)
+
+	fit, err := FitMessages(runeCounter{}, messages, total, OverflowReject)
+	if err != nil || fit.Truncated() || fit.PromptTokens != total {
+		t.Fatalf("fitting conversation: got %+v, %v", fit, err)
+	}
+
+	var contextErr *ContextError
+	if _, err := FitMessages(runeCounter{}, messages, total-1, OverflowReject); !errors.As(err, &contextErr) || contextErr.PromptTokens != total {
+		t.Fatalf("reject: got %v", err)
+	}
+
+	fit, err = FitMessages(runeCounter{}, messages, total-40, OverflowTruncate)
+	if err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	if fit.Dropped != 1 || fit.Messages[0].Content != system.Content || fit.Messages[1].Content != reply.Content || fit.PromptTokens > total-40 {
+		t.Fatalf("truncate dropped the wrong messages: %+v", fit)
+	}
+
+	// A budget too small for any history trims the start of the last message
+	budget := CountMessages(runeCounter{}, []Message{system, {Role: "user", Content: "now?"}})
+	fit, err = FitMessages(runeCounter{}, messages, budget, OverflowTruncate)
+	if err != nil || !fit.Trimmed || fit.Messages[len(fit.Messages)-1].Content != "now?" {
+		t.Fatalf("trim: got %+v, %v", fit, err)
+	}
+
+	if _, err := FitMessages(runeCounter{}, messages, 5, OverflowTruncate); !errors.As(err, &contextErr) {
+		t.Fatalf("system prompt over budget: got %v", err)
+	}
+}
+
+func TestFitMessagesDropsToolResultsWithTheirCall(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: strings.Repeat("a", 40)},
+		{Role: "assistant", ToolCalls: []tools.Call{{ID: "call_1", Name: "key_status", Arguments: "{}"}}},
+		{Role: "tool", ToolCallID: "call_1", Content: strings.Repeat("r", 40)},
+		{Role: "user", Content: "thanks"},
+	}
+	budget := CountMessages(runeCounter{}, messages[3:]) + 5
+
+	fit, err := FitMessages(runeCounter{}, messages, budget, OverflowTruncate)
+	if err != nil {
+		t.Fatalf("FitMessages: %v", err)
+	}
+	for _, m := range fit.Messages {
+		if m.Role == "tool" {
+			t.Fatalf("tool result kept without its call: %+v", fit.Messages)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interceptor/internal/keyring"
+	"strings"
+)
+
+// KeyStatusName is the name of the key status tool
+const KeyStatusName = "key_status"
+
+// keyStatus is what the model learns about one key; never the key itself
+type keyStatus struct {
+	Address  string `json:"address"`
+	Name     string `json:"name,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	// Status is active, retired (rotated out or revoked) or unavailable
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// KeyStatus returns a tool that checks whether the caller has a usable key in
+// the on-chain keyring, by name or as the default for a provider. It resolves
+// the key the way a completion would, and reports only its name, provider and
+// status. Listing every key needs the owner's signature, so it is not offered.
+func KeyStatus(client *keyring.Client) Tool {
+	return Tool{
+		Definition: Definition{
+			Name:        KeyStatusName,
+			Description: "Check whether the caller has a usable API key stored in the on-chain keyring: the named key, or the default key for a provider. Returns the key's name, provider and whether it is active, retired or unavailable. Key material is never returned.",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"name":{"type":"string","description":"The key to check"},"provider":{"type":"string","description":"Check the default key for this provider, such as openai or anthropic"}}}`),
+		},
+		Run: func(ctx context.Context, caller string, arguments json.RawMessage) (interface{}, error) {
+			var filter struct {
+				Name     string `json:"name"`
+				Provider string `json:"provider"`
+			}
+			if err := json.Unmarshal(arguments, &filter); err != nil {
+				return nil, fmt.Errorf("arguments must be an object with optional name and provider")
+			}
+
+			status := keyStatus{Address: caller, Name: filter.Name, Provider: strings.ToLower(filter.Provider)}
+			reply, err := client.ResolveKey(ctx, caller, filter.Name, status.Provider)
+			switch {
+			case errors.Is(err, keyring.ErrKeyRetired):
+				status.Status = "retired"
+			case errors.Is(err, keyring.ErrTimeout):
+				return nil, fmt.Errorf("failed to check key: %v", err)
+			case err != nil:
+				status.Status = "unavailable"
+				status.Detail = err.Error()
+			default:
+				status.Status = "active"
+				status.Name = reply.Name
+				status.Provider = reply.Provider
+				reply.Key = ""
+			}
+			return status, nil
+		},
+	}
+}
@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Choices for whether the model calls a tool; any other choice names the
+// tool it must call
+const (
+	ChoiceAuto     = "auto"
+	ChoiceNone     = "none"
+	ChoiceRequired = "required"
+)
+
+// Definition describes a tool the model may call
+type Definition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the JSON schema of the arguments
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// Call is the model asking for a tool to run
+type Call struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Arguments is a JSON object, as the model wrote it
+	Arguments string `json:"arguments"`
+}
+
+// Func runs a tool for caller and returns a result to marshal for the model
+type Func func(ctx context.Context, caller string, arguments json.RawMessage) (interface{}, error)
+
+// Tool is a trusted tool that runs inside the proxy
+type Tool struct {
+	Definition
+	Run Func
+}
+
+// Registry holds the tools the proxy runs itself
+type Registry struct {
+	tools   map[string]Tool
+	timeout time.Duration
+}
+
+// NewRegistry creates a registry whose tool runs are bounded by timeout
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{tools: make(map[string]Tool), timeout: timeout}
+}
+
+// Register adds a tool, replacing any of the same name
+func (r *Registry) Register(tool Tool) {
+	r.tools[tool.Name] = tool
+}
+
+// Has reports whether name is a registered tool
+func (r *Registry) Has(name string) bool {
+	_, ok := r.tools[name]
+	return ok
+}
+
+// Definitions returns the definitions of the named tools, or of every tool
+// when names is empty, ordered by name
+func (r *Registry) Definitions(names []string) []Definition {
+	if len(names) == 0 {
+		for name := range r.tools {
+			names = append(names, name)
+		}
+	}
+	definitions := make([]Definition, 0, len(names))
+	for _, name := range names {
+		if tool, ok := r.tools[name]; ok {
+			definitions = append(definitions, tool.Definition)
+		}
+	}
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Name < definitions[j].Name })
+	return definitions
+}
+
+// Run runs a call for caller and returns the result as the model sees it. A
+// failing tool is reported to the model in the result, so it can recover.
+func (r *Registry) Run(ctx context.Context, caller string, call Call) (string, error) {
+	tool, ok := r.tools[call.Name]
+	if !ok {
+		return ErrorResult(fmt.Sprintf("unknown tool %q", call.Name)), fmt.Errorf("unknown tool %q", call.Name)
+	}
+
+	arguments := json.RawMessage(call.Arguments)
+	if call.Arguments == "" {
+		arguments = json.RawMessage("{}")
+	}
+	if !json.Valid(arguments) {
+		return ErrorResult("arguments are not valid JSON"), fmt.Errorf("arguments of %s are not valid JSON", call.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result, err := tool.Run(ctx, caller, arguments)
+	if err != nil {
+		return ErrorResult(err.Error()), err
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return ErrorResult("result could not be encoded"), fmt.Errorf("failed to marshal %s result: %v", call.Name, err)
+	}
+	return string(encoded), nil
+}
+
+// ErrorResult is the result the model sees for a tool that failed
+func ErrorResult(message string) string {
+	encoded, _ := json.Marshal(map[string]string{"error": message})
+	return string(encoded)
+}
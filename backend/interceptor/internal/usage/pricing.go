@@ -0,0 +1,80 @@
+package usage
+
+import (
+	"strings"
+	"sync"
+)
+
+// Price is the USD cost per million prompt and completion tokens
+type Price struct {
+	Prompt     float64
+	Completion float64
+}
+
+// Prices lists the built-in per-model prices
+var Prices = map[string]Price{
+	"gpt-3.5-turbo": {Prompt: 0.50, Completion: 1.50},
+	"gpt-4":         {Prompt: 30.00, Completion: 60.00},
+	"gpt-4-turbo":   {Prompt: 10.00, Completion: 30.00},
+	"gpt-4o":        {Prompt: 2.50, Completion: 10.00},
+	"gpt-4o-mini":   {Prompt: 0.15, Completion: 0.60},
+}
+
+// DefaultPrice is charged for models missing from Prices so caps still apply
+var DefaultPrice = Price{Prompt: 30.00, Completion: 60.00}
+
+var (
+	pricesMu  sync.RWMutex
+	overrides map[string]Price
+)
+
+// SetPrices replaces the configured prices, which override or extend Prices.
+// It is safe to call while requests are being priced.
+func SetPrices(configured map[string]Price) {
+	table := make(map[string]Price, len(configured))
+	for model, price := range configured {
+		table[strings.ToLower(model)] = price
+	}
+
+	pricesMu.Lock()
+	overrides = table
+	pricesMu.Unlock()
+}
+
+// PriceFor returns the price charged for a model
+func PriceFor(model string) Price {
+	model = strings.ToLower(model)
+
+	pricesMu.RLock()
+	price, ok := overrides[model]
+	pricesMu.RUnlock()
+	if ok {
+		return price
+	}
+
+	if price, ok := Prices[model]; ok {
+		return price
+	}
+	return DefaultPrice
+}
+
+// KnownModel reports whether model has a built-in or configured price
+func KnownModel(model string) bool {
+	model = strings.ToLower(model)
+
+	pricesMu.RLock()
+	_, ok := overrides[model]
+	pricesMu.RUnlock()
+	if ok {
+		return true
+	}
+
+	_, ok = Prices[model]
+	return ok
+}
+
+// Cost returns the USD cost of a call
+func Cost(model string, promptTokens, completionTokens int) float64 {
+	price := PriceFor(model)
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1_000_000
+}
@@ -0,0 +1,189 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Record describes a single LLM call made with a stored key
+type Record struct {
+	Timestamp        time.Time `json:"timestamp"`
+	Address          string    `json:"address"`
+	KeyOwner         string    `json:"key_owner"`
+	KeyName          string    `json:"key_name,omitempty"`
+	GrantID          string    `json:"grant_id,omitempty"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost"`
+	// RequestedModel is set when failover served a different model
+	RequestedModel string `json:"requested_model,omitempty"`
+	// Route is the provider/model that served the call, and Attempts the
+	// provider calls it took
+	Route    string `json:"route,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+}
+
+// ErrSpendCap is returned when a reservation would take a grant past its cap
+var ErrSpendCap = errors.New("grant spending cap reached")
+
+// Recorder appends usage records to a JSON-lines file and keeps running totals
+type Recorder struct {
+	mu         sync.Mutex
+	file       *os.File
+	grantSpend map[string]float64
+	// grantHeld is budget reserved by calls still in flight
+	grantHeld map[string]float64
+	hooks     []func(Record, float64)
+}
+
+// Reservation holds part of a grant's budget while a call is in flight
+type Reservation struct {
+	recorder *Recorder
+	grantID  string
+	amount   float64
+	once     sync.Once
+}
+
+// NewRecorder opens the usage log at path and replays it to rebuild totals
+func NewRecorder(path string) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create usage directory: %v", err)
+	}
+
+	r := &Recorder{
+		grantSpend: make(map[string]float64),
+		grantHeld:  make(map[string]float64),
+	}
+
+	if err := r.replay(path); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage file: %v", err)
+	}
+	r.file = file
+
+	return r, nil
+}
+
+func (r *Recorder) replay(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open usage file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		if rec.GrantID != "" {
+			r.grantSpend[rec.GrantID] += rec.Cost
+		}
+	}
+	return scanner.Err()
+}
+
+// Record fills in the cost and timestamp and appends the record to the log
+func (r *Recorder) Record(rec Record) error {
+	if rec.Timestamp.IsZero() {
+		rec.Timestamp = time.Now().UTC()
+	}
+	rec.Cost = Cost(rec.Model, rec.PromptTokens, rec.CompletionTokens)
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage record: %v", err)
+	}
+
+	r.mu.Lock()
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		r.mu.Unlock()
+		return fmt.Errorf("failed to write usage record: %v", err)
+	}
+	var spent float64
+	if rec.GrantID != "" {
+		r.grantSpend[rec.GrantID] += rec.Cost
+		spent = r.grantSpend[rec.GrantID]
+	}
+	hooks := append([]func(Record, float64){}, r.hooks...)
+	r.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(rec, spent)
+	}
+	return nil
+}
+
+// OnRecord registers a hook that runs after each record is written, with the
+// record's cost filled in and its grant's spend including it
+func (r *Recorder) OnRecord(hook func(rec Record, grantSpend float64)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, hook)
+}
+
+// GrantSpend returns the total cost recorded against a grant
+func (r *Recorder) GrantSpend(grantID string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.grantSpend[grantID]
+}
+
+// Reserve holds amount of a grant's budget, provided what it has spent, what
+// calls in flight hold and amount stay within limit. Checking and holding
+// happen under one lock, so concurrent calls cannot together overspend.
+func (r *Recorder) Reserve(grantID string, limit, amount float64) (*Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.grantSpend[grantID]+r.grantHeld[grantID]+amount > limit {
+		return nil, ErrSpendCap
+	}
+	r.grantHeld[grantID] += amount
+	return &Reservation{recorder: r, grantID: grantID, amount: amount}, nil
+}
+
+// Committed returns what a grant has spent plus what calls in flight hold
+func (r *Recorder) Committed(grantID string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.grantSpend[grantID] + r.grantHeld[grantID]
+}
+
+// Release returns the held budget, once the call's usage is recorded or it
+// failed; releasing twice or a nil reservation does nothing
+func (res *Reservation) Release() {
+	if res == nil {
+		return
+	}
+	res.once.Do(func() {
+		r := res.recorder
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.grantHeld[res.grantID] -= res.amount
+		if r.grantHeld[res.grantID] <= 0 {
+			delete(r.grantHeld, res.grantID)
+		}
+	})
+}
+
+// Close closes the usage log
+func (r *Recorder) Close() {
+	if r.file != nil {
+		r.file.Close()
+	}
+}
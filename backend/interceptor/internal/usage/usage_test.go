@@ -0,0 +1,82 @@
+package usage
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func newTestRecorder(t *testing.T) *Recorder {
+	t.Helper()
+	recorder, err := NewRecorder(filepath.Join(t.TempDir(), "usage.jsonl"))
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	t.Cleanup(recorder.Close)
+	return recorder
+}
+
+func TestReserveHoldsBudgetUntilReleased(t *testing.T) {
+	recorder := newTestRecorder(t)
+
+	first, err := recorder.Reserve("grant", 1.0, 0.6)
+	if err != nil {
+		t.Fatalf("first reservation: %v", err)
+	}
+	if _, err := recorder.Reserve("grant", 1.0, 0.6); !errors.Is(err, ErrSpendCap) {
+		t.Fatalf("second reservation: got %v, want ErrSpendCap", err)
+	}
+
+	first.Release()
+	first.Release()
+	if got := recorder.Committed("grant"); got != 0 {
+		t.Fatalf("committed after release: got %v, want 0", got)
+	}
+	if _, err := recorder.Reserve("grant", 1.0, 0.6); err != nil {
+		t.Fatalf("reservation after release: %v", err)
+	}
+}
+
+func TestReserveCountsRecordedSpend(t *testing.T) {
+	recorder := newTestRecorder(t)
+	SetPrices(map[string]Price{"test-model": {Prompt: 1000, Completion: 1000}})
+	t.Cleanup(func() { SetPrices(nil) })
+
+	if err := recorder.Record(Record{GrantID: "grant", Model: "test-model", PromptTokens: 1}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	spent := recorder.GrantSpend("grant")
+	if spent <= 0 {
+		t.Fatalf("grant spend: got %v, want it priced", spent)
+	}
+	if _, err := recorder.Reserve("grant", spent, 0.000001); !errors.Is(err, ErrSpendCap) {
+		t.Fatalf("reservation past recorded spend: got %v, want ErrSpendCap", err)
+	}
+}
+
+func TestReserveConcurrentCallsStayWithinCap(t *testing.T) {
+	recorder := newTestRecorder(t)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		granted int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := recorder.Reserve("grant", 1.0, 0.1); err == nil {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if granted > 10 {
+		t.Fatalf("granted %d reservations of 0.1 against a cap of 1.0", granted)
+	}
+}
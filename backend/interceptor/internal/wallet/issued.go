@@ -0,0 +1,22 @@
+package wallet
+
+import (
+	"fmt"
+	"time"
+)
+
+// SignWindow is how far the signing time of a signed request may be from the
+// server's clock
+const SignWindow = 5 * time.Minute
+
+// CheckIssued verifies that issued is an RFC 3339 time within SignWindow of now
+func CheckIssued(issued string, now time.Time) error {
+	at, err := time.Parse(time.RFC3339, issued)
+	if err != nil {
+		return fmt.Errorf("issued must be an RFC 3339 time")
+	}
+	if at.Sub(now) > SignWindow || now.Sub(at) > SignWindow {
+		return fmt.Errorf("issued must be within %s of the server time", SignWindow)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckIssued(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		issued string
+		ok     bool
+	}{
+		{now.Format(time.RFC3339), true},
+		{now.Add(-4 * time.Minute).Format(time.RFC3339), true},
+		{now.Add(4 * time.Minute).Format(time.RFC3339), true},
+		{now.Add(-6 * time.Minute).Format(time.RFC3339), false},
+		{now.Add(6 * time.Minute).Format(time.RFC3339), false},
+		{"yesterday", false},
+	}
+	for _, tt := range tests {
+		if err := CheckIssued(tt.issued, now); (err == nil) != tt.ok {
+			t.Errorf("CheckIssued(%q): got %v, want ok=%v", tt.issued, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+// keccak256 hashes data with the legacy Keccak used by Ethereum
+func keccak256(data ...[]byte) []byte {
+	hash := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		hash.Write(d)
+	}
+	return hash.Sum(nil)
+}
+
+// personalMessageHash returns the EIP-191 hash that wallets sign for personal_sign
+func personalMessageHash(message string) []byte {
+	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(message))
+	return keccak256([]byte(prefix), []byte(message))
+}
+
+// RecoverAddress returns the lowercase address that produced a personal_sign signature
+func RecoverAddress(message, signature string) (string, error) {
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "0x"))
+	if err != nil {
+		return "", fmt.Errorf("signature is not valid hex: %v", err)
+	}
+	if len(sig) != 65 {
+		return "", fmt.Errorf("signature must be 65 bytes, got %d", len(sig))
+	}
+
+	// Wallets emit R || S || V with V in {0, 1, 27, 28}; the compact
+	// format expects V first, offset by 27
+	v := sig[64]
+	if v < 27 {
+		v += 27
+	}
+	if v != 27 && v != 28 {
+		return "", fmt.Errorf("invalid signature recovery id %d", sig[64])
+	}
+
+	compact := make([]byte, 65)
+	compact[0] = v
+	copy(compact[1:], sig[:64])
+
+	pubKey, _, err := ecdsa.RecoverCompact(compact, personalMessageHash(message))
+	if err != nil {
+		return "", fmt.Errorf("failed to recover public key: %v", err)
+	}
+
+	// The address is the last 20 bytes of the hash of the uncompressed key
+	uncompressed := pubKey.SerializeUncompressed()
+	return "0x" + hex.EncodeToString(keccak256(uncompressed[1:])[12:]), nil
+}
+
+// VerifySigner checks that message was signed by the expected address
+func VerifySigner(message, signature, expected string) error {
+	signer, err := RecoverAddress(message, signature)
+	if err != nil {
+		return err
+	}
+	if signer != strings.ToLower(expected) {
+		return fmt.Errorf("message signed by %s, not by %s", signer, expected)
+	}
+	return nil
+}
+
+// IsAddress reports whether s looks like a hex-encoded Ethereum address
+func IsAddress(s string) bool {
+	if len(s) != 42 || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	_, err := hex.DecodeString(s[2:])
+	return err == nil
+}
@@ -0,0 +1,288 @@
+package webhooks
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store persists subscriptions and the delivery log
+type Store interface {
+	GetSubscription(address string) (*Subscription, error)
+	// PutSubscription registers or replaces a webhook; nonce must be unused
+	PutSubscription(sub *Subscription, nonce string) error
+	DeleteSubscription(address, nonce string) error
+	// CreateDelivery logs a new delivery; a delivery ID is only logged once
+	CreateDelivery(delivery *Delivery) error
+	UpdateDelivery(delivery *Delivery) error
+	GetDelivery(id string) (*Delivery, error)
+	// ListDeliveries returns an address's most recent deliveries, newest first
+	ListDeliveries(address string, limit int) ([]*Delivery, error)
+	// Pending returns the deliveries still to be attempted
+	Pending() ([]*Delivery, error)
+	Close() error
+}
+
+var (
+	// ErrNotFound is returned for an unknown subscription or delivery
+	ErrNotFound = fmt.Errorf("webhook not found")
+	// ErrNonceUsed is returned when a signed request is replayed
+	ErrNonceUsed = fmt.Errorf("nonce has already been used")
+	// ErrDuplicate is returned when a delivery ID is already logged
+	ErrDuplicate = fmt.Errorf("delivery already logged")
+)
+
+// Buckets of the webhook database. Nonces and the delivery log hold one
+// nested bucket per address; pending indexes deliveries still to be sent.
+var (
+	subscriptionsBucket = []byte("subscriptions")
+	noncesBucket        = []byte("nonces")
+	deliveriesBucket    = []byte("deliveries")
+	logBucket           = []byte("log")
+	pendingBucket       = []byte("pending")
+)
+
+// BoltStore keeps webhooks in an embedded bbolt database
+type BoltStore struct {
+	db *bolt.DB
+	// logSize is how many deliveries are kept per address
+	logSize int
+}
+
+// NewBoltStore opens or creates the database at path, keeping the last
+// logSize deliveries of each address
+func NewBoltStore(path string, logSize int) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create webhooks directory: %v", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open webhooks database: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{subscriptionsBucket, noncesBucket, deliveriesBucket, logBucket, pendingBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize webhooks database: %v", err)
+	}
+
+	return &BoltStore{db: db, logSize: logSize}, nil
+}
+
+// GetSubscription returns the webhook registered for address
+func (s *BoltStore) GetSubscription(address string) (*Subscription, error) {
+	var sub Subscription
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(subscriptionsBucket).Get([]byte(address))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &sub)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// PutSubscription registers or replaces the webhook of sub.Address
+func (s *BoltStore) PutSubscription(sub *Subscription, nonce string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := useNonce(tx, sub.Address, nonce); err != nil {
+			return err
+		}
+		data, err := json.Marshal(sub)
+		if err != nil {
+			return fmt.Errorf("failed to marshal subscription: %v", err)
+		}
+		return tx.Bucket(subscriptionsBucket).Put([]byte(sub.Address), data)
+	})
+}
+
+// DeleteSubscription removes the webhook of address. Its delivery log is kept.
+func (s *BoltStore) DeleteSubscription(address, nonce string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(subscriptionsBucket).Get([]byte(address)) == nil {
+			return ErrNotFound
+		}
+		if err := useNonce(tx, address, nonce); err != nil {
+			return err
+		}
+		return tx.Bucket(subscriptionsBucket).Delete([]byte(address))
+	})
+}
+
+// CreateDelivery logs a new delivery and drops the address's oldest settled
+// deliveries past the log size
+func (s *BoltStore) CreateDelivery(delivery *Delivery) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(deliveriesBucket).Get([]byte(delivery.ID)) != nil {
+			return ErrDuplicate
+		}
+		if err := putDelivery(tx, delivery); err != nil {
+			return err
+		}
+
+		index, err := tx.Bucket(logBucket).CreateBucketIfNotExists([]byte(delivery.Address))
+		if err != nil {
+			return err
+		}
+		if err := index.Put(logKey(delivery), []byte(delivery.ID)); err != nil {
+			return err
+		}
+		return s.prune(tx, index)
+	})
+}
+
+// UpdateDelivery stores a delivery's new state
+func (s *BoltStore) UpdateDelivery(delivery *Delivery) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(deliveriesBucket).Get([]byte(delivery.ID)) == nil {
+			return ErrNotFound
+		}
+		return putDelivery(tx, delivery)
+	})
+}
+
+// GetDelivery returns the delivery with the given ID
+func (s *BoltStore) GetDelivery(id string) (*Delivery, error) {
+	var delivery *Delivery
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		delivery, err = getDelivery(tx, []byte(id))
+		return err
+	})
+	return delivery, err
+}
+
+// ListDeliveries returns up to limit of the address's deliveries, newest first
+func (s *BoltStore) ListDeliveries(address string, limit int) ([]*Delivery, error) {
+	list := make([]*Delivery, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(logBucket).Bucket([]byte(address))
+		if index == nil {
+			return nil
+		}
+		cursor := index.Cursor()
+		for k, id := cursor.Last(); k != nil && len(list) < limit; k, id = cursor.Prev() {
+			delivery, err := getDelivery(tx, id)
+			if err != nil {
+				return err
+			}
+			list = append(list, delivery)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// Pending returns the deliveries still to be attempted
+func (s *BoltStore) Pending() ([]*Delivery, error) {
+	list := make([]*Delivery, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).ForEach(func(id, _ []byte) error {
+			delivery, err := getDelivery(tx, id)
+			if err != nil {
+				return err
+			}
+			list = append(list, delivery)
+			return nil
+		})
+	})
+	return list, err
+}
+
+// Close closes the database
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// prune drops the oldest settled deliveries while the log is over its size;
+// pending deliveries are kept until they settle
+func (s *BoltStore) prune(tx *bolt.Tx, index *bolt.Bucket) error {
+	excess := -s.logSize
+	cursor := index.Cursor()
+	for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+		excess++
+	}
+
+	var keys, ids [][]byte
+	for k, id := cursor.First(); k != nil && len(keys) < excess; k, id = cursor.Next() {
+		if tx.Bucket(pendingBucket).Get(id) == nil {
+			keys = append(keys, append([]byte{}, k...))
+			ids = append(ids, append([]byte{}, id...))
+		}
+	}
+
+	for i := range keys {
+		if err := tx.Bucket(deliveriesBucket).Delete(ids[i]); err != nil {
+			return err
+		}
+		if err := index.Delete(keys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// useNonce records nonce for address, failing if it was used before
+func useNonce(tx *bolt.Tx, address, nonce string) error {
+	if nonce == "" {
+		return fmt.Errorf("nonce is required")
+	}
+	nonces, err := tx.Bucket(noncesBucket).CreateBucketIfNotExists([]byte(address))
+	if err != nil {
+		return err
+	}
+	if nonces.Get([]byte(nonce)) != nil {
+		return ErrNonceUsed
+	}
+	return nonces.Put([]byte(nonce), nil)
+}
+
+func getDelivery(tx *bolt.Tx, id []byte) (*Delivery, error) {
+	data := tx.Bucket(deliveriesBucket).Get(id)
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	var delivery Delivery
+	if err := json.Unmarshal(data, &delivery); err != nil {
+		return nil, fmt.Errorf("failed to parse delivery %s: %v", id, err)
+	}
+	return &delivery, nil
+}
+
+// putDelivery writes a delivery and keeps the pending index in step
+func putDelivery(tx *bolt.Tx, delivery *Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal delivery: %v", err)
+	}
+	if err := tx.Bucket(deliveriesBucket).Put([]byte(delivery.ID), data); err != nil {
+		return err
+	}
+	if delivery.Status == StatusPending {
+		return tx.Bucket(pendingBucket).Put([]byte(delivery.ID), nil)
+	}
+	return tx.Bucket(pendingBucket).Delete([]byte(delivery.ID))
+}
+
+// logKey orders an address's deliveries by creation time
+func logKey(delivery *Delivery) []byte {
+	key := make([]byte, 8, 8+len(delivery.ID))
+	binary.BigEndian.PutUint64(key, uint64(delivery.CreatedAt.UnixNano()))
+	return append(key, delivery.ID...)
+}
@@ -0,0 +1,324 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"interceptor/internal/metrics"
+	"interceptor/pkg/logger"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Options tune delivery
+type Options struct {
+	// Timeout bounds each POST
+	Timeout     time.Duration
+	MaxAttempts int
+	// BaseDelay is the first backoff, doubled after each failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Concurrency bounds POSTs in flight
+	Concurrency int
+	// AllowPrivate permits webhooks on loopback and private networks
+	AllowPrivate bool
+}
+
+// Dispatcher signs and posts deliveries, retrying failures with backoff.
+// Deliveries still pending at shutdown resume on the next Start.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	opts   Options
+
+	slots    chan struct{}
+	quit     chan struct{}
+	quitOnce sync.Once
+	running  sync.WaitGroup
+}
+
+// NewDispatcher returns a dispatcher over store; call Start to resume
+// pending deliveries
+func NewDispatcher(store Store, opts Options) *Dispatcher {
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivate {
+		dialer.Control = publicOnly
+	}
+
+	return &Dispatcher{
+		store: store,
+		client: &http.Client{
+			Timeout: opts.Timeout,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: opts.Timeout,
+				MaxIdleConnsPerHost: 2,
+			},
+			// A redirect is answered as it stands rather than followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		opts:  opts,
+		slots: make(chan struct{}, opts.Concurrency),
+		quit:  make(chan struct{}),
+	}
+}
+
+// Start resumes the deliveries an earlier run left pending
+func (d *Dispatcher) Start() error {
+	pending, err := d.store.Pending()
+	if err != nil {
+		return fmt.Errorf("failed to load pending deliveries: %v", err)
+	}
+	for _, delivery := range pending {
+		d.send(delivery)
+	}
+	if len(pending) > 0 {
+		logger.Info("Resuming %d pending webhook deliveries", len(pending))
+	}
+	return nil
+}
+
+// Dispatch logs a delivery of n to its address's webhook and starts sending
+// it. Addresses without a webhook, or whose webhook skips the event, get none.
+func (d *Dispatcher) Dispatch(n Notification) error {
+	sub, err := d.store.GetSubscription(n.Address)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !sub.Wants(n.Event) {
+		return nil
+	}
+
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %v", err)
+	}
+
+	now := time.Now().UTC()
+	delivery := &Delivery{
+		ID:        n.ID,
+		Address:   n.Address,
+		Event:     n.Event,
+		URL:       sub.URL,
+		Payload:   payload,
+		Status:    StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := d.store.CreateDelivery(delivery); err != nil {
+		if err == ErrDuplicate {
+			// A notification is delivered once, however often it is raised
+			return nil
+		}
+		return err
+	}
+
+	d.send(delivery)
+	return nil
+}
+
+// Redeliver sends the payload of a logged delivery again, as a new delivery
+// to the address's current webhook
+func (d *Dispatcher) Redeliver(id string) (*Delivery, error) {
+	original, err := d.store.GetDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := d.store.GetSubscription(original.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	delivery := &Delivery{
+		ID:           NewID(),
+		Address:      original.Address,
+		Event:        original.Event,
+		URL:          sub.URL,
+		Payload:      original.Payload,
+		Status:       StatusPending,
+		RedeliveryOf: original.ID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := d.store.CreateDelivery(delivery); err != nil {
+		return nil, err
+	}
+
+	d.send(delivery)
+	return delivery, nil
+}
+
+// Stop ends retries; deliveries still pending stay logged for the next Start
+func (d *Dispatcher) Stop() {
+	d.quitOnce.Do(func() { close(d.quit) })
+}
+
+// Wait blocks until every POST in flight has finished, or until ctx is done
+func (d *Dispatcher) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		d.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook deliveries still running: %v", ctx.Err())
+	}
+}
+
+func (d *Dispatcher) send(delivery *Delivery) {
+	d.running.Add(1)
+	go func() {
+		defer d.running.Done()
+		d.run(delivery)
+	}()
+}
+
+// run attempts a delivery until it succeeds, fails for good or runs out of
+// attempts
+func (d *Dispatcher) run(delivery *Delivery) {
+	log := logger.With("delivery_id", delivery.ID, "address", delivery.Address, "event", delivery.Event)
+
+	for {
+		if delivery.NextAttempt != nil {
+			select {
+			case <-time.After(time.Until(*delivery.NextAttempt)):
+			case <-d.quit:
+				return
+			}
+		}
+
+		select {
+		case d.slots <- struct{}{}:
+		case <-d.quit:
+			return
+		}
+		status, retryable, err := d.attempt(delivery)
+		<-d.slots
+
+		now := time.Now().UTC()
+		delivery.Attempts++
+		delivery.LastStatus = status
+		delivery.LastError = ""
+		delivery.UpdatedAt = now
+		delivery.NextAttempt = nil
+
+		switch {
+		case err == nil:
+			delivery.Status = StatusDelivered
+			delivery.DeliveredAt = &now
+			metrics.WebhookDeliveries.WithLabelValues(delivery.Event, StatusDelivered).Inc()
+			log.Infow("webhook delivered", "attempts", delivery.Attempts, "status_code", status)
+		case retryable && delivery.Attempts < d.opts.MaxAttempts:
+			delivery.LastError = err.Error()
+			next := now.Add(d.backoff(delivery.Attempts))
+			delivery.NextAttempt = &next
+			metrics.WebhookDeliveries.WithLabelValues(delivery.Event, "retried").Inc()
+			log.Warnw("webhook delivery failed, retrying", "attempts", delivery.Attempts, "status_code", status, "error", err, "next_attempt", next)
+		default:
+			delivery.LastError = err.Error()
+			delivery.Status = StatusFailed
+			metrics.WebhookDeliveries.WithLabelValues(delivery.Event, StatusFailed).Inc()
+			log.Warnw("webhook delivery failed", "attempts", delivery.Attempts, "status_code", status, "error", err)
+		}
+
+		if err := d.store.UpdateDelivery(delivery); err != nil {
+			log.Errorw("failed to update webhook delivery", "error", err)
+			return
+		}
+		if delivery.Status != StatusPending {
+			return
+		}
+	}
+}
+
+// attempt posts the delivery once to the address's current webhook, signed
+// with its current secret. It returns the response status and whether a
+// failure is worth retrying.
+func (d *Dispatcher) attempt(delivery *Delivery) (int, bool, error) {
+	sub, err := d.store.GetSubscription(delivery.Address)
+	if err != nil {
+		return 0, false, fmt.Errorf("webhook is no longer registered")
+	}
+	delivery.URL = sub.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to build request: %v", err)
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "b.env-webhooks/1")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, now, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, false, nil
+	}
+	retryable := resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode >= 500
+	return resp.StatusCode, retryable, fmt.Errorf("webhook answered %d", resp.StatusCode)
+}
+
+// backoff returns the wait after the given number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.opts.BaseDelay
+	for i := 1; i < attempts && delay < d.opts.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.opts.MaxDelay {
+		delay = d.opts.MaxDelay
+	}
+	return delay
+}
+
+// publicOnly refuses connections to loopback, private, link-local and other
+// non-public addresses, so a webhook cannot reach internal services. It runs
+// after DNS resolution, on the address actually dialled.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("webhook address %s is not an IP", host)
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("webhook address %s is not public", ip)
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which net.IP.IsPrivate
+// does not cover
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
@@ -0,0 +1,173 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Events a subscription can receive
+const (
+	EventJobFinished        = "job.finished"
+	EventCompletionFinished = "completion.finished"
+	EventBudgetThreshold    = "budget.threshold_crossed"
+	EventKeyRotated         = "key.rotated"
+)
+
+// Events lists every event, in the order they are documented
+var Events = []string{EventJobFinished, EventCompletionFinished, EventBudgetThreshold, EventKeyRotated}
+
+// Headers on every delivery. The signature is "sha256=" and the hex
+// HMAC-SHA256, keyed by the subscription secret, of the timestamp, a dot and
+// the raw body.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Subscription is the webhook registered for an address
+type Subscription struct {
+	Address string `json:"address"`
+	URL     string `json:"url"`
+	// Events limits deliveries to these events; empty means all of them
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Normalize lowercases the address and sorts the events
+func (s *Subscription) Normalize() {
+	s.Address = strings.ToLower(strings.TrimSpace(s.Address))
+	s.URL = strings.TrimSpace(s.URL)
+	for i, event := range s.Events {
+		s.Events[i] = strings.ToLower(strings.TrimSpace(event))
+	}
+	sort.Strings(s.Events)
+}
+
+// Validate checks the URL and events. Plain http is only accepted when
+// allowHTTP is set, for local development.
+func (s *Subscription) Validate(allowHTTP bool) error {
+	if s.Address == "" {
+		return fmt.Errorf("address is required")
+	}
+	target, err := url.Parse(s.URL)
+	if err != nil || target.Host == "" {
+		return fmt.Errorf("url must be an absolute URL")
+	}
+	if target.Scheme != "https" && !(allowHTTP && target.Scheme == "http") {
+		return fmt.Errorf("url must use https")
+	}
+	for _, event := range s.Events {
+		if !knownEvent(event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// Wants reports whether the subscription receives event
+func (s *Subscription) Wants(event string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterMessage returns the canonical text the address signs to register
+// or replace its webhook
+func (s *Subscription) RegisterMessage(issued, nonce string) string {
+	events := "*"
+	if len(s.Events) > 0 {
+		events = strings.Join(s.Events, ",")
+	}
+	return fmt.Sprintf("b.env register webhook\naddress: %s\nurl: %s\nevents: %s\nissued: %s\nnonce: %s", s.Address, s.URL, events, issued, nonce)
+}
+
+// DeleteMessage returns the canonical text the address signs to remove its webhook
+func DeleteMessage(address, issued, nonce string) string {
+	return fmt.Sprintf("b.env delete webhook\naddress: %s\nissued: %s\nnonce: %s", address, issued, nonce)
+}
+
+// Notification is an event raised for an address
+type Notification struct {
+	ID        string          `json:"id"`
+	Address   string          `json:"address"`
+	Event     string          `json:"event"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Delivery is one notification sent, or being sent, to a webhook
+type Delivery struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Event   string `json:"event"`
+	URL     string `json:"url"`
+	// Payload is the body posted; it is left out of listings
+	Payload      json.RawMessage `json:"payload,omitempty"`
+	Status       string          `json:"status"`
+	Attempts     int             `json:"attempts"`
+	LastStatus   int             `json:"last_status,omitempty"`
+	LastError    string          `json:"last_error,omitempty"`
+	RedeliveryOf string          `json:"redelivery_of,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	NextAttempt  *time.Time      `json:"next_attempt,omitempty"`
+	DeliveredAt  *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// Sign returns the signature header value for body sent at timestamp
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret returns a random signing secret
+func NewSecret() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return "whsec_" + hex.EncodeToString(buf)
+}
+
+// NewID returns a random notification or delivery ID
+func NewID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func knownEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignKnownVector(t *testing.T) {
+	// Computed independently: HMAC-SHA256("whsec_test", "1700000000." + body)
+	body := []byte(`{"event":"job.finished"}`)
+	want := "sha256=9b0eafa54f4126899c27a965e58b455e0fda4caf0bb9b16e130511e5dc7b73bd"
+
+	if got := Sign("whsec_test", time.Unix(1700000000, 0), body); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if Sign("whsec_other", time.Unix(1700000000, 0), body) == want {
+		t.Fatal("signature does not depend on the secret")
+	}
+	if Sign("whsec_test", time.Unix(1700000001, 0), body) == want {
+		t.Fatal("signature does not depend on the timestamp")
+	}
+}
+
+// receiver verifies deliveries the way the webhook docs tell subscribers to
+type receiver struct {
+	secret string
+
+	mu       sync.Mutex
+	statuses []int
+	received []*http.Request
+	bodies   [][]byte
+	verified []bool
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	mac := hmac.New(sha256.New, []byte(rc.secret))
+	mac.Write([]byte(r.Header.Get(HeaderTimestamp) + "." + string(body)))
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.received = append(rc.received, r)
+	rc.bodies = append(rc.bodies, body)
+	rc.verified = append(rc.verified, hmac.Equal([]byte(expected), []byte(r.Header.Get(HeaderSignature))))
+
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newTestDispatcher(t *testing.T, rc *receiver) (*Dispatcher, *BoltStore) {
+	t.Helper()
+	server := httptest.NewServer(rc)
+	t.Cleanup(server.Close)
+
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "webhooks.db"), 100)
+	if err != nil {
+		t.Fatalf("NewBoltStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	sub := &Subscription{Address: "0xabc", URL: server.URL, Secret: rc.secret}
+	if err := store.PutSubscription(sub, "nonce-1"); err != nil {
+		t.Fatalf("PutSubscription: %v", err)
+	}
+
+	d := NewDispatcher(store, Options{
+		Timeout:      time.Second,
+		MaxAttempts:  3,
+		BaseDelay:    time.Millisecond,
+		MaxDelay:     5 * time.Millisecond,
+		Concurrency:  2,
+		AllowPrivate: true,
+	})
+	t.Cleanup(d.Stop)
+	return d, store
+}
+
+// waitSettled waits for the delivery to leave the pending state
+func waitSettled(t *testing.T, d *Dispatcher, store *BoltStore, id string) *Delivery {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	delivery, err := store.GetDelivery(id)
+	if err != nil {
+		t.Fatalf("GetDelivery: %v", err)
+	}
+	return delivery
+}
+
+func TestDeliveryIsSignedAndVerifiable(t *testing.T) {
+	rc := &receiver{secret: NewSecret()}
+	d, store := newTestDispatcher(t, rc)
+
+	n := Notification{ID: NewID(), Address: "0xabc", Event: EventJobFinished, Data: json.RawMessage(`{"job_id":"j1"}`), CreatedAt: time.Now().UTC()}
+	if err := d.Dispatch(n); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	delivery := waitSettled(t, d, store, n.ID)
+
+	if delivery.Status != StatusDelivered || len(rc.received) != 1 {
+		t.Fatalf("got status %s after %d requests", delivery.Status, len(rc.received))
+	}
+	if !rc.verified[0] {
+		t.Fatal("receiver could not verify the signature")
+	}
+	req := rc.received[0]
+	if req.Header.Get(HeaderEvent) != EventJobFinished || req.Header.Get(HeaderDelivery) != n.ID {
+		t.Fatalf("headers: %v", req.Header)
+	}
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)) > time.Minute {
+		t.Fatalf("timestamp header %q", req.Header.Get(HeaderTimestamp))
+	}
+
+	var sent Notification
+	if err := json.Unmarshal(rc.bodies[0], &sent); err != nil || sent.ID != n.ID {
+		t.Fatalf("body: %s", rc.bodies[0])
+	}
+}
+
+func TestDeliveryWithWrongSecretFailsVerification(t *testing.T) {
+	rc := &receiver{secret: NewSecret()}
+	d, store := newTestDispatcher(t, rc)
+	// The receiver keeps the old secret after the subscription rotates it
+	if err := store.PutSubscription(&Subscription{Address: "0xabc", URL: mustSubscription(t, store).URL, Secret: NewSecret()}, "nonce-2"); err != nil {
+		t.Fatalf("PutSubscription: %v", err)
+	}
+
+	n := Notification{ID: NewID(), Address: "0xabc", Event: EventKeyRotated, CreatedAt: time.Now().UTC()}
+	if err := d.Dispatch(n); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	waitSettled(t, d, store, n.ID)
+
+	if len(rc.verified) != 1 || rc.verified[0] {
+		t.Fatal("signature under another secret verified")
+	}
+}
+
+func TestDeliveryRetriesAndResigns(t *testing.T) {
+	rc := &receiver{secret: NewSecret(), statuses: []int{http.StatusServiceUnavailable, http.StatusOK}}
+	d, store := newTestDispatcher(t, rc)
+
+	n := Notification{ID: NewID(), Address: "0xabc", Event: EventCompletionFinished, CreatedAt: time.Now().UTC()}
+	if err := d.Dispatch(n); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	delivery := waitSettled(t, d, store, n.ID)
+
+	if delivery.Status != StatusDelivered || delivery.Attempts != 2 {
+		t.Fatalf("got status %s after %d attempts", delivery.Status, delivery.Attempts)
+	}
+	for i, ok := range rc.verified {
+		if !ok {
+			t.Fatalf("attempt %d was not verifiable", i+1)
+		}
+	}
+}
+
+func TestDeliveryGivesUpOnClientErrors(t *testing.T) {
+	rc := &receiver{secret: NewSecret(), statuses: []int{http.StatusGone}}
+	d, store := newTestDispatcher(t, rc)
+
+	n := Notification{ID: NewID(), Address: "0xabc", Event: EventBudgetThreshold, CreatedAt: time.Now().UTC()}
+	if err := d.Dispatch(n); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	delivery := waitSettled(t, d, store, n.ID)
+
+	if delivery.Status != StatusFailed || delivery.Attempts != 1 || delivery.LastStatus != http.StatusGone {
+		t.Fatalf("got %+v", delivery)
+	}
+}
+
+func mustSubscription(t *testing.T, store *BoltStore) *Subscription {
+	t.Helper()
+	sub, err := store.GetSubscription("0xabc")
+	if err != nil {
+		t.Fatalf("GetSubscription: %v", err)
+	}
+	return sub
+}
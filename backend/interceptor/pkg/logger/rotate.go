@@ -0,0 +1,268 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp embedded in rotated file names,
+// e.g. logs/app-2024-05-01T13-04-05.000.log
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateOptions controls when a RotatingFile rolls over and which backups it keeps
+type RotateOptions struct {
+	MaxSizeMB  int  // roll over once the file would exceed this size; 0 disables
+	Daily      bool // roll over on the first write of a new local day
+	MaxBackups int  // rotated files to keep; 0 keeps all
+	MaxAgeDays int  // delete rotated files older than this; 0 keeps all
+	Compress   bool // gzip rotated files
+}
+
+// RotatingFile is an io.Writer over a log file that rotates by size and by
+// day, prunes old backups and can be reopened after an external rename
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	day    string
+	millMu sync.Mutex
+}
+
+// OpenRotatingFile opens path for appending, creating its directory if needed
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %v", err)
+	}
+
+	r := &RotatingFile{path: path, opts: opts}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	// Apply the retention limits to backups left by earlier runs
+	go r.mill()
+	return r, nil
+}
+
+// Write implements io.Writer, rotating first when the write would cross a limit
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate forces a rollover regardless of size or day
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rotate()
+}
+
+// Reopen closes and reopens the file at the same path. External logrotate
+// setups move the file away and then signal the process to call this.
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+	return r.open()
+}
+
+// Close closes the current file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	// Flush to disk so the last lines before exit survive a crash of the host
+	r.file.Sync()
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %v", err)
+	}
+
+	r.file = file
+	r.size = info.Size()
+	// An existing file keeps the day it was last written so a restart after
+	// midnight still rotates yesterday's lines out
+	r.day = info.ModTime().Format("2006-01-02")
+	return nil
+}
+
+func (r *RotatingFile) shouldRotate(incoming int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.opts.MaxSizeMB > 0 && r.size+incoming > int64(r.opts.MaxSizeMB)*1024*1024 {
+		return true
+	}
+	return r.opts.Daily && time.Now().Format("2006-01-02") != r.day
+}
+
+// rotate renames the current file to a timestamped backup and opens a fresh
+// one; compression and pruning run in the background. r.mu must be held.
+func (r *RotatingFile) rotate() error {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+
+	if _, err := os.Stat(r.path); err == nil {
+		if err := os.Rename(r.path, r.backupName(time.Now())); err != nil {
+			return fmt.Errorf("failed to rotate log file: %v", err)
+		}
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.day = time.Now().Format("2006-01-02")
+
+	go r.mill()
+	return nil
+}
+
+func (r *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(r.path)
+	base := strings.TrimSuffix(r.path, ext)
+	return fmt.Sprintf("%s-%s%s", base, t.Format(backupTimeFormat), ext)
+}
+
+// backup is a rotated file found next to the live log
+type backup struct {
+	path string
+	at   time.Time
+}
+
+// backups lists rotated files for this log, newest first
+func (r *RotatingFile) backups() ([]backup, error) {
+	dir := filepath.Dir(r.path)
+	ext := filepath.Ext(r.path)
+	prefix := strings.TrimSuffix(filepath.Base(r.path), ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		at, err := time.ParseInLocation(backupTimeFormat, strings.TrimPrefix(stamp, prefix), time.Local)
+		if err != nil {
+			continue
+		}
+		found = append(found, backup{path: filepath.Join(dir, name), at: at})
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].at.After(found[j].at) })
+	return found, nil
+}
+
+// mill compresses uncompressed backups and removes those beyond the limits
+func (r *RotatingFile) mill() {
+	r.millMu.Lock()
+	defer r.millMu.Unlock()
+
+	found, err := r.backups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logger: failed to list log backups: %v\n", err)
+		return
+	}
+
+	cutoff := time.Time{}
+	if r.opts.MaxAgeDays > 0 {
+		cutoff = time.Now().AddDate(0, 0, -r.opts.MaxAgeDays)
+	}
+
+	for i, b := range found {
+		if (r.opts.MaxBackups > 0 && i >= r.opts.MaxBackups) || (!cutoff.IsZero() && b.at.Before(cutoff)) {
+			os.Remove(b.path)
+			continue
+		}
+		if r.opts.Compress && !strings.HasSuffix(b.path, ".gz") {
+			if err := compressFile(b.path); err != nil {
+				fmt.Fprintf(os.Stderr, "logger: failed to compress %s: %v\n", b.path, err)
+			}
+		}
+	}
+}
+
+// compressFile gzips path to path.gz and removes the original
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	src.Close()
+	return os.Remove(path)
+}
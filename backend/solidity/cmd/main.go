@@ -1,33 +1,78 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
-	"os/signal"
 	"solidity/config"
+	"solidity/internal/chain"
+	"solidity/internal/contract"
 	"solidity/internal/handlers"
+	"solidity/internal/health"
+	"solidity/internal/keyring"
+	"solidity/internal/lifecycle"
+	"solidity/internal/metrics"
+	"solidity/internal/providers"
 	"solidity/internal/rabbitmq"
 	"solidity/pkg/logger"
-	"syscall"
+	"time"
 )
 
 func main() {
-	// Load environment variables and configuration
-	config.LoadEnv()
+	// Load the config file, its profile and environment overrides
+	if err := config.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Initialize logger
-	if err := logger.InitLogger(config.AppConfig.Logger.FilePath); err != nil {
+	if err := logger.InitLoggerWithOptions(logger.Options{
+		FilePath: config.AppConfig.Logger.FilePath,
+		MinLevel: config.AppConfig.Logger.MinLevel,
+		Format:   config.AppConfig.Logger.Format,
+		Rotate: logger.RotateOptions{
+			MaxSizeMB:  config.AppConfig.Logger.MaxSizeMB,
+			Daily:      config.AppConfig.Logger.RotateDaily,
+			MaxBackups: config.AppConfig.Logger.MaxBackups,
+			MaxAgeDays: config.AppConfig.Logger.MaxAgeDays,
+			Compress:   config.AppConfig.Logger.Compress,
+		},
+	}); err != nil {
 		panic(fmt.Sprintf("Failed to initialize logger: %v", err))
 	}
+	defer logger.Logger.Close()
 
 	logger.Info("Starting application...")
+	logger.Infow("configuration loaded", "profile", config.AppConfig.Profile, "file", config.AppConfig.File)
+
+	// Shutdown hooks run newest first, so register each one as its resource
+	// is set up
+	lc := lifecycle.New(time.Duration(config.AppConfig.ShutdownTimeout) * time.Second)
+
+	// The log level is the only setting applied live on reload
+	config.OnReload(func(cfg *config.Config) {
+		if err := logger.SetLevel(cfg.Logger.MinLevel); err != nil {
+			logger.Error("Failed to apply log level: %v", err)
+		}
+	})
+	stopWatch := config.Watch(time.Duration(config.AppConfig.WatchInterval) * time.Second)
+	stopSecrets := config.WatchSecrets(time.Duration(config.AppConfig.Secrets.RefreshInterval) * time.Second)
+	lc.OnShutdown("config watchers", func(ctx context.Context) error {
+		stopWatch()
+		stopSecrets()
+		return nil
+	})
 
 	// 4. Connect to RabbitMQ (which uses logger)
 	rmq, err := rabbitmq.ConnectRabbitMQ(config.AppConfig.RabbitMQConsumer.URL)
 	if err != nil {
 		logger.Fatal("Failed to connect to RabbitMQ: %v", err)
 	}
-	defer rmq.Close()
+	lc.OnShutdown("broker connection", func(ctx context.Context) error {
+		rmq.Close()
+		return nil
+	})
 
 	// Get the channel
 	channel := rmq.GetChannel()
@@ -65,6 +110,33 @@ func main() {
 		logger.Fatal("Failed to create consumer: %v", err)
 	}
 
+	// Set up the contract sidecar client and key index before consuming
+	keyIndex, err := keyring.NewIndex(config.AppConfig.Keyring.IndexPath)
+	if err != nil {
+		logger.Fatal("Failed to open keyring index: %v", err)
+	}
+
+	contractClient := contract.NewClient(
+		config.AppConfig.Contract.SidecarURL,
+		time.Duration(config.AppConfig.Contract.Timeout)*time.Second,
+	)
+
+	handlers.InitializeKeyring(contractClient, keyIndex)
+
+	probeTimeout := time.Duration(config.AppConfig.Providers.ProbeTimeout) * time.Second
+	providerRegistry := providers.NewRegistry(
+		providers.NewOpenAI(config.AppConfig.Providers.OpenAIBaseURL, config.AppConfig.Providers.OpenAIProbeModel, probeTimeout),
+		providers.NewAnthropic(config.AppConfig.Providers.AnthropicBaseURL, config.AppConfig.Providers.AnthropicProbeModel, probeTimeout),
+	)
+	handlers.InitializeProviders(providerRegistry)
+
+	keyEvents, err := rabbitmq.NewBroadcastProducer(channel, config.AppConfig.KeyEvents.ExchangeName)
+	if err != nil {
+		logger.Fatal("Failed to create key events producer: %v", err)
+	}
+
+	handlers.InitializeKeyEvents(keyEvents)
+
 	// Start consuming messages
 	messages, err := consumer.ConsumeMessages()
 	if err != nil {
@@ -80,13 +152,51 @@ func main() {
 
 	logger.Info("Consumer started and listening for messages...")
 
+	// Register dependency checks. A stopped consumer never restarts, so it
+	// is the one failure that fails liveness.
+	health.Register(health.Check{Name: "broker", Run: rmq.Check})
+	health.Register(health.Check{Name: "request_consumer", Live: true, Run: handlers.CheckConsumer})
+	health.Register(health.Check{Name: "contract_sidecar", Run: contractClient.Ping})
+	if config.AppConfig.Chain.RPCURL != "" {
+		rpc := chain.NewClient(config.AppConfig.Chain.RPCURL, time.Duration(config.AppConfig.Health.CheckTimeout)*time.Second)
+		health.Register(health.Check{
+			Name: "chain_rpc",
+			Run:  rpc.Check(time.Duration(config.AppConfig.Chain.MaxBlockAge) * time.Second),
+		})
+	}
+	if config.AppConfig.Health.ProbeProviders {
+		for _, name := range providerRegistry.Names() {
+			health.Register(health.Check{
+				Name:     "provider_" + name,
+				Optional: true,
+				Run:      func(ctx context.Context) error { return providerRegistry.Ping(ctx, name) },
+			})
+		}
+	}
+
+	// Serve metrics and probes on their own port; the worker has no other HTTP
+	if config.AppConfig.Metrics.Port != "" {
+		checkTimeout := time.Duration(config.AppConfig.Health.CheckTimeout) * time.Second
+		mux := http.NewServeMux()
+		mux.Handle("/livez", health.Handler(true, checkTimeout))
+		mux.Handle("/readyz", health.Handler(false, checkTimeout))
+
+		metricsServer := metrics.Serve(fmt.Sprintf(":%s", config.AppConfig.Metrics.Port), mux)
+		lc.OnShutdown("metrics listener", metricsServer.Shutdown)
+	}
+
+	// Registered after the listener so probes keep answering while the
+	// consumer finishes the message in hand
+	lc.OnShutdown("request consumer", func(ctx context.Context) error {
+		if err := consumer.Cancel(); err != nil {
+			return err
+		}
+		return handlers.WaitForConsumer(ctx)
+	})
+	health.Register(health.Check{Name: "shutdown", Run: lc.Check})
+
 	// Initialize handlers
 	handlers.InitializeHandlers(producerReceive, producerSend, consumer)
 
-	// Graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	logger.Info("Shutting down server...")
+	lc.Wait()
 }
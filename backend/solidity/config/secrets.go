@@ -0,0 +1,362 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"solidity/pkg/logger"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretTimeout bounds a single reference lookup
+const secretTimeout = 10 * time.Second
+
+// SecretBackend resolves secret references for one URL scheme. A config
+// value of the form "<scheme>://<ref>" is replaced by Resolve(ref).
+type SecretBackend interface {
+	Scheme() string
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]SecretBackend{}
+
+	// secretRefs maps a field path such as "rabbitmq_consumer.url" to the
+	// reference it was resolved from, and secretValues to the value in use
+	secretRefsMu sync.Mutex
+	secretRefs   map[string]string
+	secretValues map[string]string
+)
+
+func init() {
+	RegisterSecretBackend(fileBackend{})
+	RegisterSecretBackend(envBackend{})
+}
+
+// RegisterSecretBackend makes a backend available to config values, replacing
+// any backend already registered for its scheme
+func RegisterSecretBackend(backend SecretBackend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[backend.Scheme()] = backend
+}
+
+// splitRef returns the backend and reference for a value, or false when the
+// value does not use a registered scheme
+func splitRef(value string) (SecretBackend, string, bool) {
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok {
+		return nil, "", false
+	}
+
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	backend, ok := backends[scheme]
+	return backend, ref, ok
+}
+
+// resolveValue resolves value if it is a secret reference and returns it unchanged otherwise
+func resolveValue(value string) (string, bool, error) {
+	backend, ref, ok := splitRef(value)
+	if !ok {
+		return value, false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+
+	secret, err := backend.Resolve(ctx, ref)
+	if err != nil {
+		return "", true, err
+	}
+	logger.RegisterSecret(secret)
+	return secret, true, nil
+}
+
+// resolveSecrets replaces every string field of cfg holding a secret
+// reference with the secret, and returns the references by field path
+func resolveSecrets(cfg *Config) (map[string]string, error) {
+	refs := make(map[string]string)
+	v := &validator{}
+
+	// The Vault token may itself be a file or env reference
+	token, _, err := resolveValue(cfg.Secrets.VaultToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: secrets.vault_token (VAULT_TOKEN): %v", err)
+	}
+	if cfg.Secrets.VaultAddr != "" {
+		RegisterSecretBackend(NewVaultBackend(
+			cfg.Secrets.VaultAddr,
+			token,
+			cfg.Secrets.VaultNamespace,
+			cfg.Secrets.VaultKVVersion,
+			&http.Client{Timeout: secretTimeout},
+		))
+	} else {
+		// Without this, vault:// values would pass through as plain strings
+		RegisterSecretBackend(unconfiguredBackend{scheme: "vault", setting: "secrets.vault_addr (VAULT_ADDR)"})
+	}
+
+	walkStrings(reflect.ValueOf(cfg).Elem(), "", func(path string, field reflect.Value) {
+		resolved, isRef, err := resolveValue(field.String())
+		if !isRef {
+			return
+		}
+		if err != nil {
+			v.addf("%s: %v", path, err)
+			return
+		}
+		refs[path] = field.String()
+		field.SetString(resolved)
+	})
+
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// walkStrings calls fn for every settable string field under v, named by json tags
+func walkStrings(v reflect.Value, prefix string, fn func(path string, field reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "-" || !t.Field(i).IsExported() {
+			continue
+		}
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			fn(name, field)
+		case reflect.Struct:
+			walkStrings(field, name, fn)
+		}
+	}
+}
+
+// rememberSecrets records the references and resolved values of an accepted config
+func rememberSecrets(cfg *Config, refs map[string]string) {
+	values := make(map[string]string, len(refs))
+	walkStrings(reflect.ValueOf(cfg).Elem(), "", func(path string, field reflect.Value) {
+		if _, ok := refs[path]; ok {
+			values[path] = field.String()
+		}
+	})
+
+	secretRefsMu.Lock()
+	defer secretRefsMu.Unlock()
+	secretRefs = refs
+	secretValues = values
+}
+
+// WatchSecrets re-resolves every secret reference each interval and reloads
+// the config when one has rotated, so reload hooks see the new values.
+// The returned function stops the watcher.
+func WatchSecrets(interval time.Duration) func() {
+	secretRefsMu.Lock()
+	count := len(secretRefs)
+	secretRefsMu.Unlock()
+
+	if count == 0 || interval <= 0 {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			if rotated := rotatedSecrets(); len(rotated) > 0 {
+				logger.Info("Secrets rotated for %s", strings.Join(rotated, ", "))
+				reload()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(stop) }) }
+}
+
+// rotatedSecrets returns the field paths whose secret differs from the value
+// in use, and takes the new values as current so each rotation is seen once
+func rotatedSecrets() []string {
+	secretRefsMu.Lock()
+	refs := make(map[string]string, len(secretRefs))
+	for path, ref := range secretRefs {
+		refs[path] = ref
+	}
+	secretRefsMu.Unlock()
+
+	var rotated []string
+	for path, ref := range refs {
+		secret, _, err := resolveValue(ref)
+		if err != nil {
+			logger.Warn("Failed to refresh secret for %s: %v", path, err)
+			continue
+		}
+
+		secretRefsMu.Lock()
+		if secret != secretValues[path] {
+			secretValues[path] = secret
+			rotated = append(rotated, path)
+		}
+		secretRefsMu.Unlock()
+	}
+	return rotated
+}
+
+// fileBackend reads secrets from files, such as Docker or Kubernetes mounted
+// secrets: file:///run/secrets/amqp_url
+type fileBackend struct{}
+
+func (fileBackend) Scheme() string { return "file" }
+
+func (fileBackend) Resolve(_ context.Context, ref string) (string, error) {
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %v", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// envBackend reads secrets from another environment variable: env://AMQP_PASSWORD
+type envBackend struct{}
+
+func (envBackend) Scheme() string { return "env" }
+
+func (envBackend) Resolve(_ context.Context, ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return value, nil
+}
+
+// unconfiguredBackend claims a scheme whose backend has no settings, so its
+// references fail loudly instead of being used verbatim
+type unconfiguredBackend struct {
+	scheme  string
+	setting string
+}
+
+func (b unconfiguredBackend) Scheme() string { return b.scheme }
+
+func (b unconfiguredBackend) Resolve(context.Context, string) (string, error) {
+	return "", fmt.Errorf("%s:// references need %s to be set", b.scheme, b.setting)
+}
+
+// VaultBackend reads secrets from a Vault-compatible KV engine. References
+// name the mount, the secret path and the key: vault://secret/b.env/amqp#url
+type VaultBackend struct {
+	addr       string
+	token      string
+	namespace  string
+	kvVersion  int
+	httpClient *http.Client
+}
+
+// NewVaultBackend returns a backend for the server at addr. kvVersion is 1
+// or 2; anything else is treated as 2.
+func NewVaultBackend(addr, token, namespace string, kvVersion int, httpClient *http.Client) *VaultBackend {
+	if kvVersion != 1 {
+		kvVersion = 2
+	}
+	return &VaultBackend{
+		addr:       strings.TrimRight(addr, "/"),
+		token:      token,
+		namespace:  namespace,
+		kvVersion:  kvVersion,
+		httpClient: httpClient,
+	}
+}
+
+// Scheme implements SecretBackend
+func (b *VaultBackend) Scheme() string { return "vault" }
+
+// Resolve implements SecretBackend
+func (b *VaultBackend) Resolve(ctx context.Context, ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || key == "" {
+		return "", fmt.Errorf("vault reference %q must end in #<key>", ref)
+	}
+	mount, secretPath, ok := strings.Cut(path, "/")
+	if !ok || secretPath == "" {
+		return "", fmt.Errorf("vault reference %q must be <mount>/<path>#<key>", ref)
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/%s", b.addr, mount, secretPath)
+	if b.kvVersion == 2 {
+		url = fmt.Sprintf("%s/v1/%s/data/%s", b.addr, mount, secretPath)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create vault request: %v", err)
+	}
+	req.Header.Set("X-Vault-Token", b.token)
+	if b.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", b.namespace)
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach vault: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d for %s", resp.StatusCode, path)
+	}
+
+	// KV v1 returns the secret under data; v2 nests it under data.data
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %v", err)
+	}
+	data := body.Data
+	if b.kvVersion == 2 {
+		var nested struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &nested); err != nil {
+			return "", fmt.Errorf("failed to decode vault response: %v", err)
+		}
+		data = nested.Data
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return "", fmt.Errorf("failed to decode vault secret: %v", err)
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key %q", path, key)
+	}
+	secret, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s key %q is not a string", path, key)
+	}
+	return secret, nil
+}
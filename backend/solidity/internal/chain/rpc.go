@@ -0,0 +1,114 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client reads chain state over Ethereum JSON-RPC
+type Client struct {
+	url        string
+	httpClient *http.Client
+}
+
+// Block is the part of a block header the service cares about
+type Block struct {
+	Number    uint64
+	Timestamp time.Time
+}
+
+// NewClient creates a JSON-RPC client for url
+func NewClient(url string, timeout time.Duration) *Client {
+	return &Client{
+		url:        url,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// LatestBlock returns the number and timestamp of the latest block
+func (c *Client) LatestBlock(ctx context.Context) (*Block, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "eth_getBlockByNumber",
+		"params":  []interface{}{"latest", false},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rpc request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rpc request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach chain rpc: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("chain rpc returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result *struct {
+			Number    string `json:"number"`
+			Timestamp string `json:"timestamp"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse rpc response: %v", err)
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("chain rpc error: %s", result.Error.Message)
+	}
+	if result.Result == nil {
+		return nil, fmt.Errorf("chain rpc returned no block")
+	}
+
+	number, err := parseQuantity(result.Result.Number)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block number: %v", err)
+	}
+	timestamp, err := parseQuantity(result.Result.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block timestamp: %v", err)
+	}
+
+	return &Block{Number: number, Timestamp: time.Unix(int64(timestamp), 0)}, nil
+}
+
+// Check returns a readiness check that fails when the RPC cannot be reached
+// or, with maxAge above zero, when the latest block is older than maxAge
+func (c *Client) Check(maxAge time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		block, err := c.LatestBlock(ctx)
+		if err != nil {
+			return err
+		}
+		if age := time.Since(block.Timestamp); maxAge > 0 && age > maxAge {
+			return fmt.Errorf("latest block %d is %s old", block.Number, age.Round(time.Second))
+		}
+		return nil
+	}
+}
+
+// parseQuantity decodes a hex-encoded JSON-RPC quantity such as "0x1b4"
+func parseQuantity(s string) (uint64, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return 0, fmt.Errorf("%q is not a hex quantity", s)
+	}
+	return strconv.ParseUint(s[2:], 16, 64)
+}
@@ -0,0 +1,147 @@
+package contract
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"solidity/internal/metrics"
+	"strings"
+	"time"
+)
+
+// Client talks to the contract sidecar (web3/scripts/sidecar.js), which
+// encrypts keys and signs and submits SecretStorage transactions. Each named
+// key lives in its own slot on-chain, addressed by the owner address and key
+// name. Which names an address holds, its defaults and revocations are kept
+// off-chain in the keyring index.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// KeyPayload is the body sent to the sidecar key endpoints
+type KeyPayload struct {
+	Address  string `json:"address"`
+	Name     string `json:"name"`
+	Provider string `json:"provider,omitempty"`
+	Key      string `json:"key,omitempty"`
+}
+
+// Response is the sidecar reply envelope
+type Response struct {
+	Success bool   `json:"success"`
+	Key     string `json:"key,omitempty"`
+	TxHash  string `json:"txHash,omitempty"`
+	// GasUsed is reported by sidecars that return the transaction receipt
+	GasUsed uint64 `json:"gasUsed,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NewClient creates a sidecar client for the given base URL
+func NewClient(baseURL string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// StoreKey writes a named key for address
+func (c *Client) StoreKey(address, name, provider, key string) (*Response, error) {
+	return c.post("/keys/store", KeyPayload{
+		Address:  address,
+		Name:     name,
+		Provider: provider,
+		Key:      key,
+	})
+}
+
+// GetKey reads the named key for address
+func (c *Client) GetKey(address, name string) (*Response, error) {
+	return c.post("/keys/get", KeyPayload{
+		Address: address,
+		Name:    name,
+	})
+}
+
+// RotateKey replaces the named key for address with a new value
+func (c *Client) RotateKey(address, name, provider, key string) (*Response, error) {
+	return c.post("/keys/rotate", KeyPayload{
+		Address:  address,
+		Name:     name,
+		Provider: provider,
+		Key:      key,
+	})
+}
+
+// DeleteKey clears the named key for address
+func (c *Client) DeleteKey(address, name string) (*Response, error) {
+	return c.post("/keys/delete", KeyPayload{
+		Address: address,
+		Name:    name,
+	})
+}
+
+// Ping checks that the sidecar answers HTTP. The sidecar has no health
+// route, so any response below 500 counts.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create contract request: %v", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach contract sidecar: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("contract sidecar returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *Client) post(path string, payload any) (*Response, error) {
+	start := time.Now()
+	outcome := metrics.OutcomeError
+	defer func() {
+		metrics.ContractDuration.WithLabelValues(path, outcome).Observe(metrics.Since(start))
+	}()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal contract request: %v", err)
+	}
+
+	resp, err := c.httpClient.Post(c.baseURL+path, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach contract sidecar: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contract response: %v", err)
+	}
+
+	var result Response
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse contract response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || !result.Success {
+		if result.Error == "" {
+			result.Error = fmt.Sprintf("contract sidecar returned status %d", resp.StatusCode)
+		}
+		return &result, fmt.Errorf("contract call %s failed: %s", path, result.Error)
+	}
+
+	outcome = metrics.OutcomeSuccess
+	if result.GasUsed > 0 {
+		metrics.ContractGas.WithLabelValues(path).Observe(float64(result.GasUsed))
+	}
+	return &result, nil
+}
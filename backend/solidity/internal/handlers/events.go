@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"solidity/internal/rabbitmq"
+	"solidity/pkg/logger"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Key event types broadcast to the interceptors
+const (
+	EventKeyRotated = "key_rotated"
+	EventKeyRevoked = "key_revoked"
+	// EventKeyDefaultChanged names the key that became its provider's default
+	EventKeyDefaultChanged = "key_default_changed"
+)
+
+// KeyEvent tells consumers that a stored key changed and any copy of the old
+// value must be dropped. Fingerprint identifies the old value without revealing it.
+type KeyEvent struct {
+	Type        string    `json:"type"`
+	Address     string    `json:"address"`
+	Name        string    `json:"name"`
+	Provider    string    `json:"provider,omitempty"`
+	Version     int       `json:"version"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+var globalKeyEvents *rabbitmq.Producer
+
+// InitializeKeyEvents sets the producer used to broadcast key events
+func InitializeKeyEvents(producer *rabbitmq.Producer) {
+	globalKeyEvents = producer
+}
+
+// publishKeyEvent broadcasts a key event. Failures are logged rather than
+// returned because the on-chain change has already happened.
+func publishKeyEvent(event KeyEvent) {
+	if globalKeyEvents == nil {
+		logger.Warn("Key events producer not initialized; dropping %s event for %s", event.Type, event.Address)
+		return
+	}
+
+	event.At = time.Now().UTC()
+	body, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("Failed to marshal key event: %v", err)
+		return
+	}
+
+	if err := globalKeyEvents.PublishMessage(amqp.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+	}); err != nil {
+		logger.Error("Failed to publish %s event for %s/%s: %v", event.Type, event.Address, event.Name, err)
+		return
+	}
+
+	logger.Info("Published %s event for %s/%s", event.Type, event.Address, event.Name)
+}
@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
-	"io"
-	"net/http"
+	"fmt"
+	"solidity/internal/metrics"
 	"solidity/internal/rabbitmq"
 	"solidity/pkg/logger"
 	"time"
@@ -130,13 +130,41 @@ func PublishMessageSend(messages string) error {
 	return nil
 }
 
+// consumerDone is closed when the request consumer's delivery channel closes
+// and its last message has been handled
+var consumerDone = make(chan struct{})
+
+// CheckConsumer reports whether the request consumer is still running
+func CheckConsumer(ctx context.Context) error {
+	select {
+	case <-consumerDone:
+		return fmt.Errorf("request consumer stopped")
+	default:
+		return nil
+	}
+}
+
+// WaitForConsumer blocks until the request consumer has handled its last
+// delivery, which happens once it is cancelled, or until ctx is done
+func WaitForConsumer(ctx context.Context) error {
+	select {
+	case <-consumerDone:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("request consumer still running: %v", ctx.Err())
+	}
+}
+
 func ConsumeMessages(messages <-chan amqp.Delivery) error {
 	// Create a channel to keep the consumer running
 	forever := make(chan bool)
 
 	go func() {
+		defer close(consumerDone)
+
 		for msg := range messages {
-			logger.Info("  Body: %s", string(msg.Body))
+			// Bodies carry keys base64-encoded, out of reach of redaction
+			logger.Info("  Body: %d bytes", len(msg.Body))
 
 			var rawMsg RawMessage
 			if err := json.Unmarshal(msg.Body, &rawMsg); err != nil {
@@ -152,50 +180,43 @@ func ConsumeMessages(messages <-chan amqp.Delivery) error {
 				continue
 			}
 
-			logger.Info("Decoded message: %s", string(decodedBody))
-
-			if msg.RoutingKey == "frontend.route" {
-				// Process decoded message
-				resp, err := http.Post("http://localhost:3003", "application/json", bytes.NewBuffer(decodedBody))
-				if err != nil {
-					logger.Error("Failed to send GET request: %v", err)
-					msg.Nack(false, true)
-					continue
-				}
-				defer resp.Body.Close()
-
-				body, err := io.ReadAll(resp.Body)
-				if err != nil {
-					logger.Error("Failed to read response body: %v", err)
-					msg.Nack(false, true)
-					continue
-				}
-
-				logger.Info("Response body: %s", string(body))
+			logger.Debug("Decoded message: %d bytes", len(decodedBody))
+
+			// Malformed requests are acked so they do not loop through the queue
+			req, err := parseRequest(msg.RoutingKey, decodedBody)
+			if err != nil {
+				logger.Error("Invalid keyring request: %v", err)
 				msg.Ack(false)
+				continue
+			}
+			if req.Key != "" {
+				logger.RegisterSecret(req.Key)
+			}
+
+			log := logger.With("request_id", req.ID, "correlation_id", req.CorrelationID, "action", req.Action, "address", req.Address, "routing_key", msg.RoutingKey)
 
-				// PublishMessageSend(string(body))
+			start := time.Now()
+			reply := dispatch(req)
+			metrics.ActionDuration.WithLabelValues(actionLabel(req.Action), reply.Status).Observe(metrics.Since(start))
+			if reply.Status != "success" {
+				log.Errorw("action failed", "error", reply.Error, "duration_ms", time.Since(start).Milliseconds())
 			} else {
-				resp, err := http.Post("http://localhost:3003", "application/json", bytes.NewBuffer(decodedBody))
-				if err != nil {
-					logger.Error("Failed to send POST request: %v", err)
-					msg.Nack(false, true)
-					continue
-				}
-				defer resp.Body.Close()
-
-				body, err := io.ReadAll(resp.Body)
-				if err != nil {
-					logger.Error("Failed to read response body: %v", err)
-					msg.Nack(false, true)
-					continue
-				}
-
-				logger.Info("Response body: %s", string(body))
-				msg.Ack(false)
+				log.Infow("action completed", "duration_ms", time.Since(start).Milliseconds())
+			}
+			msg.Ack(false)
+			if reply.Key != "" {
+				logger.RegisterSecret(reply.Key)
+			}
 
-				PublishMessageReceive(string(body))
+			replyBody, err := json.Marshal(reply)
+			if err != nil {
+				logger.Error("Failed to marshal reply: %v", err)
+				continue
 			}
+
+			// Frontend requests are answered too, so the form sees the
+			// result of the key probe
+			PublishMessageReceive(string(replyBody))
 		}
 	}()
 
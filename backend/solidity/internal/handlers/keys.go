@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"solidity/internal/contract"
+	"solidity/internal/keyring"
+	"solidity/internal/providers"
+	"solidity/internal/wallet"
+	"solidity/pkg/logger"
+	"time"
+)
+
+var (
+	globalContract  *contract.Client
+	globalIndex     *keyring.Index
+	globalProviders *providers.Registry
+	globalNonces    = wallet.NewNonces()
+)
+
+// InitializeKeyring sets the contract client and key index used by the keyring actions
+func InitializeKeyring(client *contract.Client, index *keyring.Index) {
+	globalContract = client
+	globalIndex = index
+}
+
+// InitializeProviders sets the provider registry used to probe keys before they are stored
+func InitializeProviders(registry *providers.Registry) {
+	globalProviders = registry
+}
+
+func init() {
+	RegisterAction(ActionStoreKey, handleStoreKey)
+	RegisterAction(ActionGetKey, handleGetKey)
+	RegisterAction(ActionListKeys, handleListKeys)
+	RegisterAction(ActionDeleteKey, handleDeleteKey)
+	RegisterAction(ActionRotateKey, handleRotateKey)
+	RegisterAction(ActionRevokeKey, handleRevokeKey)
+}
+
+// Signed messages carry the RFC 3339 time they were signed and a nonce, so a
+// signature is accepted once and only within wallet.SignWindow of signing.
+
+// StoreKeyMessage returns the text the owner signs to store a named key. The
+// key is bound by its fingerprint, and whether it becomes the provider
+// default is part of what is signed.
+func StoreKeyMessage(address, name, fingerprint string, makeDefault bool, issued, nonce string) string {
+	return fmt.Sprintf("b.env store key\naddress: %s\nname: %s\nkey: %s\ndefault: %t\nissued: %s\nnonce: %s", address, name, fingerprint, makeDefault, issued, nonce)
+}
+
+// ListKeysMessage returns the text the owner signs to list their key names
+func ListKeysMessage(address, issued, nonce string) string {
+	return fmt.Sprintf("b.env list keys\naddress: %s\nissued: %s\nnonce: %s", address, issued, nonce)
+}
+
+// DeleteKeyMessage returns the text the owner signs to delete a named key
+func DeleteKeyMessage(address, name, issued, nonce string) string {
+	return fmt.Sprintf("b.env delete key\naddress: %s\nname: %s\nissued: %s\nnonce: %s", address, name, issued, nonce)
+}
+
+// RotateKeyMessage returns the text the owner signs to replace a named key.
+// The new key is bound by its fingerprint so the signature cannot be reused
+// to install a different value.
+func RotateKeyMessage(address, name, fingerprint, issued, nonce string) string {
+	return fmt.Sprintf("b.env rotate key\naddress: %s\nname: %s\nkey: %s\nissued: %s\nnonce: %s", address, name, fingerprint, issued, nonce)
+}
+
+// RevokeKeyMessage returns the text the owner signs to tombstone a named key
+func RevokeKeyMessage(address, name, issued, nonce string) string {
+	return fmt.Sprintf("b.env revoke key\naddress: %s\nname: %s\nissued: %s\nnonce: %s", address, name, issued, nonce)
+}
+
+// verifySigned checks that the owner signed message recently and has not
+// sent it before. The nonce is only spent once the signature checks out.
+func verifySigned(req KeyRequest, message string) error {
+	if req.Issued == "" || req.Nonce == "" || req.Signature == "" {
+		return fmt.Errorf("issued, nonce and signature are required")
+	}
+	now := time.Now()
+	if err := wallet.CheckIssued(req.Issued, now); err != nil {
+		return err
+	}
+	if err := wallet.VerifySigner(message, req.Signature, req.Address); err != nil {
+		return err
+	}
+	return globalNonces.Use(req.Address, req.Nonce, now)
+}
+
+// indexedKey returns the index entry for a named key, live or revoked
+func indexedKey(address, name string) (keyring.Entry, bool) {
+	for _, e := range globalIndex.List(address) {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return keyring.Entry{}, false
+}
+
+// handleStoreKey writes a named key on-chain and records it in the index once
+// the owner's signature checks out
+func handleStoreKey(req KeyRequest) (*KeyReply, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if req.Key == "" {
+		return nil, fmt.Errorf("key is required")
+	}
+
+	message := StoreKeyMessage(req.Address, req.Name, keyring.Fingerprint(req.Key), req.Default, req.Issued, req.Nonce)
+	if err := verifySigned(req, message); err != nil {
+		return nil, err
+	}
+
+	provider := req.Provider
+	if provider == "" {
+		provider = keyring.DetectProvider(req.Key)
+	}
+
+	// Reject duplicates before spending gas on the contract call
+	var previousDefault string
+	for _, e := range globalIndex.List(req.Address) {
+		if e.Name == req.Name && !e.Revoked() {
+			return nil, fmt.Errorf("key %q already stored for %s", req.Name, req.Address)
+		}
+		if e.Provider == provider && e.Default {
+			previousDefault = e.Name
+		}
+	}
+
+	// Catch typos and dead keys before they are committed on-chain
+	probe := probeKey(provider, req.Key)
+	if !probe.Usable() {
+		return &KeyReply{Name: req.Name, Provider: provider, Validation: &probe}, fmt.Errorf("key failed validation: %s", probe.Status)
+	}
+
+	resp, err := globalContract.StoreKey(req.Address, req.Name, provider, req.Key)
+	if err != nil {
+		return &KeyReply{Validation: &probe}, err
+	}
+
+	if err := globalIndex.Add(req.Address, keyring.Entry{Name: req.Name, Provider: provider}, req.Default); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Stored key %q (%s) for %s in tx %s", req.Name, provider, req.Address, resp.TxHash)
+
+	// Interceptors may have cached the old default as the provider's key
+	if req.Default && previousDefault != "" {
+		publishKeyEvent(KeyEvent{
+			Type:     EventKeyDefaultChanged,
+			Address:  req.Address,
+			Name:     req.Name,
+			Provider: provider,
+			Version:  1,
+		})
+	}
+
+	return &KeyReply{Name: req.Name, Provider: provider, Validation: &probe}, nil
+}
+
+// handleGetKey resolves a key by name or provider default and reads it from the contract
+func handleGetKey(req KeyRequest) (*KeyReply, error) {
+	entry, err := globalIndex.Resolve(req.Address, req.Name, req.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := globalContract.GetKey(req.Address, entry.Name)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Key == "" {
+		return nil, keyring.ErrNotFound
+	}
+
+	return &KeyReply{Name: entry.Name, Provider: entry.Provider, Key: resp.Key}, nil
+}
+
+// handleListKeys returns the key metadata stored for an address once the
+// owner's signature checks out
+func handleListKeys(req KeyRequest) (*KeyReply, error) {
+	if err := verifySigned(req, ListKeysMessage(req.Address, req.Issued, req.Nonce)); err != nil {
+		return nil, err
+	}
+
+	return &KeyReply{Keys: globalIndex.List(req.Address)}, nil
+}
+
+// handleDeleteKey clears a named key once the owner's signature checks out.
+// A revoked key is already gone on-chain, so only its tombstone is removed.
+func handleDeleteKey(req KeyRequest) (*KeyReply, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	if err := verifySigned(req, DeleteKeyMessage(req.Address, req.Name, req.Issued, req.Nonce)); err != nil {
+		return nil, err
+	}
+
+	entry, ok := indexedKey(req.Address, req.Name)
+	if !ok {
+		return nil, keyring.ErrNotFound
+	}
+
+	var fingerprint string
+	if !entry.Revoked() {
+		fingerprint = currentFingerprint(req.Address, req.Name)
+		if _, err := globalContract.DeleteKey(req.Address, req.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := globalIndex.Remove(req.Address, req.Name); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Deleted key %q for %s", req.Name, req.Address)
+
+	publishKeyEvent(KeyEvent{
+		Type:        EventKeyRevoked,
+		Address:     req.Address,
+		Name:        req.Name,
+		Fingerprint: fingerprint,
+	})
+
+	return &KeyReply{Name: req.Name}, nil
+}
+
+// handleRotateKey replaces a named key on-chain and tells interceptors to drop the old value
+func handleRotateKey(req KeyRequest) (*KeyReply, error) {
+	if req.Name == "" || req.Key == "" {
+		return nil, fmt.Errorf("name and key are required")
+	}
+
+	message := RotateKeyMessage(req.Address, req.Name, keyring.Fingerprint(req.Key), req.Issued, req.Nonce)
+	if err := verifySigned(req, message); err != nil {
+		return nil, err
+	}
+
+	entry, err := globalIndex.Resolve(req.Address, req.Name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	probe := probeKey(entry.Provider, req.Key)
+	if !probe.Usable() {
+		return &KeyReply{Name: req.Name, Provider: entry.Provider, Validation: &probe}, fmt.Errorf("key failed validation: %s", probe.Status)
+	}
+
+	fingerprint := currentFingerprint(req.Address, req.Name)
+
+	resp, err := globalContract.RotateKey(req.Address, req.Name, entry.Provider, req.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err = globalIndex.MarkRotated(req.Address, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Rotated key %q for %s to version %d in tx %s", req.Name, req.Address, entry.Version, resp.TxHash)
+
+	publishKeyEvent(KeyEvent{
+		Type:        EventKeyRotated,
+		Address:     req.Address,
+		Name:        req.Name,
+		Provider:    entry.Provider,
+		Version:     entry.Version,
+		Fingerprint: fingerprint,
+	})
+
+	return &KeyReply{Name: req.Name, Provider: entry.Provider, Validation: &probe}, nil
+}
+
+// handleRevokeKey clears a named key on-chain and leaves a tombstone in the index
+func handleRevokeKey(req KeyRequest) (*KeyReply, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	if err := verifySigned(req, RevokeKeyMessage(req.Address, req.Name, req.Issued, req.Nonce)); err != nil {
+		return nil, err
+	}
+
+	// Only a live key can be revoked; check before touching the chain
+	if _, err := globalIndex.Resolve(req.Address, req.Name, ""); err != nil {
+		return nil, err
+	}
+
+	fingerprint := currentFingerprint(req.Address, req.Name)
+
+	if _, err := globalContract.DeleteKey(req.Address, req.Name); err != nil {
+		return nil, err
+	}
+
+	entry, err := globalIndex.MarkRevoked(req.Address, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Revoked key %q for %s", req.Name, req.Address)
+
+	publishKeyEvent(KeyEvent{
+		Type:        EventKeyRevoked,
+		Address:     req.Address,
+		Name:        req.Name,
+		Provider:    entry.Provider,
+		Version:     entry.Version,
+		Fingerprint: fingerprint,
+	})
+
+	return &KeyReply{Name: req.Name, Provider: entry.Provider}, nil
+}
+
+// currentFingerprint reads the stored key so events can name the value being
+// retired. A failed read only loses the fingerprint, not the event.
+func currentFingerprint(address, name string) string {
+	resp, err := globalContract.GetKey(address, name)
+	if err != nil || resp.Key == "" {
+		logger.Warn("Could not read current key %q for %s: %v", name, address, err)
+		return ""
+	}
+	return keyring.Fingerprint(resp.Key)
+}
+
+// probeKey checks a plaintext key with its provider before it is encrypted and stored
+func probeKey(provider, key string) providers.ProbeResult {
+	if globalProviders == nil {
+		return providers.ProbeResult{Provider: provider, Status: providers.StatusUnchecked}
+	}
+
+	result := globalProviders.Probe(context.Background(), provider, key)
+	logger.Info("Probed %s key: %s %s", provider, result.Status, result.Detail)
+	return result
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"solidity/internal/keyring"
+	"solidity/internal/providers"
+	"strings"
+)
+
+// KeyRequest is the broker payload for every keyring action
+type KeyRequest struct {
+	ID       string `json:"id"`
+	Action   string `json:"action"`
+	Address  string `json:"address"`
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+	Key      string `json:"key"`
+	Default  bool   `json:"default"`
+	// Issued is the RFC 3339 time an owner-signed request was signed
+	Issued    string `json:"issued"`
+	Nonce     string `json:"nonce"`
+	Signature string `json:"signature"`
+	// CorrelationID is the originating HTTP request's, for tracing across services
+	CorrelationID string `json:"correlation_id"`
+}
+
+// KeyReply is published back to the requester once an action completes
+type KeyReply struct {
+	ID       string          `json:"id"`
+	Status   string          `json:"status"`
+	Error    string          `json:"error,omitempty"`
+	Name     string          `json:"name,omitempty"`
+	Provider string          `json:"provider,omitempty"`
+	Key      string          `json:"key,omitempty"`
+	Keys     []keyring.Entry `json:"keys,omitempty"`
+
+	Validation *providers.ProbeResult `json:"validation,omitempty"`
+}
+
+// ActionHandler executes a single keyring action
+type ActionHandler func(req KeyRequest) (*KeyReply, error)
+
+// Keyring actions
+const (
+	ActionStoreKey  = "store_key"
+	ActionGetKey    = "get_key"
+	ActionListKeys  = "list_keys"
+	ActionDeleteKey = "delete_key"
+	ActionRotateKey = "rotate_key"
+	ActionRevokeKey = "revoke_key"
+)
+
+const frontendRoutingKey = "frontend.route"
+
+var actionHandlers = make(map[string]ActionHandler)
+
+// RegisterAction adds a handler for the given action name
+func RegisterAction(action string, handler ActionHandler) {
+	actionHandlers[action] = handler
+}
+
+// parseRequest decodes a broker payload into a KeyRequest. The frontend form
+// sends {address, name, key} without an action, and older interceptors send
+// a bare address, so both are mapped onto the matching action.
+func parseRequest(routingKey string, body []byte) (KeyRequest, error) {
+	var req KeyRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		address := strings.TrimSpace(string(body))
+		if address == "" {
+			return req, fmt.Errorf("empty request")
+		}
+		return KeyRequest{Action: ActionGetKey, Address: address}, nil
+	}
+
+	if req.Action == "" {
+		if routingKey == frontendRoutingKey {
+			req.Action = ActionStoreKey
+		} else {
+			req.Action = ActionGetKey
+		}
+	}
+
+	req.Address = strings.ToLower(strings.TrimSpace(req.Address))
+	req.Name = strings.TrimSpace(req.Name)
+	req.Provider = strings.ToLower(strings.TrimSpace(req.Provider))
+
+	if req.Address == "" {
+		return req, fmt.Errorf("address is required")
+	}
+
+	return req, nil
+}
+
+// actionLabel returns action if it is registered, so unknown actions share one series
+func actionLabel(action string) string {
+	if _, ok := actionHandlers[action]; ok {
+		return action
+	}
+	return "unknown"
+}
+
+// dispatch runs the handler registered for the request's action
+func dispatch(req KeyRequest) *KeyReply {
+	handler, ok := actionHandlers[req.Action]
+	if !ok {
+		return &KeyReply{ID: req.ID, Status: "error", Error: fmt.Sprintf("unknown action: %s", req.Action)}
+	}
+
+	// Handlers may return a partial reply alongside an error, e.g. a failed probe
+	reply, err := handler(req)
+	if err != nil {
+		if reply == nil {
+			reply = &KeyReply{}
+		}
+		reply.ID = req.ID
+		reply.Status = "error"
+		reply.Error = err.Error()
+		return reply
+	}
+
+	reply.ID = req.ID
+	reply.Status = "success"
+	return reply
+}
@@ -0,0 +1,149 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Report and check statuses
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDegraded = "degraded"
+)
+
+// Check is one named dependency check
+type Check struct {
+	Name string
+	// Live checks gate /livez as well as /readyz. Reserve them for failures
+	// only a restart fixes; everything else should only gate readiness.
+	Live bool
+	// Optional checks are reported but never fail a probe
+	Optional bool
+	Run      func(ctx context.Context) error
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Optional   bool   `json:"optional,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Report is the outcome of a probe
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Healthy reports whether the probe passed; degraded counts as passing
+func (r Report) Healthy() bool {
+	return r.Status != StatusFail
+}
+
+var (
+	mu     sync.RWMutex
+	checks []Check
+)
+
+// Register adds a check, replacing any check already registered under its name
+func Register(check Check) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i, existing := range checks {
+		if existing.Name == check.Name {
+			checks[i] = check
+			return
+		}
+	}
+	checks = append(checks, check)
+}
+
+// Run executes the liveness checks, or every check when live is false, in
+// parallel with each bounded by timeout
+func Run(ctx context.Context, live bool, timeout time.Duration) Report {
+	mu.RLock()
+	selected := make([]Check, 0, len(checks))
+	for _, check := range checks {
+		if check.Live || !live {
+			selected = append(selected, check)
+		}
+	}
+	mu.RUnlock()
+
+	results := make([]Result, len(selected))
+	var wg sync.WaitGroup
+	for i, check := range selected {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, check, timeout)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status == StatusOK {
+			continue
+		}
+		if !result.Optional {
+			report.Status = StatusFail
+			break
+		}
+		report.Status = StatusDegraded
+	}
+	return report
+}
+
+func runCheck(ctx context.Context, check Check, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check.Run(ctx) }()
+
+	// A check that ignores its context still cannot hold up the probe
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := Result{
+		Name:       check.Name,
+		Status:     StatusOK,
+		Optional:   check.Optional,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Handler serves a probe as JSON with 200 when it passes and 503 when it fails
+func Handler(live bool, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := Run(r.Context(), live, timeout)
+
+		status := http.StatusOK
+		if !report.Healthy() {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	})
+}
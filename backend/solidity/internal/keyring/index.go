@@ -0,0 +1,295 @@
+package keyring
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is the metadata kept for one named key. The key itself only lives on-chain.
+type Entry struct {
+	Name      string     `json:"name"`
+	Provider  string     `json:"provider"`
+	Default   bool       `json:"default"`
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Revoked reports whether the key has been tombstoned
+func (e *Entry) Revoked() bool {
+	return e.RevokedAt != nil
+}
+
+// ErrNotFound is returned when no key matches a lookup
+var ErrNotFound = fmt.Errorf("key not found")
+
+// Index tracks the named keys stored for each address and which key is the
+// default for each provider. It is persisted to a JSON file on every change.
+type Index struct {
+	mu      sync.RWMutex
+	path    string
+	entries map[string][]*Entry
+}
+
+// NewIndex loads the index from path, creating the file on first write
+func NewIndex(path string) (*Index, error) {
+	idx := &Index{
+		path:    path,
+		entries: make(map[string][]*Entry),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return idx, nil
+		}
+		return nil, fmt.Errorf("failed to read keyring index: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &idx.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring index: %v", err)
+	}
+
+	return idx, nil
+}
+
+// Add records a new named key. The first key for a provider becomes its default,
+// and makeDefault moves the default to this key.
+func (idx *Index) Add(address string, entry Entry, makeDefault bool) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	// A revoked key's tombstone may be replaced by a fresh key of the same name
+	list := idx.entries[address]
+	for i, e := range list {
+		if e.Name == entry.Name {
+			if !e.Revoked() {
+				return fmt.Errorf("key %q already stored for %s", entry.Name, address)
+			}
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+
+	hasDefault := false
+	for _, e := range list {
+		if e.Provider == entry.Provider && e.Default {
+			hasDefault = true
+			if makeDefault {
+				e.Default = false
+			}
+		}
+	}
+
+	added := entry
+	added.Default = makeDefault || !hasDefault
+	added.Version = 1
+	if added.CreatedAt.IsZero() {
+		added.CreatedAt = time.Now().UTC()
+	}
+	idx.entries[address] = append(list, &added)
+
+	return idx.save()
+}
+
+// Remove deletes a named key and promotes the oldest remaining key of the
+// same provider to default if the removed key was the default
+func (idx *Index) Remove(address, name string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	list := idx.entries[address]
+	pos := -1
+	for i, e := range list {
+		if e.Name == name {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return ErrNotFound
+	}
+
+	removed := list[pos]
+	list = append(list[:pos], list[pos+1:]...)
+
+	if removed.Default {
+		promoteDefault(list, removed.Provider)
+	}
+
+	if len(list) == 0 {
+		delete(idx.entries, address)
+	} else {
+		idx.entries[address] = list
+	}
+
+	return idx.save()
+}
+
+// MarkRotated bumps the version of a named key after its value was replaced
+func (idx *Index) MarkRotated(address, name string) (Entry, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	e := idx.find(address, name)
+	if e == nil || e.Revoked() {
+		return Entry{}, ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	e.Version++
+	e.RotatedAt = &now
+
+	return *e, idx.save()
+}
+
+// MarkRevoked tombstones a named key so it can no longer be resolved. If it
+// was the provider default, the oldest live key of that provider takes over.
+func (idx *Index) MarkRevoked(address, name string) (Entry, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	e := idx.find(address, name)
+	if e == nil {
+		return Entry{}, ErrNotFound
+	}
+	if e.Revoked() {
+		return *e, nil
+	}
+
+	now := time.Now().UTC()
+	e.RevokedAt = &now
+	if e.Default {
+		e.Default = false
+		promoteDefault(idx.entries[address], e.Provider)
+	}
+
+	return *e, idx.save()
+}
+
+// List returns the keys stored for address, oldest first
+func (idx *Index) List(address string) []Entry {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	result := make([]Entry, 0, len(idx.entries[address]))
+	for _, e := range idx.entries[address] {
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// Resolve picks a key for address: by name when given, otherwise the default
+// for provider, otherwise the only key stored. An address with no indexed keys
+// resolves to the legacy unnamed slot.
+func (idx *Index) Resolve(address, name, provider string) (Entry, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if len(idx.entries[address]) == 0 {
+		if name != "" {
+			return Entry{}, ErrNotFound
+		}
+		return Entry{Provider: provider}, nil
+	}
+
+	live := make([]*Entry, 0, len(idx.entries[address]))
+	for _, e := range idx.entries[address] {
+		if !e.Revoked() {
+			live = append(live, e)
+		}
+	}
+
+	if name != "" {
+		for _, e := range live {
+			if e.Name == name {
+				return *e, nil
+			}
+		}
+		return Entry{}, ErrNotFound
+	}
+
+	for _, e := range live {
+		if e.Provider == provider && e.Default {
+			return *e, nil
+		}
+	}
+
+	if len(live) == 1 {
+		return *live[0], nil
+	}
+	if len(live) == 0 {
+		return Entry{}, ErrNotFound
+	}
+
+	return Entry{}, fmt.Errorf("no default %s key for %s; pass key_name", provider, address)
+}
+
+// find returns the entry for a named key; callers must hold the lock
+func (idx *Index) find(address, name string) *Entry {
+	for _, e := range idx.entries[address] {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// promoteDefault makes the oldest live key of provider the default
+func promoteDefault(list []*Entry, provider string) {
+	for _, e := range list {
+		if e.Provider == provider && !e.Revoked() {
+			e.Default = true
+			return
+		}
+	}
+}
+
+// save writes the index to disk; callers must hold the write lock
+func (idx *Index) save() error {
+	data, err := json.MarshalIndent(idx.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal keyring index: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0755); err != nil {
+		return fmt.Errorf("failed to create keyring directory: %v", err)
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated index
+	tmp := idx.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write keyring index: %v", err)
+	}
+	return os.Rename(tmp, idx.path)
+}
+
+// DetectProvider guesses the provider from the shape of a key
+func DetectProvider(key string) string {
+	switch {
+	case strings.HasPrefix(key, "sk-ant-"):
+		return "anthropic"
+	case strings.HasPrefix(key, "sk-"):
+		return "openai"
+	default:
+		return "unknown"
+	}
+}
+
+// Fingerprint identifies a key value without revealing it
+func Fingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
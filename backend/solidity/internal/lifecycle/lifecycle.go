@@ -0,0 +1,118 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"solidity/pkg/logger"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// lateGrace is the time each step gets once the deadline has passed, so
+// connections are still closed when draining overran
+const lateGrace = time.Second
+
+// hook is one named shutdown step
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Manager runs shutdown hooks in reverse registration order, like defer, so
+// whatever was set up last is stopped first: register resources as they are
+// acquired and the HTTP server stops before the consumers it depends on,
+// which stop before the channel they use. All hooks share one deadline.
+type Manager struct {
+	timeout  time.Duration
+	mu       sync.Mutex
+	hooks    []hook
+	draining atomic.Bool
+	once     sync.Once
+}
+
+// New returns a manager whose shutdown may take up to timeout
+func New(timeout time.Duration) *Manager {
+	return &Manager{timeout: timeout}
+}
+
+// OnShutdown registers a step to run on shutdown. fn should return once ctx
+// is done; a step that overruns the deadline is abandoned so later steps
+// still run.
+func (m *Manager) OnShutdown(name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook{name: name, fn: fn})
+}
+
+// Check fails once shutdown has begun, so readiness drops while draining
+func (m *Manager) Check(ctx context.Context) error {
+	if m.draining.Load() {
+		return fmt.Errorf("shutting down")
+	}
+	return nil
+}
+
+// Wait blocks until SIGINT or SIGTERM and then shuts down. A second signal
+// exits immediately.
+func (m *Manager) Wait() {
+	quit := make(chan os.Signal, 2)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-quit
+	logger.Info("Received %s, shutting down...", sig)
+
+	go func() {
+		<-quit
+		logger.Warn("Received a second signal, exiting without finishing shutdown")
+		os.Exit(1)
+	}()
+
+	m.Shutdown()
+}
+
+// Shutdown runs every hook once, newest first, and logs the outcome of each
+func (m *Manager) Shutdown() {
+	m.once.Do(func() {
+		m.draining.Store(true)
+
+		m.mu.Lock()
+		hooks := append([]hook{}, m.hooks...)
+		m.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+		defer cancel()
+
+		start := time.Now()
+		for i := len(hooks) - 1; i >= 0; i-- {
+			run(ctx, hooks[i])
+		}
+		logger.Info("Shutdown complete in %s", time.Since(start).Round(time.Millisecond))
+	})
+}
+
+func run(ctx context.Context, h hook) {
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), lateGrace)
+		defer cancel()
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- h.fn(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			logger.Error("Shutdown step %s failed: %v", h.name, err)
+			return
+		}
+		logger.Info("Shutdown step %s done in %s", h.name, time.Since(start).Round(time.Millisecond))
+	case <-ctx.Done():
+		logger.Error("Shutdown step %s did not finish before the deadline", h.name)
+	}
+}
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"solidity/pkg/logger"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "solidity"
+
+// Outcome label values
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// Settlement label values for consumed messages
+const (
+	SettleAck     = "ack"
+	SettleNack    = "nack"
+	SettleRequeue = "requeue"
+)
+
+var (
+	BrokerPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_published_total",
+		Help:      "Messages published by exchange and outcome.",
+	}, []string{"exchange", "outcome"})
+
+	BrokerConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_consumed_total",
+		Help:      "Messages delivered by queue.",
+	}, []string{"queue"})
+
+	BrokerSettled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_settled_total",
+		Help:      "Consumed messages by queue and settlement: ack, nack or requeue.",
+	}, []string{"queue", "result"})
+
+	BrokerQueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "broker_queue_wait_seconds",
+		Help:      "Time between publish and delivery, for messages carrying a timestamp.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60},
+	}, []string{"queue"})
+
+	ActionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "keyring_action_duration_seconds",
+		Help:      "Keyring actions handled by action and outcome.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"action", "outcome"})
+
+	ContractDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "contract_call_duration_seconds",
+		Help:      "Contract sidecar calls by operation and outcome.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"operation", "outcome"})
+
+	ContractGas = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "contract_gas_used",
+		Help:      "Gas used by contract transactions, as reported by the sidecar.",
+		Buckets:   prometheus.ExponentialBuckets(21000, 2, 8),
+	}, []string{"operation"})
+
+	ProviderProbeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_probe_duration_seconds",
+		Help:      "Key probes against LLM providers by provider and result.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"provider", "status"})
+)
+
+// Since returns the seconds elapsed since start, for Observe
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// Serve adds the default registry at /metrics to mux and serves it on addr.
+// The worker has no other HTTP listener, so this one stands alone and carries
+// any routes already on mux; it returns the server so the caller can shut it down.
+func Serve(addr string, mux *http.ServeMux) *http.Server {
+	mux.Handle("/metrics", promhttp.Handler())
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.Info("Metrics and probes listening on %s", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Metrics listener failed: %v", err)
+		}
+	}()
+	return server
+}
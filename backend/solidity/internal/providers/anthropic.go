@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const anthropicVersion = "2023-06-01"
+
+// Anthropic probes keys with a one-token message. Listing models would be
+// free, but it succeeds for accounts with no credit left.
+type Anthropic struct {
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+// NewAnthropic creates an Anthropic probe against baseURL (e.g. https://api.anthropic.com)
+// that completes with model
+func NewAnthropic(baseURL, model string, timeout time.Duration) *Anthropic {
+	return &Anthropic{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+		client:  newHTTPClient(timeout),
+	}
+}
+
+// Name returns the provider name used in the keyring
+func (a *Anthropic) Name() string {
+	return "anthropic"
+}
+
+// Probe asks for a one-token message with the key and classifies the response
+func (a *Anthropic) Probe(ctx context.Context, key string) ProbeResult {
+	status, body, err := probePost(ctx, a.client, a.baseURL+"/v1/messages", map[string]string{
+		"x-api-key":         key,
+		"anthropic-version": anthropicVersion,
+	}, map[string]any{
+		"model":      a.model,
+		"max_tokens": 1,
+		"messages":   []map[string]string{{"role": "user", "content": "ping"}},
+	})
+	if err != nil {
+		return ProbeResult{Provider: a.Name(), Status: StatusUnreachable, Detail: err.Error()}
+	}
+
+	switch {
+	case status == http.StatusOK:
+		return ProbeResult{Provider: a.Name(), Status: StatusValid}
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ProbeResult{Provider: a.Name(), Status: StatusInvalid, Detail: "key was rejected"}
+	case strings.Contains(body, "credit balance"):
+		return ProbeResult{Provider: a.Name(), Status: StatusQuotaExhausted, Detail: "account has no remaining credit"}
+	case status == http.StatusTooManyRequests:
+		// Rate limited, but the key itself was accepted
+		return ProbeResult{Provider: a.Name(), Status: StatusValid, Detail: "rate limited during probe"}
+	case status == http.StatusBadRequest || status == http.StatusNotFound:
+		// Authenticated, but the probe model is not available to the key
+		return ProbeResult{Provider: a.Name(), Status: StatusValid, Detail: fmt.Sprintf("key accepted; probe model %s was refused", a.model)}
+	default:
+		return ProbeResult{Provider: a.Name(), Status: StatusUnreachable, Detail: fmt.Sprintf("unexpected status %d", status)}
+	}
+}
+
+// Ping checks that the models endpoint answers
+func (a *Anthropic) Ping(ctx context.Context) error {
+	return ping(ctx, a.client, a.baseURL+"/v1/models")
+}
@@ -0,0 +1,68 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAI probes keys with a one-token chat completion. Listing models would
+// be free, but it succeeds for accounts with no quota left.
+type OpenAI struct {
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+// NewOpenAI creates an OpenAI probe against baseURL (e.g. https://api.openai.com)
+// that completes with model
+func NewOpenAI(baseURL, model string, timeout time.Duration) *OpenAI {
+	return &OpenAI{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+		client:  newHTTPClient(timeout),
+	}
+}
+
+// Name returns the provider name used in the keyring
+func (o *OpenAI) Name() string {
+	return "openai"
+}
+
+// Probe asks for a one-token completion with the key and classifies the response
+func (o *OpenAI) Probe(ctx context.Context, key string) ProbeResult {
+	status, body, err := probePost(ctx, o.client, o.baseURL+"/v1/chat/completions", map[string]string{
+		"Authorization": "Bearer " + key,
+	}, map[string]any{
+		"model":      o.model,
+		"max_tokens": 1,
+		"messages":   []map[string]string{{"role": "user", "content": "ping"}},
+	})
+	if err != nil {
+		return ProbeResult{Provider: o.Name(), Status: StatusUnreachable, Detail: err.Error()}
+	}
+
+	switch {
+	case status == http.StatusOK:
+		return ProbeResult{Provider: o.Name(), Status: StatusValid}
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ProbeResult{Provider: o.Name(), Status: StatusInvalid, Detail: "key was rejected"}
+	case status == http.StatusTooManyRequests && strings.Contains(body, "insufficient_quota"):
+		return ProbeResult{Provider: o.Name(), Status: StatusQuotaExhausted, Detail: "account has no remaining quota"}
+	case status == http.StatusTooManyRequests:
+		// Rate limited, but the key itself was accepted
+		return ProbeResult{Provider: o.Name(), Status: StatusValid, Detail: "rate limited during probe"}
+	case status == http.StatusBadRequest || status == http.StatusNotFound:
+		// Authenticated, but the probe model is not available to the key
+		return ProbeResult{Provider: o.Name(), Status: StatusValid, Detail: fmt.Sprintf("key accepted; probe model %s was refused", o.model)}
+	default:
+		return ProbeResult{Provider: o.Name(), Status: StatusUnreachable, Detail: fmt.Sprintf("unexpected status %d", status)}
+	}
+}
+
+// Ping checks that the models endpoint answers
+func (o *OpenAI) Ping(ctx context.Context) error {
+	return ping(ctx, o.client, o.baseURL+"/v1/models")
+}
@@ -0,0 +1,145 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"solidity/internal/metrics"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Probe outcomes reported back to the frontend
+const (
+	StatusValid          = "valid"
+	StatusInvalid        = "invalid"
+	StatusQuotaExhausted = "quota_exhausted"
+	StatusUnreachable    = "unreachable"
+	StatusUnchecked      = "unchecked"
+)
+
+// ProbeResult is the outcome of checking a key against its provider
+type ProbeResult struct {
+	Provider string `json:"provider"`
+	Status   string `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// Usable reports whether the key may be stored. Keys that could not be
+// checked are let through so a provider outage does not block the form.
+func (r ProbeResult) Usable() bool {
+	return r.Status != StatusInvalid && r.Status != StatusQuotaExhausted
+}
+
+// Provider checks keys for one LLM vendor with a cheap authenticated call
+// that spends quota, so an exhausted account is told apart from a valid one
+type Provider interface {
+	Name() string
+	Probe(ctx context.Context, key string) ProbeResult
+	// Ping checks that the provider's API answers, without a key
+	Ping(ctx context.Context) error
+}
+
+// Registry looks up providers by name
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistry creates a registry holding the given providers
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider)}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	return r
+}
+
+// Probe checks key against the named provider, or reports it unchecked if
+// the provider is not registered
+func (r *Registry) Probe(ctx context.Context, provider, key string) ProbeResult {
+	p, ok := r.providers[provider]
+	if !ok {
+		return ProbeResult{Provider: provider, Status: StatusUnchecked, Detail: "no probe for this provider"}
+	}
+
+	start := time.Now()
+	result := p.Probe(ctx, key)
+	metrics.ProviderProbeDuration.WithLabelValues(provider, result.Status).Observe(metrics.Since(start))
+	return result
+}
+
+// Names lists the registered providers in sorted order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Ping checks that the named provider's API answers
+func (r *Registry) Ping(ctx context.Context, provider string) error {
+	p, ok := r.providers[provider]
+	if !ok {
+		return fmt.Errorf("unknown provider: %s", provider)
+	}
+	return p.Ping(ctx)
+}
+
+// ping reports whether url answers. Any status below 500 counts, since no
+// key is sent and a rejection still proves the API is up.
+func ping(ctx context.Context, client *http.Client, url string) error {
+	status, _, err := probeGet(ctx, client, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to reach provider: %v", err)
+	}
+	if status >= http.StatusInternalServerError {
+		return fmt.Errorf("provider returned status %d", status)
+	}
+	return nil
+}
+
+// newHTTPClient returns the client shared by provider probes
+func newHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout}
+}
+
+// probeGet issues an authenticated GET and returns the status code and a
+// short lowercase excerpt of the body for classification
+func probeGet(ctx context.Context, client *http.Client, url string, headers map[string]string) (int, string, error) {
+	return probeRequest(ctx, client, http.MethodGet, url, headers, nil)
+}
+
+// probePost sends payload as JSON and returns what probeGet does
+func probePost(ctx context.Context, client *http.Client, url string, headers map[string]string, payload any) (int, string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to marshal probe request: %v", err)
+	}
+	headers["Content-Type"] = "application/json"
+	return probeRequest(ctx, client, http.MethodPost, url, headers, bytes.NewReader(body))
+}
+
+func probeRequest(ctx context.Context, client *http.Client, method, url string, headers map[string]string, body io.Reader) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create probe request: %v", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return resp.StatusCode, strings.ToLower(string(excerpt)), nil
+}
@@ -0,0 +1,146 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeProvider answers every request with status and body, and keeps the last
+// request it saw
+type fakeProvider struct {
+	status int
+	body   string
+
+	path    string
+	headers http.Header
+	payload map[string]any
+}
+
+func (f *fakeProvider) serve(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.path = r.URL.Path
+		f.headers = r.Header.Clone()
+		f.payload = nil
+		json.NewDecoder(r.Body).Decode(&f.payload)
+		w.WriteHeader(f.status)
+		w.Write([]byte(f.body))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestOpenAIProbe(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"completion", http.StatusOK, `{"choices":[]}`, StatusValid},
+		{"bad key", http.StatusUnauthorized, `{"error":{"code":"invalid_api_key"}}`, StatusInvalid},
+		{"forbidden", http.StatusForbidden, `{}`, StatusInvalid},
+		{"no quota", http.StatusTooManyRequests, `{"error":{"type":"insufficient_quota","code":"insufficient_quota"}}`, StatusQuotaExhausted},
+		{"rate limited", http.StatusTooManyRequests, `{"error":{"code":"rate_limit_exceeded"}}`, StatusValid},
+		{"model refused", http.StatusNotFound, `{"error":{"code":"model_not_found"}}`, StatusValid},
+		{"outage", http.StatusServiceUnavailable, ``, StatusUnreachable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeProvider{status: tt.status, body: tt.body}
+			probe := NewOpenAI(fake.serve(t), "gpt-4o-mini", time.Second)
+
+			result := probe.Probe(context.Background(), "sk-test")
+			if result.Status != tt.want {
+				t.Fatalf("status: got %s (%s), want %s", result.Status, result.Detail, tt.want)
+			}
+			if result.Provider != "openai" {
+				t.Fatalf("provider: got %s, want openai", result.Provider)
+			}
+			if fake.path != "/v1/chat/completions" {
+				t.Fatalf("path: got %s, want a completion", fake.path)
+			}
+			if got := fake.headers.Get("Authorization"); got != "Bearer sk-test" {
+				t.Fatalf("authorization: got %q", got)
+			}
+			if fake.payload["max_tokens"] != float64(1) || fake.payload["model"] != "gpt-4o-mini" {
+				t.Fatalf("payload: got %v, want a one-token completion with the probe model", fake.payload)
+			}
+		})
+	}
+}
+
+func TestAnthropicProbe(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"message", http.StatusOK, `{"content":[]}`, StatusValid},
+		{"bad key", http.StatusUnauthorized, `{"error":{"type":"authentication_error"}}`, StatusInvalid},
+		{"forbidden", http.StatusForbidden, `{"error":{"type":"permission_error"}}`, StatusInvalid},
+		{"no credit", http.StatusBadRequest, `{"error":{"type":"invalid_request_error","message":"Your credit balance is too low to access the Anthropic API."}}`, StatusQuotaExhausted},
+		{"rate limited", http.StatusTooManyRequests, `{"error":{"type":"rate_limit_error"}}`, StatusValid},
+		{"model refused", http.StatusNotFound, `{"error":{"type":"not_found_error"}}`, StatusValid},
+		{"outage", http.StatusInternalServerError, ``, StatusUnreachable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeProvider{status: tt.status, body: tt.body}
+			probe := NewAnthropic(fake.serve(t), "claude-3-5-haiku-latest", time.Second)
+
+			result := probe.Probe(context.Background(), "sk-ant-test")
+			if result.Status != tt.want {
+				t.Fatalf("status: got %s (%s), want %s", result.Status, result.Detail, tt.want)
+			}
+			if result.Provider != "anthropic" {
+				t.Fatalf("provider: got %s, want anthropic", result.Provider)
+			}
+			if fake.path != "/v1/messages" {
+				t.Fatalf("path: got %s, want a message", fake.path)
+			}
+			if got := fake.headers.Get("x-api-key"); got != "sk-ant-test" {
+				t.Fatalf("x-api-key: got %q", got)
+			}
+			if fake.headers.Get("anthropic-version") == "" {
+				t.Fatal("anthropic-version header is missing")
+			}
+			if fake.payload["max_tokens"] != float64(1) {
+				t.Fatalf("payload: got %v, want a one-token message", fake.payload)
+			}
+		})
+	}
+}
+
+func TestProbeUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	for _, probe := range []Provider{
+		NewOpenAI(url, "gpt-4o-mini", time.Second),
+		NewAnthropic(url, "claude-3-5-haiku-latest", time.Second),
+	} {
+		if result := probe.Probe(context.Background(), "key"); result.Status != StatusUnreachable {
+			t.Errorf("%s: got %s, want %s", probe.Name(), result.Status, StatusUnreachable)
+		}
+	}
+}
+
+func TestRegistryProbe(t *testing.T) {
+	fake := &fakeProvider{status: http.StatusUnauthorized}
+	registry := NewRegistry(NewOpenAI(fake.serve(t), "gpt-4o-mini", time.Second))
+
+	if result := registry.Probe(context.Background(), "openai", "sk-bad"); result.Usable() {
+		t.Fatalf("rejected key is usable: %+v", result)
+	}
+	result := registry.Probe(context.Background(), "mistral", "key")
+	if result.Status != StatusUnchecked || !result.Usable() {
+		t.Fatalf("unknown provider: got %+v, want an unchecked, usable result", result)
+	}
+}
@@ -2,6 +2,8 @@ package rabbitmq
 
 import (
 	"encoding/json"
+	"solidity/internal/metrics"
+	"time"
 
 	"github.com/streadway/amqp"
 )
@@ -61,6 +63,28 @@ func NewProducer(channel *amqp.Channel, queueName, exchangeName, routingKey stri
 	}, nil
 }
 
+// NewBroadcastProducer declares a fanout exchange and returns a producer that
+// publishes to every queue bound to it
+func NewBroadcastProducer(channel *amqp.Channel, exchangeName string) (*Producer, error) {
+	err := channel.ExchangeDeclare(
+		exchangeName, // name
+		"fanout",     // type
+		true,         // durable
+		false,        // auto-deleted
+		false,        // internal
+		false,        // no-wait
+		nil,          // arguments
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Producer{
+		channel:      channel,
+		exchangeName: exchangeName,
+	}, nil
+}
+
 func (p *Producer) PublishMessage(message interface{}) error {
 	// Convert message to JSON
 	body, err := json.Marshal(message)
@@ -68,15 +92,23 @@ func (p *Producer) PublishMessage(message interface{}) error {
 		return err
 	}
 
-	// Publish the message
-	return p.channel.Publish(
+	// Publish the message; the timestamp lets consumers measure queue wait
+	err = p.channel.Publish(
 		p.exchangeName, // exchange
 		p.routingKey,   // routing key
 		false,          // mandatory
 		false,          // immediate
 		amqp.Publishing{
 			ContentType: "application/json",
+			Timestamp:   time.Now(),
 			Body:        body,
 		},
 	)
+
+	outcome := metrics.OutcomeSuccess
+	if err != nil {
+		outcome = metrics.OutcomeError
+	}
+	metrics.BrokerPublished.WithLabelValues(p.exchangeName, outcome).Inc()
+	return err
 }
@@ -0,0 +1,61 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SignWindow is how far the signing time of a signed request may be from the
+// server's clock
+const SignWindow = 5 * time.Minute
+
+// ErrNonceUsed is returned when a signed request is replayed
+var ErrNonceUsed = errors.New("nonce has already been used")
+
+// Nonces rejects replayed signed requests. A request carries the time it was
+// signed, which must be within SignWindow of now, and a nonce, which may be
+// used once. Nonces are remembered until their request could no longer pass
+// the time check.
+type Nonces struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewNonces creates an empty nonce store
+func NewNonces() *Nonces {
+	return &Nonces{seen: make(map[string]time.Time)}
+}
+
+// CheckIssued verifies that issued is an RFC 3339 time within SignWindow of now
+func CheckIssued(issued string, now time.Time) error {
+	at, err := time.Parse(time.RFC3339, issued)
+	if err != nil {
+		return fmt.Errorf("issued must be an RFC 3339 time")
+	}
+	if at.Sub(now) > SignWindow || now.Sub(at) > SignWindow {
+		return fmt.Errorf("issued must be within %s of the server time", SignWindow)
+	}
+	return nil
+}
+
+// Use records a nonce for address, failing with ErrNonceUsed if it was seen
+// within the window
+func (n *Nonces) Use(address, nonce string, now time.Time) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for key, seen := range n.seen {
+		if now.Sub(seen) > 2*SignWindow {
+			delete(n.seen, key)
+		}
+	}
+
+	key := address + "\n" + nonce
+	if _, used := n.seen[key]; used {
+		return ErrNonceUsed
+	}
+	n.seen[key] = now
+	return nil
+}
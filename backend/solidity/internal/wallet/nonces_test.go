@@ -0,0 +1,59 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckIssued(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		issued string
+		ok     bool
+	}{
+		{now.Format(time.RFC3339), true},
+		{now.Add(-4 * time.Minute).Format(time.RFC3339), true},
+		{now.Add(4 * time.Minute).Format(time.RFC3339), true},
+		{now.Add(-6 * time.Minute).Format(time.RFC3339), false},
+		{now.Add(6 * time.Minute).Format(time.RFC3339), false},
+		{"yesterday", false},
+	}
+	for _, tt := range tests {
+		if err := CheckIssued(tt.issued, now); (err == nil) != tt.ok {
+			t.Errorf("CheckIssued(%q): got %v, want ok=%v", tt.issued, err, tt.ok)
+		}
+	}
+}
+
+func TestNoncesRejectReplays(t *testing.T) {
+	nonces := NewNonces()
+	now := time.Now()
+
+	if err := nonces.Use("0xabc", "n1", now); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := nonces.Use("0xabc", "n1", now.Add(time.Minute)); !errors.Is(err, ErrNonceUsed) {
+		t.Fatalf("replay: got %v, want ErrNonceUsed", err)
+	}
+	if err := nonces.Use("0xdef", "n1", now); err != nil {
+		t.Fatalf("same nonce, other address: %v", err)
+	}
+}
+
+func TestNoncesForgetPastTheWindow(t *testing.T) {
+	nonces := NewNonces()
+	now := time.Now()
+
+	if err := nonces.Use("0xabc", "n1", now); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	// By now a request signed with n1 fails CheckIssued, so the nonce can go
+	later := now.Add(2*SignWindow + time.Second)
+	if err := nonces.Use("0xabc", "n2", later); err != nil {
+		t.Fatalf("other nonce: %v", err)
+	}
+	if len(nonces.seen) != 1 {
+		t.Fatalf("remembered %d nonces, want only the recent one", len(nonces.seen))
+	}
+}
@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Encoder renders an entry into buf without a trailing newline
+type Encoder interface {
+	Encode(buf *bytes.Buffer, entry *Entry)
+}
+
+// NewEncoder returns the encoder for a format name; empty means console
+func NewEncoder(format string) (Encoder, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "console", "text":
+		return ConsoleEncoder{}, nil
+	case "json":
+		return JSONEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// ConsoleEncoder writes human-readable lines:
+// [timestamp] [LEVEL] [file:line] message key=value ...
+type ConsoleEncoder struct{}
+
+// Encode implements Encoder
+func (ConsoleEncoder) Encode(buf *bytes.Buffer, entry *Entry) {
+	fmt.Fprintf(buf, "[%s] [%s] [%s] %s",
+		entry.Time.Format("2006-01-02 15:04:05.000"),
+		levelNames[entry.Level],
+		entry.Caller,
+		entry.Message,
+	)
+
+	for _, f := range entry.Fields {
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+
+		value := fmt.Sprint(fieldValue(f.Value))
+		if strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		buf.WriteString(value)
+	}
+}
+
+// JSONEncoder writes one JSON object per line with ts, level, caller and msg
+// first, followed by the entry's fields in order
+type JSONEncoder struct{}
+
+// Encode implements Encoder
+func (JSONEncoder) Encode(buf *bytes.Buffer, entry *Entry) {
+	buf.WriteByte('{')
+	writeJSONPair(buf, "ts", entry.Time.UTC().Format("2006-01-02T15:04:05.000Z07:00"), false)
+	writeJSONPair(buf, "level", levelNames[entry.Level], true)
+	writeJSONPair(buf, "caller", entry.Caller, true)
+	writeJSONPair(buf, "msg", entry.Message, true)
+
+	for _, f := range entry.Fields {
+		writeJSONPair(buf, f.Key, fieldValue(f.Value), true)
+	}
+	buf.WriteByte('}')
+}
+
+func writeJSONPair(buf *bytes.Buffer, key string, value interface{}, comma bool) {
+	if comma {
+		buf.WriteByte(',')
+	}
+
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(v)
+}
+
+// fieldValue renders values that would otherwise encode poorly, such as errors
+func fieldValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case time.Time:
+		return val
+	case error:
+		return val.Error()
+	case fmt.Stringer:
+		return val.String()
+	default:
+		return v
+	}
+}
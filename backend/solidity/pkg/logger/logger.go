@@ -1,12 +1,18 @@
 package logger
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -27,123 +33,341 @@ var levelNames = map[int]string{
 	FATAL: "FATAL",
 }
 
+// ParseLevel converts a level name such as "info" or "WARN" into its constant
+func ParseLevel(name string) (int, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "DEBUG":
+		return DEBUG, nil
+	case "INFO":
+		return INFO, nil
+	case "WARN", "WARNING":
+		return WARN, nil
+	case "ERROR":
+		return ERROR, nil
+	case "FATAL":
+		return FATAL, nil
+	default:
+		return DEBUG, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+// Options configures the global logger
+type Options struct {
+	FilePath string
+	MinLevel string
+	Format   string // "console" or "json"
+	Rotate   RotateOptions
+}
+
+// Field is a structured key/value pair attached to a log entry
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Entry is a single log line before encoding
+type Entry struct {
+	Time    time.Time
+	Level   int
+	Caller  string
+	Message string
+	Fields  []Field
+}
+
+// core is the output shared by a logger and all of its children
+type core struct {
+	mu       sync.Mutex
+	out      io.Writer
+	encoder  Encoder
+	minLevel atomic.Int32
+	logFile  *RotatingFile
+}
+
+// CustomLogger writes level-filtered entries through an encoder. Child
+// loggers created with With share the output and add their own fields.
 type CustomLogger struct {
-	debugLogger *log.Logger
-	infoLogger  *log.Logger
-	warnLogger  *log.Logger
-	errorLogger *log.Logger
-	fatalLogger *log.Logger
-	logFile     *os.File
+	core   *core
+	fields []Field
+}
+
+// Logger is the global logger; it writes console lines to stdout until InitLogger runs
+var Logger = &CustomLogger{
+	core: &core{
+		out:     os.Stdout,
+		encoder: ConsoleEncoder{},
+	},
+}
+
+// The standard library logger is routed through Logger so its lines are
+// filtered and redacted like everything else
+func init() {
+	log.SetFlags(0)
+	log.SetOutput(stdlibWriter{})
 }
 
-var Logger *CustomLogger
+// stdlibWriter adapts the standard library logger onto the global logger
+type stdlibWriter struct{}
+
+func (stdlibWriter) Write(p []byte) (int, error) {
+	Logger.write(INFO, "stdlib", strings.TrimRight(string(p), "\n"), nil)
+	return len(p), nil
+}
 
 // InitLogger initializes the logger with file and console output
 func InitLogger(logFilePath string) error {
-	// Create logs directory if it doesn't exist
-	logDir := filepath.Dir(logFilePath)
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		return fmt.Errorf("failed to create log directory: %v", err)
+	return InitLoggerWithOptions(Options{FilePath: logFilePath})
+}
+
+// InitLoggerWithOptions initializes the logger with file and console output,
+// the given minimum level and encoder
+func InitLoggerWithOptions(opts Options) error {
+	minLevel := DEBUG
+	if opts.MinLevel != "" {
+		level, err := ParseLevel(opts.MinLevel)
+		if err != nil {
+			return err
+		}
+		minLevel = level
 	}
 
-	// Open log file
-	file, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	encoder, err := NewEncoder(opts.Format)
 	if err != nil {
-		return fmt.Errorf("failed to open log file: %v", err)
+		return err
 	}
 
-	// Create multi-writer for both file and console
-	multiWriter := io.MultiWriter(file, os.Stdout)
-
-	// Initialize logger with different levels
-	Logger = &CustomLogger{
-		debugLogger: log.New(multiWriter, "", 0),
-		infoLogger:  log.New(multiWriter, "", 0),
-		warnLogger:  log.New(multiWriter, "", 0),
-		errorLogger: log.New(multiWriter, "", 0),
-		fatalLogger: log.New(multiWriter, "", 0),
-		logFile:     file,
+	// Open log file, creating the logs directory if it doesn't exist
+	file, err := OpenRotatingFile(opts.FilePath, opts.Rotate)
+	if err != nil {
+		return err
+	}
+
+	c := &core{
+		// Create multi-writer for both file and console
+		out:     io.MultiWriter(file, os.Stdout),
+		encoder: encoder,
+		logFile: file,
 	}
+	c.minLevel.Store(int32(minLevel))
+	Logger = &CustomLogger{core: c}
 
+	sighupOnce.Do(watchSIGHUP)
 	return nil
 }
 
+var sighupOnce sync.Once
+
+// watchSIGHUP reopens the log file on SIGHUP, after an external logrotate
+// has moved it away
+func watchSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			if err := Logger.Reopen(); err != nil {
+				fmt.Fprintf(os.Stderr, "logger: failed to reopen log file: %v\n", err)
+				continue
+			}
+			Logger.Info("Reopened log file after SIGHUP")
+		}
+	}()
+}
+
 // Close closes the log file
 func (l *CustomLogger) Close() {
-	if l.logFile != nil {
-		l.logFile.Close()
+	if l.core.logFile != nil {
+		l.core.logFile.Close()
+	}
+}
+
+// Reopen closes and reopens the log file at its configured path
+func (l *CustomLogger) Reopen() error {
+	if l.core.logFile == nil {
+		return nil
+	}
+	return l.core.logFile.Reopen()
+}
+
+// With returns a child logger that adds the given key/value pairs to every entry
+func (l *CustomLogger) With(keysAndValues ...interface{}) *CustomLogger {
+	fields := make([]Field, 0, len(l.fields)+len(keysAndValues)/2)
+	fields = append(fields, l.fields...)
+	fields = append(fields, toFields(keysAndValues)...)
+
+	return &CustomLogger{
+		core:   l.core,
+		fields: fields,
+	}
+}
+
+// Enabled reports whether entries at level would be written
+func (l *CustomLogger) Enabled(level int) bool {
+	return int32(level) >= l.core.minLevel.Load()
+}
+
+// SetLevel changes the minimum level at runtime for the logger and all of its children
+func (l *CustomLogger) SetLevel(name string) error {
+	level, err := ParseLevel(name)
+	if err != nil {
+		return err
 	}
+	l.core.minLevel.Store(int32(level))
+	return nil
 }
 
-// formatLog formats the log message with timestamp, level, and caller information
-func formatLog(level int, format string, args ...interface{}) string {
+// output resolves the caller and writes one entry. skip is the number of frames between
+// output and the code that called into the logger.
+func (l *CustomLogger) output(level, skip int, msg string, fields []Field) {
+	if !l.Enabled(level) && level != FATAL {
+		return
+	}
+
 	// Get caller information
-	_, file, line, _ := runtime.Caller(2)
-	file = filepath.Base(file)
+	caller := "???"
+	if _, file, line, ok := runtime.Caller(skip + 1); ok {
+		caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
 
-	// Format timestamp
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
+	l.write(level, caller, msg, fields)
+}
 
-	// Format message
-	var msg string
+// write redacts the message and field values, encodes the entry and redacts
+// the encoded line again before handing it to the output; nothing reaches a
+// writer unredacted
+func (l *CustomLogger) write(level int, caller, msg string, fields []Field) {
+	if !l.Enabled(level) && level != FATAL {
+		return
+	}
+
+	entry := &Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Caller:  caller,
+		Message: Redact(msg),
+		Fields:  redactFields(append(append([]Field{}, l.fields...), fields...)),
+	}
+
+	var buf bytes.Buffer
+	l.core.encoder.Encode(&buf, entry)
+	line := Redact(buf.String()) + "\n"
+
+	l.core.mu.Lock()
+	io.WriteString(l.core.out, line)
+	l.core.mu.Unlock()
+}
+
+// sprintf formats printf-style arguments, leaving the format untouched when there are none
+func sprintf(format string, args []interface{}) string {
 	if len(args) > 0 {
-		msg = fmt.Sprintf(format, args...)
-	} else {
-		msg = format
+		return fmt.Sprintf(format, args...)
 	}
+	return format
+}
 
-	return fmt.Sprintf("[%s] [%s] [%s:%d] %s",
-		timestamp,
-		levelNames[level],
-		file,
-		line,
-		msg,
-	)
+// toFields pairs up alternating keys and values
+func toFields(keysAndValues []interface{}) []Field {
+	fields := make([]Field, 0, len(keysAndValues)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		if i+1 >= len(keysAndValues) {
+			fields = append(fields, Field{Key: "extra", Value: key})
+			break
+		}
+		fields = append(fields, Field{Key: key, Value: keysAndValues[i+1]})
+	}
+	return fields
 }
 
 // Debug logs a debug message
 func (l *CustomLogger) Debug(format string, args ...interface{}) {
-	l.debugLogger.Println(formatLog(DEBUG, format, args...))
+	l.output(DEBUG, 1, sprintf(format, args), nil)
 }
 
 // Info logs an info message
 func (l *CustomLogger) Info(format string, args ...interface{}) {
-	l.infoLogger.Println(formatLog(INFO, format, args...))
+	l.output(INFO, 1, sprintf(format, args), nil)
 }
 
 // Warn logs a warning message
 func (l *CustomLogger) Warn(format string, args ...interface{}) {
-	l.warnLogger.Println(formatLog(WARN, format, args...))
+	l.output(WARN, 1, sprintf(format, args), nil)
 }
 
 // Error logs an error message
 func (l *CustomLogger) Error(format string, args ...interface{}) {
-	l.errorLogger.Println(formatLog(ERROR, format, args...))
+	l.output(ERROR, 1, sprintf(format, args), nil)
 }
 
 // Fatal logs a fatal message and exits the program
 func (l *CustomLogger) Fatal(format string, args ...interface{}) {
-	l.fatalLogger.Println(formatLog(FATAL, format, args...))
+	l.output(FATAL, 1, sprintf(format, args), nil)
 	os.Exit(1)
 }
 
+// Debugw logs a debug message with structured key/value pairs
+func (l *CustomLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.output(DEBUG, 1, msg, toFields(keysAndValues))
+}
+
+// Infow logs an info message with structured key/value pairs
+func (l *CustomLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.output(INFO, 1, msg, toFields(keysAndValues))
+}
+
+// Warnw logs a warning message with structured key/value pairs
+func (l *CustomLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.output(WARN, 1, msg, toFields(keysAndValues))
+}
+
+// Errorw logs an error message with structured key/value pairs
+func (l *CustomLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.output(ERROR, 1, msg, toFields(keysAndValues))
+}
+
 // Convenience functions for the global logger instance
 func Debug(format string, args ...interface{}) {
-	Logger.Debug(format, args...)
+	Logger.output(DEBUG, 1, sprintf(format, args), nil)
 }
 
 func Info(format string, args ...interface{}) {
-	Logger.Info(format, args...)
+	Logger.output(INFO, 1, sprintf(format, args), nil)
 }
 
 func Warn(format string, args ...interface{}) {
-	Logger.Warn(format, args...)
+	Logger.output(WARN, 1, sprintf(format, args), nil)
 }
 
 func Error(format string, args ...interface{}) {
-	Logger.Error(format, args...)
+	Logger.output(ERROR, 1, sprintf(format, args), nil)
 }
 
 func Fatal(format string, args ...interface{}) {
-	Logger.Fatal(format, args...)
+	Logger.output(FATAL, 1, sprintf(format, args), nil)
+	os.Exit(1)
+}
+
+func Debugw(msg string, keysAndValues ...interface{}) {
+	Logger.output(DEBUG, 1, msg, toFields(keysAndValues))
+}
+
+func Infow(msg string, keysAndValues ...interface{}) {
+	Logger.output(INFO, 1, msg, toFields(keysAndValues))
+}
+
+func Warnw(msg string, keysAndValues ...interface{}) {
+	Logger.output(WARN, 1, msg, toFields(keysAndValues))
+}
+
+func Errorw(msg string, keysAndValues ...interface{}) {
+	Logger.output(ERROR, 1, msg, toFields(keysAndValues))
+}
+
+// SetLevel changes the global logger's minimum level at runtime
+func SetLevel(name string) error {
+	return Logger.SetLevel(name)
+}
+
+// With returns a child of the global logger carrying the given key/value pairs
+func With(keysAndValues ...interface{}) *CustomLogger {
+	return Logger.With(keysAndValues...)
 }
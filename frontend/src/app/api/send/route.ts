@@ -6,6 +6,9 @@ const schema = z.object({
   address: z.string().min(1),
   name: z.string().min(1),
   key: z.string().min(1),
+  issued: z.string().min(1),
+  nonce: z.string().min(1),
+  signature: z.string().min(1),
 });
 
 export async function POST(req: NextRequest) {
@@ -13,7 +16,8 @@ export async function POST(req: NextRequest) {
     const body = await req.json();
 
     // just some string validation with zod
-    const { address, name, key } = schema.parse(body);
+    const { address, name, key, issued, nonce, signature } =
+      schema.parse(body);
 
     // encrypt data here
 
@@ -37,7 +41,9 @@ export async function POST(req: NextRequest) {
     const sent = channel.publish(
       exchange,
       route,
-      Buffer.from(JSON.stringify({ address, name, key }))
+      Buffer.from(
+        JSON.stringify({ address, name, key, issued, nonce, signature })
+      )
     );
 
     if (sent)
@@ -5,6 +5,7 @@ import { Field } from "@/components/ui/field";
 import { Input, Stack, Text } from "@chakra-ui/react";
 import { zodResolver } from "@hookform/resolvers/zod";
 import axios from "axios";
+import { ethers } from "ethers";
 import { useState } from "react";
 import { useForm } from "react-hook-form";
 import z from "zod";
@@ -27,12 +28,27 @@ export default function Form({ address }: { address: string }) {
   const onSubmit = async ({ name, key }: FormData) => {
     const validate = schema.safeParse({ name, key });
     if (validate.success) {
+      // the solidity service only stores a key the owner signed for, bound
+      // by the key's fingerprint
+      const signer = await new ethers.BrowserProvider(
+        window.ethereum
+      ).getSigner();
+      const fingerprint = ethers.sha256(ethers.toUtf8Bytes(key)).slice(2, 34);
+      const issued = new Date().toISOString();
+      const nonce = crypto.randomUUID();
+      const signature = await signer.signMessage(
+        `b.env store key\naddress: ${address.toLowerCase()}\nname: ${name}\nkey: ${fingerprint}\ndefault: false\nissued: ${issued}\nnonce: ${nonce}`
+      );
+
       // example of api call from client
       const res = await axios
         .post(`/api/send`, {
           address,
           name,
           key,
+          issued,
+          nonce,
+          signature,
         })
         .catch((e) => {
           if (axios.isAxiosError(e)) {
@@ -0,0 +1,44 @@
+import axios from "axios";
+import { Signer } from "ethers";
+
+const interceptorURL =
+  process.env.NEXT_PUBLIC_INTERCEPTOR_URL ?? "http://localhost:3000";
+
+export type Session = {
+  address: string;
+  token: string;
+  expires_at: string;
+};
+
+// the interceptor checks the signature, the issued time and that the nonce
+// has not been used before
+export async function openSession(signer: Signer): Promise<Session> {
+  const address = await signer.getAddress();
+  const issued = new Date().toISOString();
+  const nonce = crypto.randomUUID();
+  const signature = await signer.signMessage(
+    `b.env open session\naddress: ${address}\nissued: ${issued}\nnonce: ${nonce}`
+  );
+
+  const res = await axios.post(`${interceptorURL}/api/sessions`, {
+    address,
+    issued,
+    nonce,
+    signature,
+  });
+  return res.data.session;
+}
+
+// publishBroker sends a completion request as the session's address
+export async function publishBroker(
+  session: Session,
+  body: { message?: string; model?: string; owner?: string } & Record<
+    string,
+    unknown
+  >
+) {
+  const res = await axios.post(`${interceptorURL}/api/publishbroker`, body, {
+    headers: { Authorization: `Bearer ${session.token}` },
+  });
+  return res.data;
+}
@@ -10,10 +10,21 @@ contract SecretStorage {
         string encryptedApiKey;
     }
 
+    // a named key: one of several an address may hold
+    struct NamedKey {
+        string provider;
+        string encryptedApiKey;
+        uint64 version;
+    }
+
     Verifier public verifier;
     mapping(address => ApiLots) public lots;
+    // named keys, one slot per (address, name)
+    mapping(address => mapping(string => NamedKey)) private namedKeys;
 
     event EncryptedApiKeyStored(address indexed user, string encryptedApiKey);
+    event NamedApiKeyStored(address indexed user, string name, string provider, uint64 version);
+    event NamedApiKeyDeleted(address indexed user, string name);
 
     constructor(address _verifierAddress) {
         verifier = Verifier(_verifierAddress);
@@ -54,4 +65,92 @@ contract SecretStorage {
         );
         return lots[targetAddress].encryptedApiKey;
     }
+
+    // store a named key; the name must be free
+    function storeNamedApiKey(
+        address targetAddress,
+        string calldata name,
+        string calldata provider,
+        string calldata _encryptedApiKey,
+        bytes32[] calldata proof
+    ) public {
+        require(
+            verifier.verify(msg.sender, proof),
+            "Not authorized to store API keys"
+        );
+        require(bytes(name).length > 0, "Key name is required");
+        require(bytes(_encryptedApiKey).length > 0, "API key is required");
+
+        NamedKey storage slot = namedKeys[targetAddress][name];
+        require(
+            bytes(slot.encryptedApiKey).length == 0,
+            "API key already stored"
+        );
+
+        slot.provider = provider;
+        slot.encryptedApiKey = _encryptedApiKey;
+        slot.version = 1;
+
+        emit NamedApiKeyStored(targetAddress, name, provider, 1);
+    }
+
+    // replace a stored named key, keeping its provider
+    function rotateNamedApiKey(
+        address targetAddress,
+        string calldata name,
+        string calldata _encryptedApiKey,
+        bytes32[] calldata proof
+    ) public {
+        require(
+            verifier.verify(msg.sender, proof),
+            "Not authorized to store API keys"
+        );
+        require(bytes(_encryptedApiKey).length > 0, "API key is required");
+
+        NamedKey storage slot = namedKeys[targetAddress][name];
+        require(bytes(slot.encryptedApiKey).length > 0, "API key not stored");
+
+        slot.encryptedApiKey = _encryptedApiKey;
+        slot.version += 1;
+
+        emit NamedApiKeyStored(targetAddress, name, slot.provider, slot.version);
+    }
+
+    // clear a named key, freeing the name
+    function deleteNamedApiKey(
+        address targetAddress,
+        string calldata name,
+        bytes32[] calldata proof
+    ) public {
+        require(
+            verifier.verify(msg.sender, proof),
+            "Not authorized to delete API keys"
+        );
+        require(
+            bytes(namedKeys[targetAddress][name].encryptedApiKey).length > 0,
+            "API key not stored"
+        );
+
+        delete namedKeys[targetAddress][name];
+
+        emit NamedApiKeyDeleted(targetAddress, name);
+    }
+
+    // get a named key; an empty key means none is stored under the name
+    function getNamedApiKey(
+        address targetAddress,
+        string calldata name,
+        bytes32[] calldata proof
+    )
+        public
+        view
+        returns (string memory provider, string memory encryptedApiKey, uint64 version)
+    {
+        require(
+            verifier.verify(msg.sender, proof),
+            "Not authorized to access this API key"
+        );
+        NamedKey storage slot = namedKeys[targetAddress][name];
+        return (slot.provider, slot.encryptedApiKey, slot.version);
+    }
 }
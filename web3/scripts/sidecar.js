@@ -0,0 +1,143 @@
+const hre = require("hardhat");
+const http = require("http");
+const crypto = require("crypto");
+const deployData = require('./deployData.json');
+
+// HTTP sidecar the solidity service calls to read and write named keys in
+// SecretStorage. Keys are encrypted here, so only ciphertext goes on-chain.
+//
+//   SIDECAR_PORT            port to listen on (default 3003)
+//   SIDECAR_ENCRYPTION_KEY  32-byte hex AES-256-GCM key
+//
+// Run with: npx hardhat run scripts/sidecar.js --network <network-name>
+// The first signer submits the transactions and must be in the Merkle tree.
+
+const port = Number(process.env.SIDECAR_PORT || 3003);
+const encryptionKey = Buffer.from(process.env.SIDECAR_ENCRYPTION_KEY || "", "hex");
+
+function encrypt(plaintext) {
+    const iv = crypto.randomBytes(12);
+    const cipher = crypto.createCipheriv("aes-256-gcm", encryptionKey, iv);
+    const sealed = Buffer.concat([cipher.update(plaintext, "utf8"), cipher.final()]);
+    return Buffer.concat([iv, cipher.getAuthTag(), sealed]).toString("base64");
+}
+
+function decrypt(encoded) {
+    const data = Buffer.from(encoded, "base64");
+    const decipher = crypto.createDecipheriv("aes-256-gcm", encryptionKey, data.subarray(0, 12));
+    decipher.setAuthTag(data.subarray(12, 28));
+    return Buffer.concat([decipher.update(data.subarray(28)), decipher.final()]).toString("utf8");
+}
+
+// readBody parses a JSON request body
+function readBody(req) {
+    return new Promise((resolve, reject) => {
+        let body = "";
+        req.on("data", chunk => { body += chunk; });
+        req.on("end", () => {
+            try {
+                resolve(JSON.parse(body || "{}"));
+            } catch (error) {
+                reject(new Error("Invalid JSON body"));
+            }
+        });
+        req.on("error", reject);
+    });
+}
+
+function reply(res, status, payload) {
+    res.writeHead(status, { "Content-Type": "application/json" });
+    res.end(JSON.stringify(payload));
+}
+
+// submitted waits for a transaction and reports it the way the Go client reads it
+async function submitted(tx) {
+    const receipt = await tx.wait();
+    return { success: true, txHash: receipt.hash, gasUsed: Number(receipt.gasUsed) };
+}
+
+// routesFor maps each sidecar path to its handler against a connected
+// SecretStorage contract
+function routesFor(secretStorage, proof) {
+    return {
+        "/keys/store": async ({ address, name, provider, key }) => {
+            if (!key) {
+                throw new Error("key is required");
+            }
+            return submitted(await secretStorage.storeNamedApiKey(address, name, provider || "", encrypt(key), proof));
+        },
+        "/keys/get": async ({ address, name }) => {
+            // The unnamed slot predates named keys and is encrypted the same way
+            if (!name) {
+                const encrypted = await secretStorage.getEncryptedApiKeyForAddress(address, proof);
+                return { success: true, key: encrypted ? decrypt(encrypted) : "" };
+            }
+            const [, encrypted] = await secretStorage.getNamedApiKey(address, name, proof);
+            return { success: true, key: encrypted ? decrypt(encrypted) : "" };
+        },
+        "/keys/rotate": async ({ address, name, key }) => {
+            if (!key) {
+                throw new Error("key is required");
+            }
+            return submitted(await secretStorage.rotateNamedApiKey(address, name, encrypt(key), proof));
+        },
+        "/keys/delete": async ({ address, name }) => {
+            return submitted(await secretStorage.deleteNamedApiKey(address, name, proof));
+        },
+    };
+}
+
+async function main() {
+    if (encryptionKey.length !== 32) {
+        throw new Error("SIDECAR_ENCRYPTION_KEY must be 32 bytes, hex encoded");
+    }
+
+    const [signer] = await hre.ethers.getSigners();
+    const signerAddress = await signer.getAddress();
+    const proofEntry = Object.entries(deployData.proofs)
+        .find(([address]) => address.toLowerCase() === signerAddress.toLowerCase());
+    if (!proofEntry) {
+        throw new Error(`Signer ${signerAddress} has no Merkle proof in deployData.json`);
+    }
+    const proof = proofEntry[1];
+
+    const SecretStorage = await hre.ethers.getContractFactory("SecretStorage");
+    const secretStorage = SecretStorage.attach(deployData.addresses.secretStorage).connect(signer);
+
+    const routes = routesFor(secretStorage, proof);
+
+    const server = http.createServer(async (req, res) => {
+        if (req.method === "GET" && req.url === "/") {
+            return reply(res, 200, { success: true });
+        }
+        const route = routes[req.url];
+        if (req.method !== "POST" || !route) {
+            return reply(res, 404, { success: false, error: "Not found" });
+        }
+
+        try {
+            const body = await readBody(req);
+            if (!hre.ethers.isAddress(body.address) || (!body.name && req.url !== "/keys/get")) {
+                return reply(res, 400, { success: false, error: "address and name are required" });
+            }
+            reply(res, 200, await route(body));
+        } catch (error) {
+            // Reverts carry the contract's reason, which the Go client passes on
+            reply(res, 400, { success: false, error: error.shortMessage || error.reason || error.message });
+        }
+    });
+
+    server.listen(port, () => {
+        console.log(`Contract sidecar listening on :${port} as ${signerAddress}`);
+        console.log("SecretStorage:", deployData.addresses.secretStorage);
+    });
+}
+
+module.exports = { encrypt, decrypt, routesFor };
+
+if (require.main === module) {
+    main().catch((error) => {
+        console.error(error);
+        process.exitCode = 1;
+    });
+}
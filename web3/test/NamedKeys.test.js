@@ -0,0 +1,90 @@
+const { expect } = require("chai");
+const { ethers } = require("hardhat");
+const { MerkleTree } = require('merkletreejs');
+
+describe("Named API keys", function () {
+  let secretStorage;
+  let relayer;
+  let owner;
+  let outsider;
+  let proof;
+  let outsiderProof;
+
+  beforeEach(async function () {
+    [relayer, owner, outsider] = await ethers.getSigners();
+
+    // Same leaves as scripts/generateKeys.js
+    const leaf = addr => ethers.keccak256(ethers.solidityPacked(['address'], [addr]));
+    const tree = new MerkleTree([relayer.address, owner.address].map(leaf), ethers.keccak256, { sortPairs: true });
+    proof = tree.getHexProof(leaf(relayer.address));
+    outsiderProof = tree.getHexProof(leaf(outsider.address));
+
+    const Verifier = await ethers.getContractFactory("Verifier");
+    const verifier = await Verifier.deploy(tree.getHexRoot());
+    await verifier.waitForDeployment();
+
+    const SecretStorage = await ethers.getContractFactory("SecretStorage");
+    secretStorage = await SecretStorage.deploy(await verifier.getAddress());
+    await secretStorage.waitForDeployment();
+  });
+
+  it("keeps each name in its own slot", async function () {
+    await secretStorage.storeNamedApiKey(owner.address, "work", "openai", "cipher-work", proof);
+    await secretStorage.storeNamedApiKey(owner.address, "personal", "anthropic", "cipher-personal", proof);
+
+    const [provider, key, version] = await secretStorage.getNamedApiKey(owner.address, "work", proof);
+    expect(provider).to.equal("openai");
+    expect(key).to.equal("cipher-work");
+    expect(version).to.equal(1n);
+
+    const [, personal] = await secretStorage.getNamedApiKey(owner.address, "personal", proof);
+    expect(personal).to.equal("cipher-personal");
+  });
+
+  it("rejects a second store under a taken name", async function () {
+    await secretStorage.storeNamedApiKey(owner.address, "work", "openai", "cipher-1", proof);
+    await expect(
+      secretStorage.storeNamedApiKey(owner.address, "work", "openai", "cipher-2", proof)
+    ).to.be.revertedWith("API key already stored");
+  });
+
+  it("rotates a key and bumps its version", async function () {
+    await secretStorage.storeNamedApiKey(owner.address, "work", "openai", "cipher-1", proof);
+    await secretStorage.rotateNamedApiKey(owner.address, "work", "cipher-2", proof);
+
+    const [provider, key, version] = await secretStorage.getNamedApiKey(owner.address, "work", proof);
+    expect(provider).to.equal("openai");
+    expect(key).to.equal("cipher-2");
+    expect(version).to.equal(2n);
+  });
+
+  it("deletes a key and frees its name", async function () {
+    await secretStorage.storeNamedApiKey(owner.address, "work", "openai", "cipher-1", proof);
+    await expect(secretStorage.deleteNamedApiKey(owner.address, "work", proof))
+      .to.emit(secretStorage, "NamedApiKeyDeleted")
+      .withArgs(owner.address, "work");
+
+    const [, key] = await secretStorage.getNamedApiKey(owner.address, "work", proof);
+    expect(key).to.equal("");
+
+    await secretStorage.storeNamedApiKey(owner.address, "work", "openai", "cipher-2", proof);
+  });
+
+  it("refuses rotating or deleting a name with no key", async function () {
+    await expect(
+      secretStorage.rotateNamedApiKey(owner.address, "missing", "cipher", proof)
+    ).to.be.revertedWith("API key not stored");
+    await expect(
+      secretStorage.deleteNamedApiKey(owner.address, "missing", proof)
+    ).to.be.revertedWith("API key not stored");
+  });
+
+  it("refuses senders outside the Merkle tree", async function () {
+    await expect(
+      secretStorage.connect(outsider).storeNamedApiKey(owner.address, "work", "openai", "cipher", outsiderProof)
+    ).to.be.revertedWith("Not authorized to store API keys");
+    await expect(
+      secretStorage.connect(outsider).deleteNamedApiKey(owner.address, "work", outsiderProof)
+    ).to.be.revertedWith("Not authorized to delete API keys");
+  });
+});
@@ -0,0 +1,52 @@
+const { expect } = require("chai");
+const { ethers } = require("hardhat");
+const { MerkleTree } = require('merkletreejs');
+
+// The sidecar reads its encryption key when it is loaded
+process.env.SIDECAR_ENCRYPTION_KEY = "11".repeat(32);
+const { encrypt, routesFor } = require("../scripts/sidecar");
+
+describe("Sidecar key reads", function () {
+  let secretStorage;
+  let owner;
+  let proof;
+  let routes;
+
+  beforeEach(async function () {
+    let relayer;
+    [relayer, owner] = await ethers.getSigners();
+
+    const leaf = addr => ethers.keccak256(ethers.solidityPacked(['address'], [addr]));
+    const tree = new MerkleTree([relayer.address, owner.address].map(leaf), ethers.keccak256, { sortPairs: true });
+    proof = tree.getHexProof(leaf(relayer.address));
+
+    const Verifier = await ethers.getContractFactory("Verifier");
+    const verifier = await Verifier.deploy(tree.getHexRoot());
+    await verifier.waitForDeployment();
+
+    const SecretStorage = await ethers.getContractFactory("SecretStorage");
+    secretStorage = await SecretStorage.deploy(await verifier.getAddress());
+    await secretStorage.waitForDeployment();
+
+    routes = routesFor(secretStorage, proof);
+  });
+
+  it("decrypts a named key", async function () {
+    await routes["/keys/store"]({ address: owner.address, name: "work", provider: "openai", key: "sk-named" });
+
+    const reply = await routes["/keys/get"]({ address: owner.address, name: "work" });
+    expect(reply.key).to.equal("sk-named");
+  });
+
+  it("decrypts the legacy slot when no name is given", async function () {
+    await secretStorage.storeEncryptedApiKey(owner.address, encrypt("sk-legacy"), proof);
+
+    const reply = await routes["/keys/get"]({ address: owner.address });
+    expect(reply).to.deep.equal({ success: true, key: "sk-legacy" });
+  });
+
+  it("returns an empty key for an empty legacy slot", async function () {
+    const reply = await routes["/keys/get"]({ address: owner.address });
+    expect(reply.key).to.equal("");
+  });
+});